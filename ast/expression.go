@@ -0,0 +1,200 @@
+package ast
+
+import (
+	"github.com/EngineersBox/Schematic/diagnostics"
+)
+
+// Expression is an expression assigned to an attribute
+type Expression interface {
+	Node
+	expression()
+}
+
+// IdentExpr is a bare identifier, either a reference such as var.name or a
+// bare literal such as true or string.
+type IdentExpr struct {
+	Name *Token
+}
+
+// NumberExpr is a number literal, including the sign of a negative number
+// written directly before it.
+type NumberExpr struct {
+	Token *Token
+}
+
+// StringExpr is a quoted string or heredoc without interpolations or
+// directives.
+type StringExpr struct {
+	Token *Token
+}
+
+// TemplateExpr is a quoted string or heredoc containing interpolations or
+// directives, the literal of the token is the source of the template.
+type TemplateExpr struct {
+	Token *Token
+}
+
+// TupleExpr is an array of the form [<EXPRESSION>, ...]
+type TupleExpr struct {
+	Open  *Token
+	Elems []Expression
+	// Commas holds the comma following each element, nil if there is none
+	Commas []*Token
+	Close  *Token
+}
+
+// ObjectExpr is a block of the form { <NAME> = <EXPRESSION> ... }
+type ObjectExpr struct {
+	Open       *Token
+	Attributes []*Attribute
+	Close      *Token
+}
+
+// FunctionCallExpr is a function call of the form <NAME>(<EXPRESSION>, ...)
+type FunctionCallExpr struct {
+	Name *Token
+	Open *Token
+	Args []Expression
+	// Commas holds the comma following each argument, nil if there is none
+	Commas []*Token
+	Close  *Token
+}
+
+// ParenExpr is an expression in parentheses
+type ParenExpr struct {
+	Open  *Token
+	Expr  Expression
+	Close *Token
+}
+
+// UnaryExpr is a logical not or negation
+type UnaryExpr struct {
+	Operator *Token
+	Operand  Expression
+}
+
+// BinaryExpr is an arithmetic, comparison or logical operation
+type BinaryExpr struct {
+	LHS      Expression
+	Operator *Token
+	RHS      Expression
+}
+
+// ConditionalExpr is a conditional of the form <CONDITION> ? <TRUE> : <FALSE>
+type ConditionalExpr struct {
+	Condition Expression
+	Question  *Token
+	True      Expression
+	Colon     *Token
+	False     Expression
+}
+
+// IndexExpr is an index into a collection of the form <COLLECTION>[<KEY>]
+type IndexExpr struct {
+	Collection Expression
+	Open       *Token
+	Key        Expression
+	Close      *Token
+}
+
+// GetAttrExpr is an attribute access of the form <COLLECTION>.<NAME>
+type GetAttrExpr struct {
+	Collection Expression
+	Period     *Token
+	Name       *Token
+}
+
+func (e *IdentExpr) expression()        {}
+func (e *NumberExpr) expression()       {}
+func (e *StringExpr) expression()       {}
+func (e *TemplateExpr) expression()     {}
+func (e *TupleExpr) expression()        {}
+func (e *ObjectExpr) expression()       {}
+func (e *FunctionCallExpr) expression() {}
+func (e *ParenExpr) expression()        {}
+func (e *UnaryExpr) expression()        {}
+func (e *BinaryExpr) expression()       {}
+func (e *ConditionalExpr) expression()  {}
+func (e *IndexExpr) expression()        {}
+func (e *GetAttrExpr) expression()      {}
+
+func (e *IdentExpr) Range() diagnostics.Range        { return e.Name.Range }
+func (e *NumberExpr) Range() diagnostics.Range       { return e.Token.Range }
+func (e *StringExpr) Range() diagnostics.Range       { return e.Token.Range }
+func (e *TemplateExpr) Range() diagnostics.Range     { return e.Token.Range }
+func (e *TupleExpr) Range() diagnostics.Range        { return e.Open.Range.Join(e.Close.Range) }
+func (e *ObjectExpr) Range() diagnostics.Range       { return e.Open.Range.Join(e.Close.Range) }
+func (e *FunctionCallExpr) Range() diagnostics.Range { return e.Name.Range.Join(e.Close.Range) }
+func (e *ParenExpr) Range() diagnostics.Range        { return e.Open.Range.Join(e.Close.Range) }
+func (e *UnaryExpr) Range() diagnostics.Range        { return e.Operator.Range.Join(e.Operand.Range()) }
+func (e *BinaryExpr) Range() diagnostics.Range       { return e.LHS.Range().Join(e.RHS.Range()) }
+func (e *ConditionalExpr) Range() diagnostics.Range  { return e.Condition.Range().Join(e.False.Range()) }
+func (e *IndexExpr) Range() diagnostics.Range        { return e.Collection.Range().Join(e.Close.Range) }
+func (e *GetAttrExpr) Range() diagnostics.Range      { return e.Collection.Range().Join(e.Name.Range) }
+
+func (e *IdentExpr) Tokens() []*Token    { return []*Token{e.Name} }
+func (e *NumberExpr) Tokens() []*Token   { return []*Token{e.Token} }
+func (e *StringExpr) Tokens() []*Token   { return []*Token{e.Token} }
+func (e *TemplateExpr) Tokens() []*Token { return []*Token{e.Token} }
+
+func (e *TupleExpr) Tokens() []*Token {
+	tokens := []*Token{e.Open}
+	tokens = appendSeparated(tokens, e.Elems, e.Commas)
+	return append(tokens, e.Close)
+}
+
+func (e *ObjectExpr) Tokens() []*Token {
+	tokens := []*Token{e.Open}
+	for _, attribute := range e.Attributes {
+		tokens = append(tokens, attribute.Tokens()...)
+	}
+	return append(tokens, e.Close)
+}
+
+func (e *FunctionCallExpr) Tokens() []*Token {
+	tokens := []*Token{e.Name, e.Open}
+	tokens = appendSeparated(tokens, e.Args, e.Commas)
+	return append(tokens, e.Close)
+}
+
+func (e *ParenExpr) Tokens() []*Token {
+	tokens := append([]*Token{e.Open}, e.Expr.Tokens()...)
+	return append(tokens, e.Close)
+}
+
+func (e *UnaryExpr) Tokens() []*Token {
+	return append([]*Token{e.Operator}, e.Operand.Tokens()...)
+}
+
+func (e *BinaryExpr) Tokens() []*Token {
+	tokens := append(e.LHS.Tokens(), e.Operator)
+	return append(tokens, e.RHS.Tokens()...)
+}
+
+func (e *ConditionalExpr) Tokens() []*Token {
+	tokens := append(e.Condition.Tokens(), e.Question)
+	tokens = append(append(tokens, e.True.Tokens()...), e.Colon)
+	return append(tokens, e.False.Tokens()...)
+}
+
+func (e *IndexExpr) Tokens() []*Token {
+	tokens := append(e.Collection.Tokens(), e.Open)
+	tokens = append(tokens, e.Key.Tokens()...)
+	return append(tokens, e.Close)
+}
+
+func (e *GetAttrExpr) Tokens() []*Token {
+	return append(e.Collection.Tokens(), e.Period, e.Name)
+}
+
+// appendSeparated appends the tokens of each expression followed by its
+// separator, if any.
+func appendSeparated(tokens []*Token, exprs []Expression, separators []*Token) []*Token {
+	for i, expr := range exprs {
+		tokens = append(tokens, expr.Tokens()...)
+		if i < len(separators) && separators[i] != nil {
+			tokens = append(tokens, separators[i])
+		}
+	}
+	return tokens
+}
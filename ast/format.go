@@ -0,0 +1,352 @@
+package ast
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// indentation is the indentation of each level of nesting
+const indentation = "  "
+
+// Format rewrites the whitespace of a parsed file into the canonical style.
+// Nested bodies are indented by two spaces, the equals signs of consecutive
+// attributes are aligned and single quoted strings are double quoted. Line
+// breaks are kept where they were written, except that every top-level
+// block starts on a new line, and comments are kept in place.
+func Format(file *File) {
+	f := &formatter{}
+	for i, block := range file.Blocks {
+		if i == 0 {
+			f.leading(block.Type, 0, "")
+			block.Type.Leading = strings.TrimLeft(block.Type.Leading, "\n")
+		} else {
+			f.leading(block.Type, 0, "\n")
+		}
+		f.block(block, 0)
+	}
+	f.leading(file.EOF, 0, "")
+	file.EOF.Leading = strings.TrimRight(file.EOF.Leading, " \n")
+	if len(file.Blocks) == 0 {
+		file.EOF.Leading = strings.TrimLeft(file.EOF.Leading, "\n")
+	}
+	if len(file.Blocks) > 0 || file.EOF.Leading != "" {
+		file.EOF.Leading += "\n"
+	}
+}
+
+type formatter struct {
+	// prev is the token before the one being formatted
+	prev *Token
+}
+
+// leading rewrites the whitespace before a token. Whitespace without line
+// breaks or comments is replaced with inline, otherwise each comment and the
+// token are indented to the given depth. At most one blank line is kept
+// between lines.
+func (f *formatter) leading(token *Token, depth int, inline string) {
+	f.rewrite(token, depth, depth, inline)
+}
+
+// closing rewrites the whitespace before a closing brace or bracket, where
+// comments are indented to the depth of the elements it closes.
+func (f *formatter) closing(token *Token, depth int, inline string) {
+	f.rewrite(token, depth+1, depth, inline)
+}
+
+func (f *formatter) rewrite(token *Token, commentDepth int, depth int, inline string) {
+	defer func() { f.prev = token }()
+	indent := strings.Repeat(indentation, depth)
+	// Heredocs end with a line break, so the next token starts a new line
+	afterNewline := f.prev != nil && strings.HasSuffix(f.prev.Text, "\n")
+	var out strings.Builder
+	newlines := 0
+	if afterNewline {
+		newlines = 1
+	}
+	lineBreak := func() {
+		if newlines > 2 {
+			newlines = 2
+		}
+		if afterNewline && out.Len() == 0 {
+			newlines--
+		}
+		out.WriteString(strings.Repeat("\n", newlines))
+		newlines = 0
+	}
+	for _, piece := range splitTrivia(token.Leading) {
+		if !isComment(piece) {
+			newlines += strings.Count(piece, "\n")
+			continue
+		}
+		if newlines == 0 {
+			if f.prev != nil {
+				out.WriteString(" ")
+			}
+		} else {
+			lineBreak()
+			out.WriteString(strings.Repeat(indentation, commentDepth))
+		}
+		out.WriteString(piece)
+	}
+	if newlines == 0 && strings.Contains(inline, "\n") {
+		newlines = 1
+	}
+	if newlines == 0 && !afterNewline {
+		out.WriteString(inline)
+	} else {
+		lineBreak()
+		out.WriteString(indent)
+	}
+	token.Leading = out.String()
+}
+
+// inline rewrites the whitespace before a token that must directly follow
+// the previous one.
+func (f *formatter) inline(token *Token) {
+	token.Leading = ""
+	f.prev = token
+}
+
+// startsLine returns true if the token follows a line break
+func startsLine(prev *Token, token *Token) bool {
+	return strings.Contains(token.Leading, "\n") || prev != nil && strings.HasSuffix(prev.Text, "\n")
+}
+
+func (f *formatter) block(block *Block, depth int) {
+	for _, label := range block.Labels {
+		f.leading(label, depth+1, " ")
+		normalizeQuotes(label)
+	}
+	if block.Value != nil {
+		f.leading(block.Equals, depth+1, " ")
+		f.leading(firstToken(block.Value), depth+1, " ")
+		f.expression(block.Value, depth)
+		return
+	}
+	f.leading(block.OpenBrace, depth+1, " ")
+	f.body(block.Body, depth+1)
+	if len(block.Body) == 0 {
+		f.closing(block.CloseBrace, depth, "")
+	} else {
+		f.closing(block.CloseBrace, depth, " ")
+	}
+}
+
+// body formats the items of a body, aligning the equals signs of each group
+// of single line attributes on consecutive lines.
+func (f *formatter) body(items []BodyItem, depth int) {
+	group := make([]*Attribute, 0)
+	for _, item := range items {
+		first, prev := firstToken(item), f.prev
+		f.leading(first, depth, " ")
+		newLine := startsLine(prev, first)
+		attribute, ok := item.(*Attribute)
+		if !ok || !newLine || strings.Contains(first.Leading, "\n\n") {
+			alignEquals(group)
+			group = group[:0]
+		}
+		if !ok {
+			f.block(item.(*Block), depth)
+			continue
+		}
+		normalizeQuotes(attribute.Name)
+		f.attribute(attribute, depth)
+		if spansLines(attribute) {
+			// Attributes spanning multiple lines are not aligned
+			alignEquals(group)
+			group = group[:0]
+		} else if newLine {
+			group = append(group, attribute)
+		}
+	}
+	alignEquals(group)
+}
+
+func (f *formatter) attribute(attribute *Attribute, depth int) {
+	f.leading(attribute.Equals, depth+1, " ")
+	f.leading(firstToken(attribute.Value), depth+1, " ")
+	f.expression(attribute.Value, depth)
+	if attribute.Comma != nil {
+		f.leading(attribute.Comma, depth+1, "")
+	}
+}
+
+// alignEquals pads the names of the attributes so that their equals signs
+// are in the same column.
+func alignEquals(group []*Attribute) {
+	width := 0
+	for _, attribute := range group {
+		if w := utf8.RuneCountInString(attribute.Name.Text); w > width {
+			width = w
+		}
+	}
+	for _, attribute := range group {
+		if strings.TrimSpace(attribute.Equals.Leading) != "" {
+			// A comment between the name and equals sign
+			continue
+		}
+		attribute.Equals.Leading = strings.Repeat(" ", width-utf8.RuneCountInString(attribute.Name.Text)+1)
+	}
+}
+
+// spansLines returns true if the tokens of a node after the first start on
+// a new line.
+func spansLines(node Node) bool {
+	for _, token := range node.Tokens()[1:] {
+		if strings.Contains(token.Leading, "\n") || strings.HasSuffix(token.Text, "\n") {
+			return true
+		}
+	}
+	return false
+}
+
+// expression formats the tokens of an expression after the first, which is
+// formatted by the caller. Expressions continued on a new line are indented
+// one level deeper than the line they start on.
+func (f *formatter) expression(expr Expression, depth int) {
+	switch e := expr.(type) {
+	case *IdentExpr:
+	case *NumberExpr:
+	case *StringExpr:
+		normalizeQuotes(e.Token)
+	case *TemplateExpr:
+		normalizeQuotes(e.Token)
+	case *TupleExpr:
+		f.list(e.Elems, e.Commas, depth)
+		f.closing(e.Close, depth, "")
+	case *ObjectExpr:
+		f.body(attributeItems(e.Attributes), depth+1)
+		if len(e.Attributes) == 0 {
+			f.closing(e.Close, depth, "")
+		} else {
+			f.closing(e.Close, depth, " ")
+		}
+	case *FunctionCallExpr:
+		f.inline(e.Open)
+		f.list(e.Args, e.Commas, depth)
+		f.closing(e.Close, depth, "")
+	case *ParenExpr:
+		f.leading(firstToken(e.Expr), depth+1, "")
+		f.expression(e.Expr, depth)
+		f.closing(e.Close, depth, "")
+	case *UnaryExpr:
+		f.leading(firstToken(e.Operand), depth+1, "")
+		f.expression(e.Operand, depth)
+	case *BinaryExpr:
+		f.expression(e.LHS, depth)
+		f.leading(e.Operator, depth+1, " ")
+		f.leading(firstToken(e.RHS), depth+1, " ")
+		f.expression(e.RHS, depth)
+	case *ConditionalExpr:
+		f.expression(e.Condition, depth)
+		f.leading(e.Question, depth+1, " ")
+		f.leading(firstToken(e.True), depth+1, " ")
+		f.expression(e.True, depth)
+		f.leading(e.Colon, depth+1, " ")
+		f.leading(firstToken(e.False), depth+1, " ")
+		f.expression(e.False, depth)
+	case *IndexExpr:
+		f.expression(e.Collection, depth)
+		f.inline(e.Open)
+		f.leading(firstToken(e.Key), depth+1, "")
+		f.expression(e.Key, depth)
+		f.closing(e.Close, depth, "")
+	case *GetAttrExpr:
+		f.expression(e.Collection, depth)
+		f.inline(e.Period)
+		f.inline(e.Name)
+	}
+}
+
+// list formats the elements of an array or the arguments of a function
+// call, elements on their own line are indented one level deeper.
+func (f *formatter) list(elems []Expression, separators []*Token, depth int) {
+	for i, elem := range elems {
+		if i == 0 {
+			f.leading(firstToken(elem), depth+1, "")
+		} else {
+			f.leading(firstToken(elem), depth+1, " ")
+		}
+		f.expression(elem, depth+1)
+		if i < len(separators) && separators[i] != nil {
+			f.leading(separators[i], depth+1, "")
+		}
+	}
+}
+
+func attributeItems(attributes []*Attribute) []BodyItem {
+	items := make([]BodyItem, len(attributes))
+	for i, attribute := range attributes {
+		items[i] = attribute
+	}
+	return items
+}
+
+func firstToken(node Node) *Token {
+	return node.Tokens()[0]
+}
+
+// normalizeQuotes rewrites a single quoted string with double quotes,
+// leaving its escape sequences as written. Templates containing double
+// quotes are left as is, as they may be part of a nested expression.
+func normalizeQuotes(token *Token) {
+	text := token.Text
+	if len(text) < 2 || text[0] != '\'' {
+		return
+	}
+	inner := text[1 : len(text)-1]
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(inner); i++ {
+		switch ch := inner[i]; {
+		case ch == '\\' && i+1 < len(inner):
+			i++
+			if inner[i] != '\'' {
+				out.WriteByte('\\')
+			}
+			out.WriteByte(inner[i])
+		case ch == '"':
+			if strings.Contains(inner, "${") || strings.Contains(inner, "%{") {
+				return
+			}
+			out.WriteString("\\\"")
+		default:
+			out.WriteByte(ch)
+		}
+	}
+	out.WriteByte('"')
+	token.Text = out.String()
+}
+
+// splitTrivia splits whitespace and comments into pieces, each being either
+// a comment or a run of whitespace.
+func splitTrivia(trivia string) []string {
+	pieces := make([]string, 0)
+	for len(trivia) > 0 {
+		end := 0
+		switch {
+		case strings.HasPrefix(trivia, "#") || strings.HasPrefix(trivia, "//"):
+			end = strings.IndexByte(trivia, '\n')
+			if end < 0 {
+				end = len(trivia)
+			}
+		case strings.HasPrefix(trivia, "/*"):
+			end = strings.Index(trivia, "*/") + 2
+			if end < 2 {
+				end = len(trivia)
+			}
+		default:
+			end = strings.IndexFunc(trivia, func(r rune) bool { return r != ' ' && r != '\t' && r != '\n' })
+			if end < 0 {
+				end = len(trivia)
+			}
+		}
+		pieces = append(pieces, trivia[:end])
+		trivia = trivia[end:]
+	}
+	return pieces
+}
+
+func isComment(piece string) bool {
+	return strings.HasPrefix(piece, "#") || strings.HasPrefix(piece, "/")
+}
@@ -0,0 +1,117 @@
+package ast_test
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/parser"
+	"strings"
+	"testing"
+)
+
+// parseFile parses the source into a syntax tree without decoding it
+func parseFile(t *testing.T, src string) *ast.File {
+	t.Helper()
+	file, err := parser.NewParser(strings.NewReader(src)).ParseFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"shorthand variable", "variable   \"a\"=1\n"},
+		{"comments", "# leading\nvariable \"a\" { // trailing\n  value = 1 /* inline */\n}\n"},
+		{"heredoc", "variable \"a\" {\n  value = <<-EOT\n    text ${var.b}\n    EOT\n}\n"},
+		{"template directives", "capture \"c\" {\nsource = \"%{if true}a%{else}b%{endif}\"\n}\n"},
+		{"expressions", "capture \"c\" { source = (1+2)*var.n>3?[1,2][0]:{a=1}.a }"},
+		{"function call", "capture \"c\" { source = join(\",\",  [\"a\",\n\"b\",]) }"},
+		{"single quotes", "variable 'a' = 'b'"},
+		{"no trailing newline", "data \"file\" \"d\" {\n\tsource = \"L::x\"\n}"},
+		{"empty", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(ast.Bytes(parseFile(t, test.src))); got != test.src {
+				t.Errorf("got %q, want %q", got, test.src)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "already formatted",
+			src:  "variable \"a\" = 1\n",
+			want: "variable \"a\" = 1\n",
+		},
+		{
+			name: "spacing",
+			src:  "variable   \"a\"   =   1",
+			want: "variable \"a\" = 1\n",
+		},
+		{
+			name: "indentation",
+			src:  "variable \"a\" {\n        value = 1\n}\n",
+			want: "variable \"a\" {\n  value = 1\n}\n",
+		},
+		{
+			name: "aligned equals",
+			src:  "capture \"c\" {\na=1\nlong_name=2\n\nb=3\n}\n",
+			want: "capture \"c\" {\n  a         = 1\n  long_name = 2\n\n  b = 3\n}\n",
+		},
+		{
+			name: "blank lines collapsed",
+			src:  "variable \"a\" = 1\n\n\n\nvariable \"b\" = 2\n",
+			want: "variable \"a\" = 1\n\nvariable \"b\" = 2\n",
+		},
+		{
+			name: "nested block and array",
+			src:  "instance \"t::c\" \"x\" {\nconfig = {\npidsMax=20\n}\nnames = [\n\"a\",\n\"b\"\n]\n}\n",
+			want: "instance \"t::c\" \"x\" {\n  config = {\n    pidsMax = 20\n  }\n  names = [\n    \"a\",\n    \"b\"\n  ]\n}\n",
+		},
+		{
+			name: "operators and lists",
+			src:  "capture \"c\" {\nsource = [1,2]==[var.a*2,3]\n}\n",
+			want: "capture \"c\" {\n  source = [1, 2] == [var.a * 2, 3]\n}\n",
+		},
+		{
+			name: "comments kept in place",
+			src:  "# about a\nvariable \"a\" {\n   # about value\n   value = 1    # one\n}\n",
+			want: "# about a\nvariable \"a\" {\n  # about value\n  value = 1 # one\n}\n",
+		},
+		{
+			name: "single quotes",
+			src:  "variable \"a\" = 'b'\n",
+			want: "variable \"a\" = \"b\"\n",
+		},
+		{
+			name: "blocks on their own lines",
+			src:  "variable \"a\" = 1 variable \"b\" = 2\n",
+			want: "variable \"a\" = 1\nvariable \"b\" = 2\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := parseFile(t, test.src)
+			ast.Format(file)
+			got := string(ast.Bytes(file))
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+			// Formatting is idempotent
+			file = parseFile(t, got)
+			ast.Format(file)
+			if again := string(ast.Bytes(file)); again != got {
+				t.Errorf("formatted twice got %q, want %q", again, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package ast defines the syntax tree of a schematic file. Every node keeps
+// the tokens it was parsed from, along with the whitespace and comments
+// preceding them, so that the tree can be printed back into the exact source
+// it was parsed from.
+package ast
+
+import (
+	"github.com/EngineersBox/Schematic/diagnostics"
+)
+
+// Token is a single token of the source
+type Token struct {
+	// Leading is the whitespace and comments between the previous token and
+	// this one
+	Leading string
+	// Text is the token as written in the source
+	Text string
+	// Lit is the literal value of the token. Quotes are removed from strings
+	// and their escape sequences replaced, the literal of a heredoc is its
+	// content.
+	Lit   string
+	Range diagnostics.Range
+}
+
+// Node is a node of the syntax tree
+type Node interface {
+	// Range returns the source range of the node, excluding the whitespace
+	// and comments before its first token
+	Range() diagnostics.Range
+	// Tokens returns the tokens of the node in source order
+	Tokens() []*Token
+}
+
+// File is a parsed schematic file
+type File struct {
+	Filename string
+	Blocks   []*Block
+	// EOF holds the whitespace and comments after the last block
+	EOF *Token
+}
+
+func (f *File) Range() diagnostics.Range {
+	return diagnostics.Range{
+		Filename: f.Filename,
+		Start:    diagnostics.InitialPos,
+		End:      f.EOF.Range.End,
+	}
+}
+
+func (f *File) Tokens() []*Token {
+	tokens := make([]*Token, 0)
+	for _, block := range f.Blocks {
+		tokens = append(tokens, block.Tokens()...)
+	}
+	return append(tokens, f.EOF)
+}
+
+// BodyItem is an attribute or nested block within the body of a block
+type BodyItem interface {
+	Node
+	bodyItem()
+}
+
+// Block is a declaration of the form <TYPE> <LABEL>... { <BODY> }, or the
+// shorthand form <TYPE> <LABEL>... = <EXPRESSION>. Blocks nested within a
+// body are named by their type.
+type Block struct {
+	Type   *Token
+	Labels []*Token
+
+	// Set for the block form
+	OpenBrace  *Token
+	Body       []BodyItem
+	CloseBrace *Token
+
+	// Set for the shorthand form
+	Equals *Token
+	Value  Expression
+}
+
+func (b *Block) bodyItem() {}
+
+func (b *Block) Range() diagnostics.Range {
+	if b.Value != nil {
+		return b.Type.Range.Join(b.Value.Range())
+	}
+	return b.Type.Range.Join(b.CloseBrace.Range)
+}
+
+func (b *Block) Tokens() []*Token {
+	tokens := append([]*Token{b.Type}, b.Labels...)
+	if b.Value != nil {
+		return append(append(tokens, b.Equals), b.Value.Tokens()...)
+	}
+	tokens = append(tokens, b.OpenBrace)
+	for _, item := range b.Body {
+		tokens = append(tokens, item.Tokens()...)
+	}
+	return append(tokens, b.CloseBrace)
+}
+
+// Attributes returns the attributes in the body of the block
+func (b *Block) Attributes() []*Attribute {
+	attributes := make([]*Attribute, 0, len(b.Body))
+	for _, item := range b.Body {
+		if attribute, ok := item.(*Attribute); ok {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// Attribute is an assignment of the form <NAME> = <EXPRESSION>, optionally
+// followed by a comma.
+type Attribute struct {
+	Name   *Token
+	Equals *Token
+	Value  Expression
+	Comma  *Token
+}
+
+func (a *Attribute) bodyItem() {}
+
+func (a *Attribute) Range() diagnostics.Range { return a.Name.Range.Join(a.Value.Range()) }
+
+func (a *Attribute) Tokens() []*Token {
+	tokens := append([]*Token{a.Name, a.Equals}, a.Value.Tokens()...)
+	if a.Comma != nil {
+		tokens = append(tokens, a.Comma)
+	}
+	return tokens
+}
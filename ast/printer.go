@@ -0,0 +1,27 @@
+package ast
+
+import (
+	"bytes"
+	"io"
+)
+
+// Fprint writes the source of a node. A node is written exactly as it was
+// parsed, so printing a parsed File reproduces the original file.
+func Fprint(w io.Writer, node Node) error {
+	for _, token := range node.Tokens() {
+		if _, err := io.WriteString(w, token.Leading); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, token.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bytes returns the source of a node
+func Bytes(node Node) []byte {
+	var buf bytes.Buffer
+	_ = Fprint(&buf, node)
+	return buf.Bytes()
+}
@@ -0,0 +1,134 @@
+package diagnostics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityInvalid Severity = iota
+	SeverityError
+	SeverityWarning
+)
+
+func (s Severity) ToString() string {
+	switch s {
+	case SeverityError:
+		return "Error"
+	case SeverityWarning:
+		return "Warning"
+	default:
+		return "Invalid"
+	}
+}
+
+// Diagnostic is a problem found in the source, with an optional range of the
+// source the problem applies to.
+type Diagnostic struct {
+	Severity Severity
+	Summary  string
+	Detail   string
+	Subject  *Range
+}
+
+// Errorf creates an error diagnostic for the given source range
+func Errorf(subject Range, summary string, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(format, args...),
+		Subject:  &subject,
+	}
+}
+
+// Warningf creates a warning diagnostic for the given source range
+func Warningf(subject Range, summary string, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityWarning,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(format, args...),
+		Subject:  &subject,
+	}
+}
+
+func (d *Diagnostic) Error() string {
+	var b strings.Builder
+	if d.Subject != nil {
+		b.WriteString(d.Subject.String())
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Summary)
+	if d.Detail != "" {
+		b.WriteString("; ")
+		b.WriteString(d.Detail)
+	}
+	return b.String()
+}
+
+// Diagnostics is a list of diagnostics, it can be returned as an error when
+// it contains at least one error diagnostic.
+type Diagnostics []*Diagnostic
+
+// FromError converts an error into diagnostics. Diagnostics are returned as
+// is, any other error becomes an error diagnostic for the given range.
+func FromError(err error, subject Range, summary string) Diagnostics {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case Diagnostics:
+		return e
+	case *Diagnostic:
+		return Diagnostics{e}
+	}
+	return Diagnostics{Errorf(subject, summary, "%s", err.Error())}
+}
+
+// HasErrors returns true if any of the diagnostics are errors
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort orders the diagnostics by the position of their subject, diagnostics
+// without a subject are kept first.
+func (d Diagnostics) Sort() {
+	sort.SliceStable(d, func(i, j int) bool {
+		if d[i].Subject == nil || d[j].Subject == nil {
+			return d[i].Subject == nil && d[j].Subject != nil
+		}
+		if d[i].Subject.Filename != d[j].Subject.Filename {
+			return d[i].Subject.Filename < d[j].Subject.Filename
+		}
+		return d[i].Subject.Start.Byte < d[j].Subject.Start.Byte
+	})
+}
+
+// Deduplicate returns the diagnostics without repeats of the same diagnostic
+func (d Diagnostics) Deduplicate() Diagnostics {
+	seen := make(map[*Diagnostic]bool, len(d))
+	unique := make(Diagnostics, 0, len(d))
+	for _, diag := range d {
+		if !seen[diag] {
+			seen[diag] = true
+			unique = append(unique, diag)
+		}
+	}
+	return unique
+}
+
+func (d Diagnostics) Error() string {
+	switch len(d) {
+	case 0:
+		return "no diagnostics"
+	case 1:
+		return d[0].Error()
+	}
+	return fmt.Sprintf("%s, and %d other diagnostic(s)", d[0].Error(), len(d)-1)
+}
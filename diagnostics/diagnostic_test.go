@@ -0,0 +1,108 @@
+package diagnostics
+
+import (
+	"errors"
+	"testing"
+)
+
+func testRange(line int, column int) Range {
+	return Range{
+		Filename: "test.schm",
+		Start:    Pos{Line: line, Column: column},
+		End:      Pos{Line: line, Column: column + 1},
+	}
+}
+
+func TestDiagnosticError(t *testing.T) {
+	tests := []struct {
+		name string
+		diag *Diagnostic
+		want string
+	}{
+		{
+			name: "subject and detail",
+			diag: Errorf(testRange(2, 3), "Unsupported field", "capture [%s] has no field: %s", "c", "target"),
+			want: "test.schm:2:3: Unsupported field; capture [c] has no field: target",
+		},
+		{
+			name: "without a filename",
+			diag: Errorf(Range{Start: Pos{Line: 1, Column: 4}}, "Unexpected token", "got: %s", "foo"),
+			want: "1:4: Unexpected token; got: foo",
+		},
+		{
+			name: "without a subject",
+			diag: &Diagnostic{Severity: SeverityError, Summary: "Invalid state", Detail: "version 3"},
+			want: "Invalid state; version 3",
+		},
+		{
+			name: "without a detail",
+			diag: &Diagnostic{Severity: SeverityWarning, Summary: "Deprecated"},
+			want: "Deprecated",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.diag.Error(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsError(t *testing.T) {
+	first := Errorf(testRange(1, 1), "Unexpected token", "got: foo")
+	second := Errorf(testRange(2, 1), "Unexpected token", "got: bar")
+	tests := []struct {
+		name  string
+		diags Diagnostics
+		want  string
+	}{
+		{"empty", Diagnostics{}, "no diagnostics"},
+		{"one", Diagnostics{first}, "test.schm:1:1: Unexpected token; got: foo"},
+		{"many", Diagnostics{first, second, second}, "test.schm:1:1: Unexpected token; got: foo, and 2 other diagnostic(s)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.diags.Error(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	warning := &Diagnostic{Severity: SeverityWarning, Summary: "Deprecated"}
+	if (Diagnostics{warning}).HasErrors() {
+		t.Error("warnings are not errors")
+	}
+	if !(Diagnostics{warning, Errorf(testRange(1, 1), "Invalid", "")}).HasErrors() {
+		t.Error("expected an error")
+	}
+}
+
+func TestFromError(t *testing.T) {
+	diag := Errorf(testRange(3, 1), "Unsupported field", "x")
+	tests := []struct {
+		name string
+		err  error
+		want Diagnostics
+	}{
+		{"nil", nil, nil},
+		{"diagnostics", Diagnostics{diag}, Diagnostics{diag}},
+		{"diagnostic", diag, Diagnostics{diag}},
+		{"error", errors.New("missing brace"), Diagnostics{Errorf(testRange(1, 2), "Invalid declaration", "missing brace")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FromError(test.err, testRange(1, 2), "Invalid declaration")
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i].Error() != test.want[i].Error() || got[i].Severity != test.want[i].Severity {
+					t.Errorf("got %v, want %v", got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package diagnostics
+
+import "fmt"
+
+// Pos is a position within a source file. Line and Column start at 1, Byte is
+// the offset from the start of the file.
+type Pos struct {
+	Line   int
+	Column int
+	Byte   int
+}
+
+// InitialPos is the position of the first rune in a file
+var InitialPos = Pos{Line: 1, Column: 1, Byte: 0}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Range is the span of source between Start (inclusive) and End (exclusive).
+type Range struct {
+	Filename string
+	Start    Pos
+	End      Pos
+}
+
+func (r Range) String() string {
+	if r.Filename == "" {
+		return r.Start.String()
+	}
+	return fmt.Sprintf("%s:%s", r.Filename, r.Start)
+}
+
+// Join returns the range spanning from the start of r to the end of other
+func (r Range) Join(other Range) Range {
+	return Range{
+		Filename: r.Filename,
+		Start:    r.Start,
+		End:      other.End,
+	}
+}
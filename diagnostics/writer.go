@@ -0,0 +1,127 @@
+package diagnostics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+)
+
+// Writer renders diagnostics along with a caret underlined snippet of the
+// source they refer to.
+type Writer struct {
+	w     io.Writer
+	files map[string][]byte
+	color bool
+}
+
+// NewWriter returns a new instance of Writer. The files map filenames to
+// their source, diagnostics for files not in the map are written without a
+// snippet.
+func NewWriter(w io.Writer, files map[string][]byte, color bool) *Writer {
+	return &Writer{
+		w:     w,
+		files: files,
+		color: color,
+	}
+}
+
+// WriteDiagnostics renders each diagnostic in order
+func (w *Writer) WriteDiagnostics(diags Diagnostics) error {
+	for _, diag := range diags {
+		err := w.WriteDiagnostic(diag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDiagnostic renders a single diagnostic
+func (w *Writer) WriteDiagnostic(diag *Diagnostic) error {
+	var buf bytes.Buffer
+	severityColor := colorRed
+	if diag.Severity == SeverityWarning {
+		severityColor = colorYellow
+	}
+	buf.WriteString(w.colorize(severityColor+colorBold, diag.Severity.ToString()+":"))
+	buf.WriteString(" ")
+	buf.WriteString(w.colorize(colorBold, diag.Summary))
+	buf.WriteString("\n\n")
+	if diag.Subject != nil {
+		fmt.Fprintf(
+			&buf,
+			"  on %s line %d, column %d:\n",
+			diag.Subject.Filename,
+			diag.Subject.Start.Line,
+			diag.Subject.Start.Column,
+		)
+		w.writeSnippet(&buf, diag.Subject, severityColor)
+		buf.WriteString("\n")
+	}
+	if diag.Detail != "" {
+		buf.WriteString(diag.Detail)
+		buf.WriteString("\n\n")
+	}
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+func (w *Writer) writeSnippet(buf *bytes.Buffer, subject *Range, caretColor string) {
+	src, ok := w.files[subject.Filename]
+	if !ok {
+		return
+	}
+	lines := strings.Split(string(src), "\n")
+	if subject.Start.Line < 1 || subject.Start.Line > len(lines) {
+		return
+	}
+	line := []rune(strings.TrimRight(lines[subject.Start.Line-1], "\r"))
+	lineNumber := fmt.Sprintf("%d", subject.Start.Line)
+	fmt.Fprintf(buf, "  %s | %s\n", lineNumber, string(line))
+
+	start := subject.Start.Column - 1
+	end := subject.End.Column - 1
+	if subject.End.Line != subject.Start.Line {
+		end = len(line)
+	}
+	if start > len(line) {
+		start = len(line)
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	if end <= start {
+		end = start + 1
+	}
+	// Preserve tabs so that the carets line up with the source
+	var prefix strings.Builder
+	for _, ch := range line[:start] {
+		if ch == '\t' {
+			prefix.WriteRune('\t')
+		} else {
+			prefix.WriteRune(' ')
+		}
+	}
+	fmt.Fprintf(
+		buf,
+		"  %s | %s%s\n",
+		strings.Repeat(" ", len(lineNumber)),
+		prefix.String(),
+		w.colorize(caretColor, strings.Repeat("^", end-start)),
+	)
+}
+
+func (w *Writer) colorize(color string, s string) string {
+	if !w.color {
+		return s
+	}
+	return color + s + colorReset
+}
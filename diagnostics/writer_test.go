@@ -0,0 +1,117 @@
+package diagnostics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDiagnostic(t *testing.T) {
+	files := map[string][]byte{
+		"test.schm": []byte("variable \"a\" {\n  size = 1\n}\n\tbad = 2\r\n"),
+	}
+	tests := []struct {
+		name  string
+		diag  *Diagnostic
+		color bool
+		want  string
+	}{
+		{
+			name: "snippet",
+			diag: Errorf(
+				Range{Filename: "test.schm", Start: Pos{Line: 2, Column: 3}, End: Pos{Line: 2, Column: 7}},
+				"Unsupported field",
+				"variable [a] has no field: size",
+			),
+			want: "Error: Unsupported field\n\n" +
+				"  on test.schm line 2, column 3:\n" +
+				"  2 |   size = 1\n" +
+				"    |   ^^^^\n\n" +
+				"variable [a] has no field: size\n\n",
+		},
+		{
+			name: "tabs and carriage returns",
+			diag: Errorf(
+				Range{Filename: "test.schm", Start: Pos{Line: 4, Column: 2}, End: Pos{Line: 4, Column: 5}},
+				"Unexpected token",
+				"got: bad",
+			),
+			want: "Error: Unexpected token\n\n" +
+				"  on test.schm line 4, column 2:\n" +
+				"  4 | \tbad = 2\n" +
+				"    | \t^^^\n\n" +
+				"got: bad\n\n",
+		},
+		{
+			name: "range over several lines",
+			diag: Errorf(
+				Range{Filename: "test.schm", Start: Pos{Line: 1, Column: 14}, End: Pos{Line: 3, Column: 2}},
+				"Invalid block",
+				"",
+			),
+			want: "Error: Invalid block\n\n" +
+				"  on test.schm line 1, column 14:\n" +
+				"  1 | variable \"a\" {\n" +
+				"    |              ^\n\n",
+		},
+		{
+			name: "empty range",
+			diag: Errorf(
+				Range{Filename: "test.schm", Start: Pos{Line: 3, Column: 2}, End: Pos{Line: 3, Column: 2}},
+				"Missing closing brace",
+				"",
+			),
+			want: "Error: Missing closing brace\n\n" +
+				"  on test.schm line 3, column 2:\n" +
+				"  3 | }\n" +
+				"    |  ^\n\n",
+		},
+		{
+			name: "file without source",
+			diag: Errorf(
+				Range{Filename: "other.schm", Start: Pos{Line: 1, Column: 1}, End: Pos{Line: 1, Column: 2}},
+				"Unexpected token",
+				"got: x",
+			),
+			want: "Error: Unexpected token\n\n" +
+				"  on other.schm line 1, column 1:\n\n" +
+				"got: x\n\n",
+		},
+		{
+			name: "without a subject",
+			diag: &Diagnostic{Severity: SeverityWarning, Summary: "Undeclared variable", Detail: "b"},
+			want: "Warning: Undeclared variable\n\nb\n\n",
+		},
+		{
+			name:  "color",
+			diag:  &Diagnostic{Severity: SeverityWarning, Summary: "Undeclared variable"},
+			color: true,
+			want:  colorYellow + colorBold + "Warning:" + colorReset + " " + colorBold + "Undeclared variable" + colorReset + "\n\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewWriter(&buf, files, test.color).WriteDiagnostic(test.diag); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("got\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	var buf bytes.Buffer
+	diags := Diagnostics{
+		&Diagnostic{Severity: SeverityError, Summary: "First"},
+		&Diagnostic{Severity: SeverityWarning, Summary: "Second"},
+	}
+	if err := NewWriter(&buf, nil, false).WriteDiagnostics(diags); err != nil {
+		t.Fatal(err)
+	}
+	want := "Error: First\n\nWarning: Second\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffLine is a line of a diff, kind is ' ' if the line is unchanged, '-' if
+// it is removed and '+' if it is added.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns the changes between two versions of a file in the
+// unified format, or nil if they are the same.
+func unifiedDiff(oldName string, newName string, a []byte, b []byte) []byte {
+	lines := diffLines(splitLines(a), splitLines(b))
+	var changes []int
+	for i, line := range lines {
+		if line.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(changes); {
+		// Changes separated by no more than twice the context share a hunk
+		end := start
+		for end+1 < len(changes) && changes[end+1]-changes[end] <= 2*diffContext+1 {
+			end++
+		}
+		writeHunk(&buf, lines, maxInt(changes[start]-diffContext, 0), minInt(changes[end]+diffContext+1, len(lines)))
+		start = end + 1
+	}
+	return buf.Bytes()
+}
+
+// writeHunk writes the lines from first up to last as a hunk
+func writeHunk(buf *bytes.Buffer, lines []diffLine, first int, last int) {
+	oldStart, newStart := 0, 0
+	for _, line := range lines[:first] {
+		if line.kind != '+' {
+			oldStart++
+		}
+		if line.kind != '-' {
+			newStart++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, line := range lines[first:last] {
+		if line.kind != '+' {
+			oldCount++
+		}
+		if line.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty range starts at the line before it
+	if oldCount > 0 {
+		oldStart++
+	}
+	if newCount > 0 {
+		newStart++
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, line := range lines[first:last] {
+		buf.WriteByte(line.kind)
+		buf.WriteString(line.text)
+		if !strings.HasSuffix(line.text, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the start and number of lines of a hunk, where the
+// number is left out if it is one
+func hunkRange(start int, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// diffLines returns the shortest edit from a to b, as the longest common
+// subsequence of their lines. The common prefix and suffix are trimmed
+// first, as formatting usually changes few lines of a file.
+func diffLines(a []string, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{kind: ' ', text: text})
+	}
+	oldLines, newLines := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	// common[i][j] is the length of the longest common subsequence of
+	// oldLines[i:] and newLines[j:]
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = maxInt(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		switch {
+		case i < len(oldLines) && j < len(newLines) && oldLines[i] == newLines[j]:
+			lines = append(lines, diffLine{kind: ' ', text: oldLines[i]})
+			i++
+			j++
+		case j == len(newLines) || (i < len(oldLines) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, diffLine{kind: '-', text: oldLines[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{kind: '+', text: newLines[j]})
+			j++
+		}
+	}
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{kind: ' ', text: text})
+	}
+	return lines
+}
+
+// splitLines splits source into lines, each keeping its line ending
+func splitLines(src []byte) []string {
+	if len(src) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(src), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numberLines returns the lines 1 to n, replacing the given lines
+func numberLines(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replace[i]; ok {
+			b.WriteString(line)
+		} else {
+			b.WriteString(strconv.Itoa(i))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "unchanged",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "missing newline at end of file",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "separate hunks",
+			a:    numberLines(12, nil),
+			b:    numberLines(12, map[int]string{2: "two", 11: "eleven"}),
+			want: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -8,5 +8,5 @@\n 8\n 9\n 10\n-11\n+eleven\n 12\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    numberLines(8, nil),
+			b:    numberLines(8, map[int]string{1: "one", 8: "eight"}),
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{
+			name: "single line",
+			a:    "z\n",
+			b:    "y\n",
+			want: "--- old\n+++ new\n@@ -1 +1 @@\n-z\n+y\n",
+		},
+		{
+			name: "all removed",
+			a:    "x\ny\n",
+			b:    "",
+			want: "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			name: "added to empty",
+			a:    "",
+			b:    "x\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1 @@\n+x\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(unifiedDiff("old", "new", []byte(test.a), []byte(test.b)))
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/EngineersBox/ModularCLI/cli"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatOptions holds the flags of the fmt command
+type formatOptions struct {
+	check     bool
+	diff      bool
+	recursive bool
+}
+
+// runFormat rewrites the schematic files at the path given to the fmt
+// command into the canonical style and returns the exit code. With -check
+// no files are written and the exit code is 3 if any file is not formatted.
+func runFormat(schematicCli *cli.CLI) int {
+	command := schematicCli.Commands["fmt"]
+	options := formatOptions{
+		check:     *command.Flags["check"].GetBool(),
+		diff:      *command.Flags["diff"].GetBool(),
+		recursive: *command.Flags["recursive"].GetBool(),
+	}
+	filenames, err := schematicFiles(*command.Params["path"].GetString(), options.recursive)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	exitCode := 0
+	for _, filename := range filenames {
+		changed, err := formatFile(filename, options)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		} else if changed && options.check && exitCode == 0 {
+			exitCode = 3
+		}
+	}
+	return exitCode
+}
+
+// schematicFiles returns the path if it is a file, otherwise the .schm files
+// in the directory, including those in subdirectories unless recursive is
+// disabled. Hidden directories are skipped.
+func schematicFiles(path string, recursive bool) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	filenames := make([]string, 0)
+	err = filepath.Walk(path, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filename != path && (!recursive || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(filename) == ".schm" {
+			filenames = append(filenames, filename)
+		}
+		return nil
+	})
+	return filenames, err
+}
+
+// formatFile formats a single file, printing its name if it is not already
+// formatted along with the changes when -diff is given. Files with syntax
+// errors are reported and left as is.
+func formatFile(filename string, options formatOptions) (bool, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false, err
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	p := parser.NewParser(bytes.NewReader(src))
+	p.SetFilename(filename)
+	file, err := p.ParseFile()
+	if err != nil {
+		writeDiagnostics(err, map[string][]byte{filename: src})
+		return false, fmt.Errorf("%s: cannot format a file with syntax errors", filename)
+	}
+	ast.Format(file)
+	formatted := ast.Bytes(file)
+	if bytes.Equal(src, formatted) {
+		return false, nil
+	}
+	fmt.Println(filename)
+	if options.diff {
+		os.Stdout.Write(unifiedDiff(
+			filepath.ToSlash(filepath.Join("old", filename)),
+			filepath.ToSlash(filepath.Join("new", filename)),
+			src,
+			formatted,
+		))
+	}
+	if options.check {
+		return true, nil
+	}
+	return true, ioutil.WriteFile(filename, formatted, info.Mode())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSchematicFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.schm", "notes.txt", "sub/a.schm", "sub/deeper/b.schm", ".hidden/c.schm"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name      string
+		path      string
+		recursive bool
+		want      []string
+	}{
+		{
+			name:      "recursive",
+			path:      dir,
+			recursive: true,
+			want:      []string{"main.schm", "sub/a.schm", "sub/deeper/b.schm"},
+		},
+		{
+			name: "not recursive",
+			path: dir,
+			want: []string{"main.schm"},
+		},
+		{
+			name:      "file",
+			path:      filepath.Join(dir, "sub", "a.schm"),
+			recursive: true,
+			want:      []string{"sub/a.schm"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filenames, err := schematicFiles(test.path, test.recursive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(filenames))
+			for _, filename := range filenames {
+				rel, err := filepath.Rel(dir, filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		options formatOptions
+		changed bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "formatted",
+			src:     "variable \"a\" = 1\n",
+			changed: false,
+			want:    "variable \"a\" = 1\n",
+		},
+		{
+			name:    "rewritten",
+			src:     "variable  \"a\"=1",
+			changed: true,
+			want:    "variable \"a\" = 1\n",
+		},
+		{
+			name:    "check leaves the file",
+			src:     "variable  \"a\"=1",
+			options: formatOptions{check: true},
+			changed: true,
+			want:    "variable  \"a\"=1",
+		},
+		{
+			name:    "syntax error",
+			src:     "variable \"a\" = ",
+			want:    "variable \"a\" = ",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "main.schm")
+			if err := ioutil.WriteFile(filename, []byte(test.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// The file name and diagnostics are printed
+			devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer devNull.Close()
+			stdout, stderr := os.Stdout, os.Stderr
+			os.Stdout, os.Stderr = devNull, devNull
+			changed, err := formatFile(filename, test.options)
+			os.Stdout, os.Stderr = stdout, stderr
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if changed != test.changed {
+				t.Errorf("got changed %v, want %v", changed, test.changed)
+			}
+			got, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
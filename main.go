@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"github.com/EngineersBox/ModularCLI/cli"
 	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
 	"github.com/EngineersBox/Schematic/parser"
 	"github.com/EngineersBox/Schematic/providers"
 	"github.com/EngineersBox/Schematic/schema"
+	"github.com/EngineersBox/Schematic/state"
 	"log"
 	"os"
-	"strings"
+	"path/filepath"
 )
 
 var CapsuleConfig = &schema.Instance{
@@ -38,22 +40,22 @@ var CapsuleConfig = &schema.Instance{
 				"pidsMax": {
 					Type:     schematic.TypeInt,
 					Computed: false,
-					Required: false,
+					Optional: true,
 				},
 				"memMax": {
 					Type:     schematic.TypeInt,
 					Computed: false,
-					Required: false,
+					Optional: true,
 				},
 				"netClsId": {
 					Type:     schematic.TypeInt,
 					Computed: false,
-					Required: false,
+					Optional: true,
 				},
 				"terminateOnClose": {
 					Type:     schematic.TypeBool,
 					Computed: false,
-					Required: false,
+					Optional: true,
 				},
 			},
 		},
@@ -81,15 +83,10 @@ var commands = map[string]cli.SubCommand{
 		},
 		Parameters: []*cli.Parameter{
 			{
-				Type:     cli.TypeString,
-				Name:     "schm",
-				Position: 0,
-				ValidateFunc: func(arg cli.Parameter) error {
-					if !strings.Contains(*arg.GetString(), ".schm") {
-						return fmt.Errorf("filetype must be .sch")
-					}
-					return nil
-				},
+				Type:         cli.TypeString,
+				Name:         "schm",
+				Position:     0,
+				ValidateFunc: validateConfigPath,
 			},
 		},
 	},
@@ -104,20 +101,73 @@ var commands = map[string]cli.SubCommand{
 				Required:     false,
 			},
 		},
+		Parameters: []*cli.Parameter{
+			{
+				Type:         cli.TypeString,
+				Name:         "schm",
+				Position:     0,
+				ValidateFunc: validateConfigPath,
+			},
+		},
+	},
+	"validate": {
+		ErrorHandler: flag.ExitOnError,
+		Flags:        nil,
+		Parameters: []*cli.Parameter{
+			{
+				Type:         cli.TypeString,
+				Name:         "schm",
+				Position:     0,
+				ValidateFunc: validateConfigPath,
+			},
+		},
+	},
+	"fmt": {
+		ErrorHandler: flag.ExitOnError,
+		Flags: []*cli.Flag{
+			{
+				Type:         cli.TypeBool,
+				Name:         "check",
+				DefaultValue: false,
+				HelpMsg:      "Whether to only check that files are formatted, exiting with status 3 if not",
+				Required:     false,
+			},
+			{
+				Type:         cli.TypeBool,
+				Name:         "diff",
+				DefaultValue: false,
+				HelpMsg:      "Whether to show diff for formatting changes",
+				Required:     false,
+			},
+			{
+				Type:         cli.TypeBool,
+				Name:         "recursive",
+				DefaultValue: true,
+				HelpMsg:      "Whether to also format files in subdirectories, disable with -recursive=false [default: true]",
+				Required:     false,
+			},
+		},
 		Parameters: []*cli.Parameter{
 			{
 				Type:     cli.TypeString,
-				Name:     "schm",
+				Name:     "path",
 				Position: 0,
-				ValidateFunc: func(arg cli.Parameter) error {
-					if !strings.Contains(*arg.GetString(), ".schm") {
-						return fmt.Errorf("filetype must be .schm")
-					}
-					return nil
-				},
 			},
 		},
 	},
+	"output": {
+		ErrorHandler: flag.ExitOnError,
+		Flags: []*cli.Flag{
+			{
+				Type:         cli.TypeBool,
+				Name:         "json",
+				DefaultValue: false,
+				HelpMsg:      "Whether to output values as JSON, sensitive values are null unless the output is named",
+				Required:     false,
+			},
+		},
+		Parameters: nil,
+	},
 	"install": {
 		ErrorHandler: flag.ExitOnError,
 		Flags:        nil,
@@ -148,6 +198,19 @@ var (
 	}
 )
 
+// validateConfigPath checks the configuration path is either a directory or
+// a .schm file
+func validateConfigPath(arg cli.Parameter) error {
+	path := *arg.GetString()
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	if filepath.Ext(path) != ".schm" {
+		return fmt.Errorf("must be a directory or a file with the .schm filetype: %s", path)
+	}
+	return nil
+}
+
 func createDirIfNotExists(path string, mode os.FileMode) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return os.Mkdir(path, mode)
@@ -155,10 +218,28 @@ func createDirIfNotExists(path string, mode os.FileMode) error {
 	return nil
 }
 
+// writeDiagnostics renders parse errors to stderr, with a snippet of the
+// source they refer to when it is one of the given files.
+func writeDiagnostics(err error, files map[string][]byte) {
+	diags, ok := err.(diagnostics.Diagnostics)
+	if !ok {
+		log.Fatal(err)
+	}
+	err = diagnostics.NewWriter(os.Stderr, files, isTerminal(os.Stderr)).WriteDiagnostics(diags)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func main() {
-	providers.InstalledProviders["capsule"] = &providers.Provider{}
-	providers.InstalledProviders["capsule"].InstancesMap = make(map[string]*schema.Instance)
-	providers.InstalledProviders["capsule"].InstancesMap["config"] = CapsuleConfig
+	err := providers.Register("capsule", &providers.Provider{
+		InstancesMap: map[string]*schema.Instance{
+			"config": CapsuleConfig,
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	schemaReferences["capsule::config"] = *CapsuleConfig
 
@@ -166,45 +247,52 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	registerVariableFlags(schematicCli)
 	err = schematicCli.Parse()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	f, err := os.Open(*schematicCli.Commands["plan"].Params["schm"].GetString())
-	if err != nil {
-		panic(err)
+	command := os.Args[1]
+	if command == "fmt" {
+		os.Exit(runFormat(schematicCli))
+	} else if command == "output" {
+		os.Exit(runOutput(schematicCli))
 	}
-
-	p := parser.NewParser(f)
-	ps, err := p.Parse()
+	overrides, err := collectVariableOverrides(command)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
-
-	newVar := ps.Variables["testcapsule_clsid"]
-	if newVar.BaseType == schematic.TypeFloat || newVar.BaseType == schematic.TypeInt {
-		fmt.Println(newVar.Value.AsBigFloat())
-	} else if newVar.BaseType == schematic.TypeString {
-		fmt.Println(newVar.Value.AsString())
+	p := parser.NewParser(nil)
+	p.SetVariableOverrides(overrides)
+	if isTerminal(os.Stdin) {
+		p.SetVariablePrompt(promptVariable)
 	}
-
-	value, err := ps.Instances["test_capsule"].GetFromNesting([]string{"config", "netClsId"})
+	ps, sources, err := p.ParseConfig(*schematicCli.Commands[command].Params["schm"].GetString())
 	if err != nil {
-		log.Fatal(err)
+		writeDiagnostics(err, sources)
+		os.Exit(1)
 	}
-	fmt.Printf("test_capsule->config->netClsId: %s\n", value)
-
-	value, err = ps.Instances["test_capsule"].GetFromNesting([]string{"containerId"})
-	if err != nil {
-		log.Fatal(err)
+	if warnings := p.Warnings(); len(warnings) > 0 {
+		warnings.Sort()
+		writeDiagnostics(warnings, sources)
+	}
+	if command == "validate" {
+		fmt.Println("The configuration is valid")
+		return
+	}
+	if command == "apply" {
+		s := &state.State{
+			Filename:    stateOut,
+			ParsedState: ps,
+			Upgrader:    providers.UpgradeState,
+		}
+		if err = s.Read(); err != nil {
+			log.Fatal(err)
+		}
+		err = s.Write()
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	fmt.Printf("test_capsule->containerId: %s\n", value)
-
-	//file, _ := json.MarshalIndent(ps, "", " ")
-	//err = createDirIfNotExists(operationalDirectory, 0700)
-	//if err != nil {
-	//	panic(err)
-	//}
-	//_ = ioutil.WriteFile(stateOut, file, 0644)
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/EngineersBox/ModularCLI/cli"
+	"github.com/EngineersBox/Schematic/providers"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sensitiveOutput is displayed in place of the value of a sensitive output
+const sensitiveOutput = "<sensitive>"
+
+// runOutput prints the outputs of the root configuration from the state
+// file and returns the exit code. The name of an output is an optional
+// parameter, which cli.Parameter does not support, so it is read from the
+// arguments left after parsing flags.
+func runOutput(schematicCli *cli.CLI) int {
+	command := schematicCli.Commands["output"]
+	args := command.FlagSet.Args()
+	if len(args) > 0 {
+		// Flags given after the name
+		if err := command.FlagSet.Parse(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(command.FlagSet.Args()) > 0 {
+			fmt.Fprintf(os.Stderr, "unexpected argument: %s\n", command.FlagSet.Args()[0])
+			return 1
+		}
+	}
+	asJSON := *command.Flags["json"].GetBool()
+
+	schmState, err := state.ReadJSONSchmState(stateOut, providers.UpgradeState)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "no state file found at %s, outputs are stored by apply\n", stateOut)
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err = providers.DecodeState(schmState); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	outputs := rootOutputs(schmState)
+
+	if len(args) > 0 {
+		output, ok := outputs[args[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "no such output: %s\n", args[0])
+			return 1
+		}
+		if asJSON {
+			return printJSON(ctyjson.Marshal(output.Value, output.Value.Type()))
+		}
+		fmt.Println(formatOutputValue(output.Value, ""))
+		return 0
+	}
+
+	if asJSON {
+		redacted := make(map[string]*state.Output, len(outputs))
+		for name, output := range outputs {
+			if output.Sensitive {
+				output = &state.Output{
+					Name:        output.Name,
+					Value:       cty.NullVal(output.Value.Type()),
+					Sensitive:   true,
+					Description: output.Description,
+				}
+			}
+			redacted[name] = output
+		}
+		return printJSON(json.MarshalIndent(redacted, "", "  "))
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		output := outputs[name]
+		if output.Sensitive {
+			fmt.Printf("%s = %s\n", name, sensitiveOutput)
+			continue
+		}
+		fmt.Printf("%s = %s\n", name, formatOutputValue(output.Value, ""))
+	}
+	return 0
+}
+
+// rootOutputs returns the outputs of the root configuration, the module
+// state without an address.
+func rootOutputs(schmState *state.JSONSchmState) map[string]*state.Output {
+	for _, module := range schmState.Modules {
+		if module.Address == "" && module.Outputs != nil {
+			return module.Outputs
+		}
+	}
+	return make(map[string]*state.Output)
+}
+
+func printJSON(out []byte, err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// formatOutputValue formats a value in the syntax of a schematic file, with
+// the elements of collections on their own lines.
+func formatOutputValue(value cty.Value, indent string) string {
+	if value.IsNull() {
+		return "null"
+	} else if !value.IsKnown() {
+		return "(known after apply)"
+	}
+	valueType := value.Type()
+	switch {
+	case valueType == cty.String:
+		return strconv.Quote(value.AsString())
+	case valueType == cty.Number:
+		return value.AsBigFloat().Text('f', -1)
+	case valueType == cty.Bool:
+		return strconv.FormatBool(value.True())
+	case valueType.IsListType() || valueType.IsTupleType() || valueType.IsSetType():
+		if value.LengthInt() == 0 {
+			return "[]"
+		}
+		var b strings.Builder
+		b.WriteString("[\n")
+		for it := value.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			fmt.Fprintf(&b, "%s  %s,\n", indent, formatOutputValue(elem, indent+"  "))
+		}
+		b.WriteString(indent + "]")
+		return b.String()
+	case valueType.IsMapType() || valueType.IsObjectType():
+		if value.LengthInt() == 0 {
+			return "{}"
+		}
+		var b strings.Builder
+		b.WriteString("{\n")
+		for it := value.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			fmt.Fprintf(&b, "%s  %s = %s\n", indent, key.AsString(), formatOutputValue(elem, indent+"  "))
+		}
+		b.WriteString(indent + "}")
+		return b.String()
+	}
+	return value.GoString()
+}
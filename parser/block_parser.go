@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+)
+
+// parseBlock parses the labels and body of a block following its type, in
+// either the form <TYPE> <LABEL>... { <BODY> } or the shorthand form
+// <TYPE> <LABEL>... = <E>.
+func (p *Parser) parseBlock(blockType *ast.Token) (*ast.Block, error) {
+	block := &ast.Block{Type: blockType}
+	for {
+		tok, lit := p.scanIgnoreWhitespace(false)
+		switch {
+		case isLabel(tok):
+			block.Labels = append(block.Labels, p.token())
+		case tok == OPENBRACE:
+			block.OpenBrace = p.token()
+			return block, p.parseBody(block)
+		case tok == EQUALS:
+			block.Equals = p.token()
+			value, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			block.Value = value
+			return block, nil
+		default:
+			return nil, p.errorf(
+				"Missing open brace",
+				"missing open brace or assignment operator '=' in %s declaration: %s",
+				blockType.Lit,
+				lit,
+			)
+		}
+	}
+}
+
+// parseBody parses the attributes and nested blocks of a block up to and
+// including the closing brace.
+func (p *Parser) parseBody(block *ast.Block) error {
+	for {
+		tok, field := p.scanIgnoreWhitespace(false)
+		if tok == CLOSEDBRACE {
+			block.CloseBrace = p.token()
+			return nil
+		} else if tok == EOF {
+			return p.errorf("Missing closing brace", "missing closing brace in %s declaration", block.Type.Lit)
+		} else if !isLabel(tok) {
+			return p.errorf("Invalid field", "invalid field in %s body: %s", block.Type.Lit, field)
+		}
+		name := p.token()
+		tok, lit := p.scanIgnoreWhitespace(false)
+		if tok == EQUALS {
+			attribute, err := p.parseAttribute(name)
+			if err != nil {
+				return err
+			}
+			block.Body = append(block.Body, attribute)
+			continue
+		} else if tok != OPENBRACE && !isLabel(tok) {
+			return p.errorf("Invalid assignment", "assignment must be via equals operator. Invalid assignment: %s %s", field, lit)
+		}
+		p.unscan()
+		nested, err := p.parseBlock(name)
+		if err != nil {
+			return err
+		}
+		block.Body = append(block.Body, nested)
+	}
+}
+
+// parseAttribute parses the expression assigned to an attribute following
+// its equals operator, along with an optional comma.
+func (p *Parser) parseAttribute(name *ast.Token) (*ast.Attribute, error) {
+	attribute := &ast.Attribute{Name: name, Equals: p.token()}
+	value, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	attribute.Value = value
+	if tok, _ := p.scanIgnoreWhitespace(false); tok == COMMA {
+		attribute.Comma = p.token()
+	} else {
+		p.unscan()
+	}
+	return attribute, nil
+}
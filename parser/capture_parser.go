@@ -1 +1,80 @@
 package parser
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+)
+
+const (
+	captureKeyword            = "capture"
+	captureSourceField        = "source"
+	captureHasDependencyField = "hasDependency"
+	captureHandlerField       = "handler"
+)
+
+func (p *Parser) decodeCapture(block *ast.Block, schem *state.ParsedState) (*state.Capture, error) {
+	if err := checkBlock(block, false, "name"); err != nil {
+		return nil, err
+	}
+	newCapture := &state.Capture{
+		Name:          block.Labels[0].Lit,
+		HasDependency: make([]string, 0),
+	}
+	err := p.decodeCaptureBody(block, newCapture, schem)
+	if err != nil {
+		return nil, err
+	}
+	return newCapture, nil
+}
+
+func (p *Parser) decodeCaptureBody(block *ast.Block, newCapture *state.Capture, schem *state.ParsedState) error {
+	for _, item := range block.Body {
+		attribute, ok := item.(*ast.Attribute)
+		if !ok {
+			nested := item.(*ast.Block)
+			return diagnostics.Errorf(nested.Type.Range, "Unsupported block", "capture [%s] has no block: %s", newCapture.Name, nested.Type.Lit)
+		}
+		field := attribute.Name.Lit
+		switch field {
+		case captureSourceField:
+			value, err := p.evaluateString(field, attribute.Value, schem)
+			if err != nil {
+				return err
+			}
+			newCapture.Source = value
+		case captureHandlerField:
+			value, err := p.evaluateString(field, attribute.Value, schem)
+			if err != nil {
+				return err
+			}
+			newCapture.Handler = value
+		case captureHasDependencyField:
+			dependencies, err := p.decodeDependencies(field, attribute.Value, schem)
+			if err != nil {
+				return err
+			}
+			newCapture.HasDependency = dependencies
+		default:
+			return diagnostics.Errorf(attribute.Name.Range, "Unsupported field", "capture [%s] has no field: %s", newCapture.Name, field)
+		}
+	}
+	return nil
+}
+
+// decodeDependencies evaluates an array of the names of the declarations
+// depended on.
+func (p *Parser) decodeDependencies(field string, expr ast.Expression, schem *state.ParsedState) ([]string, error) {
+	if _, ok := expr.(*ast.TupleExpr); !ok {
+		return nil, diagnostics.Errorf(expr.Range(), "Invalid dependencies", "field [%s] must be an array", field)
+	}
+	value, err := p.evaluateValue(expr, schem)
+	if err != nil {
+		return nil, err
+	}
+	dependencies, err := toStringList(field, value.([]interface{}))
+	if err != nil {
+		return nil, wrapError(err, expr.Range(), "Invalid dependencies")
+	}
+	return dependencies, nil
+}
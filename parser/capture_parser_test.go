@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCaptures(t *testing.T) {
+	tests := []struct {
+		name          string
+		src           string
+		source        string
+		handler       string
+		hasDependency []string
+	}{
+		{
+			name:          "literals",
+			src:           "capture c {\n  source = \"/var/log/app\"\n  handler = \"stdout\"\n  hasDependency = [\"a\", \"b\"]\n}\n",
+			source:        "/var/log/app",
+			handler:       "stdout",
+			hasDependency: []string{"a", "b"},
+		},
+		{
+			name:          "variable references",
+			src:           "variable dir {\n  value = \"/tmp\"\n}\nvariable id {\n  value = \"7\"\n}\ncapture c {\n  source = var.dir\n  hasDependency = [var.id]\n}\n",
+			source:        "/tmp",
+			hasDependency: []string{"7"},
+		},
+		{
+			name:          "no dependencies",
+			src:           "capture c {\n  hasDependency = []\n}\n",
+			hasDependency: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			capture, ok := schem.Captures["c"]
+			if !ok {
+				t.Fatal("capture [c] was not parsed")
+			}
+			if capture.Name != "c" || capture.Source != test.source || capture.Handler != test.handler {
+				t.Errorf("got %+v", capture)
+			}
+			if !reflect.DeepEqual(capture.HasDependency, test.hasDependency) {
+				t.Errorf("got dependencies %#v, want %#v", capture.HasDependency, test.hasDependency)
+			}
+		})
+	}
+}
+
+func TestCaptureErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "unknown field",
+			src:     "capture c {\n  target = \"x\"\n}\n",
+			summary: "Unsupported field",
+			detail:  "capture [c] has no field: target",
+		},
+		{
+			name:    "missing closing brace",
+			src:     "capture c {\n  source = \"x\"\n",
+			summary: "Missing closing brace",
+			detail:  "missing closing brace in capture declaration",
+		},
+		{
+			name:    "dependencies not an array",
+			src:     "capture c {\n  hasDependency = \"a\"\n}\n",
+			summary: "Invalid dependencies",
+			detail:  "field [hasDependency] must be an array",
+		},
+		{
+			name:    "dependency not a string",
+			src:     "capture c {\n  hasDependency = [\"a\", 7]\n}\n",
+			summary: "Invalid dependencies",
+			detail:  "field [hasDependency] must be an array of strings, invalid element: 7",
+		},
+		{
+			name:    "missing comma",
+			src:     "capture c {\n  hasDependency = [\"a\" \"b\"]\n}\n",
+			summary: "Missing comma",
+			detail:  "missing comma between array elements: b",
+		},
+		{
+			name:    "undeclared variable",
+			src:     "capture c {\n  source = var.dir\n}\n",
+			summary: "Reference to undeclared variable",
+			detail:  "no such variable: dir",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
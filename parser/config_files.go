@@ -0,0 +1,278 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	configFileExtension  = ".schm"
+	overrideFileSuffix   = "_override" + configFileExtension
+	overrideFileBaseName = "override" + configFileExtension
+)
+
+// ConfigFiles returns the files of the configuration at a path. A path to a
+// file is returned as is, for a directory the .schm files directly within it
+// are returned in lexical order with override files last.
+func ConfigFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	filenames := make([]string, 0)
+	overrides := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != configFileExtension {
+			continue
+		}
+		filename := filepath.Join(path, entry.Name())
+		if isOverrideFile(filename) {
+			overrides = append(overrides, filename)
+		} else {
+			filenames = append(filenames, filename)
+		}
+	}
+	sort.Strings(filenames)
+	sort.Strings(overrides)
+	if len(filenames)+len(overrides) == 0 {
+		return nil, fmt.Errorf("no %s files in directory: %s", configFileExtension, path)
+	}
+	return append(filenames, overrides...), nil
+}
+
+// isOverrideFile returns true if the file is named override.schm or ends in
+// _override.schm
+func isOverrideFile(filename string) bool {
+	base := filepath.Base(filename)
+	return base == overrideFileBaseName || strings.HasSuffix(base, overrideFileSuffix)
+}
+
+// ParseConfig parses the configuration at a path, either a single file or
+// a directory of files as returned by ConfigFiles.
+func (p *Parser) ParseConfig(path string) (*state.ParsedState, map[string][]byte, error) {
+	filenames, err := ConfigFiles(path)
+	if err != nil {
+		return nil, p.sources, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, p.sources, err
+	}
+	p.configPaths = append(p.configPaths, absPath)
+	schem, sources, err := p.ParseFiles(filenames)
+	if schem != nil {
+		schem.Path = path
+	}
+	return schem, sources, err
+}
+
+// ParseFiles parses each file and decodes their blocks together into one
+// ParsedState, as if they were a single file. The blocks of override files
+// are not declarations of their own, they are merged into the declaration
+// of the same name in the other files. The source of each file read is
+// returned for rendering diagnostics.
+func (p *Parser) ParseFiles(filenames []string) (*state.ParsedState, map[string][]byte, error) {
+	if p.sources == nil {
+		p.sources = make(map[string][]byte)
+	}
+	sources := p.sources
+	var diags diagnostics.Diagnostics
+	blocks := make([]*ast.Block, 0)
+	overrides := make([]*ast.Block, 0)
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, sources, err
+		}
+		sources[filename] = src
+		fileParser := NewParser(bytes.NewReader(src))
+		fileParser.SetFilename(filename)
+		file, err := fileParser.ParseFile()
+		diags = append(diags, diagnostics.FromError(err, file.Range(), "Invalid file")...)
+		if isOverrideFile(filename) {
+			overrides = append(overrides, file.Blocks...)
+		} else {
+			blocks = append(blocks, file.Blocks...)
+		}
+	}
+	diags = append(diags, mergeOverrides(blocks, overrides)...)
+	schem := newParsedState()
+	diags = append(diags, p.decodeBlocks(blocks, schem)...)
+	diags = append(diags, p.warnings...)
+	diags.Sort()
+	if diags.HasErrors() {
+		return schem, sources, diags
+	}
+	return schem, sources, nil
+}
+
+// mergeOverrides merges each override block into the block with the same
+// keyword and name, in order, so later overrides take precedence.
+func mergeOverrides(blocks []*ast.Block, overrides []*ast.Block) diagnostics.Diagnostics {
+	var diags diagnostics.Diagnostics
+	declared := make(map[string]*ast.Block)
+	for _, block := range blocks {
+		if len(block.Labels) > 0 {
+			declared[blockKey(block)] = block
+		}
+	}
+	for _, override := range overrides {
+		keyword := strings.ToLower(override.Type.Lit)
+		if keyword == localsKeyword {
+			diags = append(diags, mergeLocals(blocks, override)...)
+			continue
+		} else if len(override.Labels) == 0 {
+			diags = append(diags, diagnostics.Errorf(override.Type.Range, "Missing name", "%s override is missing a name", keyword))
+			continue
+		}
+		base, ok := declared[blockKey(override)]
+		if !ok {
+			name := override.Labels[len(override.Labels)-1]
+			diags = append(diags, diagnostics.Errorf(
+				name.Range,
+				"Missing base declaration",
+				"there is no %s [%s] to override, overrides must patch a declaration in another file",
+				keyword,
+				name.Lit,
+			))
+			continue
+		} else if !sameLabels(base, override) {
+			diags = append(diags, diagnostics.Errorf(
+				override.Labels[0].Range,
+				"Invalid override",
+				"%s [%s] override must have the same labels as its declaration at %s",
+				keyword,
+				override.Labels[len(override.Labels)-1].Lit,
+				base.Labels[0].Range,
+			))
+			continue
+		}
+		mergeBlock(base, override)
+	}
+	return diags
+}
+
+// mergeLocals replaces each local declared by a locals override with the
+// local of the same name in the other files.
+func mergeLocals(blocks []*ast.Block, override *ast.Block) diagnostics.Diagnostics {
+	var diags diagnostics.Diagnostics
+	for _, attribute := range override.Attributes() {
+		base := findLocalsBlock(blocks, attribute.Name.Lit)
+		if base == nil {
+			diags = append(diags, diagnostics.Errorf(
+				attribute.Name.Range,
+				"Missing base declaration",
+				"there is no local [%s] to override, overrides must patch a declaration in another file",
+				attribute.Name.Lit,
+			))
+			continue
+		}
+		base.Body = replaceAttribute(base.Body, attribute)
+	}
+	return diags
+}
+
+// findLocalsBlock returns the locals block declaring a local
+func findLocalsBlock(blocks []*ast.Block, name string) *ast.Block {
+	for _, block := range blocks {
+		if strings.ToLower(block.Type.Lit) != localsKeyword {
+			continue
+		}
+		for _, attribute := range block.Attributes() {
+			if attribute.Name.Lit == name {
+				return block
+			}
+		}
+	}
+	return nil
+}
+
+// blockKey identifies a block by its keyword and name, which is its last
+// label. Data blocks are also identified by their type, as data of
+// different types may share a name.
+func blockKey(block *ast.Block) string {
+	keyword := strings.ToLower(block.Type.Lit)
+	if keyword == dataKeyword {
+		labels := make([]string, len(block.Labels))
+		for i, label := range block.Labels {
+			labels[i] = label.Lit
+		}
+		return keyword + "." + strings.Join(labels, ".")
+	}
+	return keyword + "." + block.Labels[len(block.Labels)-1].Lit
+}
+
+// sameLabels returns true if both blocks have the same labels
+func sameLabels(a *ast.Block, b *ast.Block) bool {
+	if len(a.Labels) != len(b.Labels) {
+		return false
+	}
+	for i, label := range a.Labels {
+		if label.Lit != b.Labels[i].Lit {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeBlock patches a block with an override of the same labels.
+// Attributes of the override replace those of the same name, and its nested
+// blocks replace all nested blocks of the same type. A block in the
+// shorthand form is replaced as a whole, as is a block overridden by one.
+func mergeBlock(base *ast.Block, override *ast.Block) {
+	if base.Value != nil || override.Value != nil {
+		*base = *override
+		return
+	}
+	replaced := make(map[string]bool)
+	for _, item := range override.Body {
+		switch item := item.(type) {
+		case *ast.Attribute:
+			base.Body = replaceAttribute(base.Body, item)
+		case *ast.Block:
+			if !replaced[item.Type.Lit] {
+				base.Body = removeBlocks(base.Body, item.Type.Lit)
+				replaced[item.Type.Lit] = true
+			}
+			base.Body = append(base.Body, item)
+		}
+	}
+}
+
+// replaceAttribute replaces the attribute of the same name in a body, or
+// appends it if there is none.
+func replaceAttribute(body []ast.BodyItem, attribute *ast.Attribute) []ast.BodyItem {
+	for i, item := range body {
+		if existing, ok := item.(*ast.Attribute); ok && existing.Name.Lit == attribute.Name.Lit {
+			body[i] = attribute
+			return body
+		}
+	}
+	return append(body, attribute)
+}
+
+// removeBlocks removes the nested blocks of a type from a body
+func removeBlocks(body []ast.BodyItem, blockType string) []ast.BodyItem {
+	kept := make([]ast.BodyItem, 0, len(body))
+	for _, item := range body {
+		if block, ok := item.(*ast.Block); !ok || block.Type.Lit != blockType {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig writes each file to its path relative to dir
+func writeConfig(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, map[string]string{
+		"b.schm":          "",
+		"a.schm":          "",
+		"override.schm":   "",
+		"a_override.schm": "",
+		"notes.txt":       "",
+	})
+	filenames, err := ConfigFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		got = append(got, filepath.Base(filename))
+	}
+	want := []string{"a.schm", "b.schm", "a_override.schm", "override.schm"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	file := filepath.Join(dir, "b.schm")
+	if filenames, err := ConfigFiles(file); err != nil || !reflect.DeepEqual(filenames, []string{file}) {
+		t.Errorf("got %v, %v, want the file itself", filenames, err)
+	}
+	if _, err := ConfigFiles(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without .schm files")
+	}
+}
+
+// parseConfig parses the files of a configuration written to a directory
+func parseConfig(t *testing.T, files map[string]string) (map[string]cty.Value, error) {
+	t.Helper()
+	dir := t.TempDir()
+	writeConfig(t, dir, files)
+	filenames, err := ConfigFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schem, _, err := NewParser(nil).ParseFiles(filenames)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]cty.Value)
+	for name, variable := range schem.Variables {
+		values[name] = variable.Value
+	}
+	return values, nil
+}
+
+func TestParseFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string]cty.Value
+	}{
+		{
+			name: "references across files",
+			files: map[string]string{
+				"main.schm":      "capture \"c\" {\n  source = var.dir\n}\n",
+				"variables.schm": "variable \"dir\" = \"/tmp\"\n",
+			},
+			want: map[string]cty.Value{"dir": cty.StringVal("/tmp")},
+		},
+		{
+			name: "attribute override",
+			files: map[string]string{
+				"main.schm":     "variable \"a\" {\n  value = 1\n  description = \"A\"\n}\n",
+				"override.schm": "variable \"a\" {\n  value = 2\n}\n",
+			},
+			want: map[string]cty.Value{"a": cty.NumberIntVal(2)},
+		},
+		{
+			name: "later overrides take precedence",
+			files: map[string]string{
+				"main.schm":       "variable \"a\" = 1\n",
+				"a_override.schm": "variable \"a\" = 2\n",
+				"b_override.schm": "variable \"a\" = 3\n",
+			},
+			want: map[string]cty.Value{"a": cty.NumberIntVal(3)},
+		},
+		{
+			name: "shorthand replaced by a block",
+			files: map[string]string{
+				"main.schm":     "variable \"a\" = 1\n",
+				"override.schm": "variable \"a\" {\n  default = 4\n}\n",
+			},
+			want: map[string]cty.Value{"a": cty.NumberIntVal(4)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseConfig(t, test.files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got %#v, want %#v", got, test.want)
+			}
+			for name, value := range test.want {
+				if !got[name].RawEquals(value) {
+					t.Errorf("got %s = %#v, want %#v", name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilesData(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, map[string]string{
+		"main.schm": `data "file" "limits" {
+  reference = "L::file.json"
+  schema = {
+    pidsMax = 0
+  }
+}
+
+data "service" "limits" {
+  reference = "L::service.json"
+  schema = {
+    pidsMax = 0
+  }
+}
+
+output "o" {
+  value = data.file.limits.pidsMax + data.service.limits.pidsMax
+}
+`,
+		"override.schm": `data "service" "limits" {
+  reference = "L::override.json"
+}
+`,
+		"file.json":     `{"pidsMax": 1}`,
+		"service.json":  `{"pidsMax": 10}`,
+		"override.json": `{"pidsMax": 100}`,
+	})
+	schem, _, err := NewParser(nil).ParseConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := schem.Outputs["o"].Value, cty.NumberIntVal(101); !got.RawEquals(want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	if data := schem.Data["service.limits"]; data == nil || data.Reference != "L::override.json" {
+		t.Errorf("got %#v, want the overridden reference", data)
+	}
+}
+
+func TestParseFilesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		summary string
+		detail  string
+	}{
+		{
+			name: "duplicate declaration",
+			files: map[string]string{
+				"a.schm": "variable \"a\" = 1\n",
+				"b.schm": "variable \"a\" = 2\n",
+			},
+			summary: "Duplicate variable declaration",
+			detail:  "variable [a] is already declared at",
+		},
+		{
+			name: "override without a base declaration",
+			files: map[string]string{
+				"main.schm":     "variable \"a\" = 1\n",
+				"override.schm": "variable \"b\" = 2\n",
+			},
+			summary: "Missing base declaration",
+			detail:  "there is no variable [b] to override",
+		},
+		{
+			name: "override changing the instance kind",
+			files: map[string]string{
+				"main.schm":     "instance \"test::container\" \"a\" {\n  containerId = \"x\"\n}\n",
+				"override.schm": "instance \"test::service\" \"a\" {\n  replicas = 2\n}\n",
+			},
+			summary: "Invalid override",
+			detail:  "instance [a] override must have the same labels as its declaration at",
+		},
+		{
+			name: "override of data with another type",
+			files: map[string]string{
+				"main.schm":     "data \"file\" \"x\" {\n  reference = \"L::x.json\"\n}\n",
+				"override.schm": "data \"service\" \"x\" {\n  reference = \"L::y.json\"\n}\n",
+			},
+			summary: "Missing base declaration",
+			detail:  "there is no data [x] to override",
+		},
+		{
+			name: "syntax error in one file",
+			files: map[string]string{
+				"a.schm": "variable \"a\" = \n",
+				"b.schm": "variable \"b\" = 2\n",
+			},
+			summary: "Invalid expression",
+			detail:  "invalid operand in expression",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseConfig(t, test.files)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
@@ -1 +1,130 @@
 package parser
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	dataKeyword        = "data"
+	dataReferenceField = "reference"
+	dataSchemaField    = "schema"
+)
+
+var dataTypes = []string{"file", "service"}
+
+func (p *Parser) decodeData(block *ast.Block, schem *state.ParsedState) (*state.Data, error) {
+	if err := checkBlock(block, false, "type", "name"); err != nil {
+		return nil, err
+	}
+	dataType, name := block.Labels[0], block.Labels[1]
+	if !isValidDataType(dataType.Lit) {
+		return nil, diagnostics.Errorf(dataType.Range, "Invalid data type", "invalid data type, must be one of [%s]: %s", strings.Join(dataTypes, ", "), dataType.Lit)
+	}
+	newData := &state.Data{
+		Type: dataType.Lit,
+		Name: name.Lit,
+		Dir:  filepath.Dir(block.Type.Range.Filename),
+	}
+	err := p.decodeDataBody(block, newData, schem)
+	if err != nil {
+		return nil, err
+	}
+	if newData.Reference == "" {
+		return nil, diagnostics.Errorf(name.Range, "Missing reference", "data [%s] is missing a %s declaration", newData.Name, dataReferenceField)
+	}
+	return newData, nil
+}
+
+func isValidDataType(dataType string) bool {
+	for _, t := range dataTypes {
+		if t == dataType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) decodeDataBody(block *ast.Block, newData *state.Data, schem *state.ParsedState) error {
+	for _, item := range block.Body {
+		switch item := item.(type) {
+		case *ast.Block:
+			// Both "schema = {" and "schema {" are accepted
+			if item.Type.Lit != dataSchemaField || len(item.Labels) > 0 || item.Value != nil {
+				return diagnostics.Errorf(item.Type.Range, "Unsupported block", "data [%s] has no block: %s", newData.Name, item.Type.Lit)
+			}
+			attributes, err := p.decodeDataSchema(item.Attributes(), item.Range(), schem)
+			if err != nil {
+				return err
+			}
+			newData.Attributes = attributes
+		case *ast.Attribute:
+			field := item.Name.Lit
+			switch field {
+			case dataReferenceField:
+				reference, err := p.evaluateString(field, item.Value, schem)
+				if err != nil {
+					return err
+				}
+				newData.Reference = reference
+				if !newData.ValidateReference() {
+					return diagnostics.Errorf(
+						item.Value.Range(),
+						"Invalid data reference",
+						"invalid data reference, must be of the form <L | W>::<SOURCE>: %s",
+						reference,
+					)
+				}
+			case dataSchemaField:
+				object, ok := item.Value.(*ast.ObjectExpr)
+				if !ok {
+					return diagnostics.Errorf(item.Value.Range(), "Invalid value", "data field [%s] must be a block", field)
+				}
+				attributes, err := p.decodeDataSchema(object.Attributes, object.Range(), schem)
+				if err != nil {
+					return err
+				}
+				newData.Attributes = attributes
+			default:
+				return diagnostics.Errorf(item.Name.Range, "Unsupported field", "data [%s] has no field: %s", newData.Name, field)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeDataSchema evaluates the attributes of a data schema block
+func (p *Parser) decodeDataSchema(attributes []*ast.Attribute, rng diagnostics.Range, schem *state.ParsedState) (map[string]interface{}, error) {
+	object, err := p.decodeObject(attributes, rng)
+	if err != nil {
+		return nil, err
+	}
+	value, err := object.Value(p.newEvalContext(schem))
+	if err != nil {
+		return nil, wrapError(err, rng, "Invalid expression")
+	}
+	result, err := fromCtyValue(value)
+	if err != nil {
+		return nil, wrapError(err, rng, "Invalid value")
+	}
+	return result.(map[string]interface{}), nil
+}
+
+// resolveDataReference retrieves the value of an attribute referenced in the
+// form data.<TYPE>.<NAME>.<ATTRIBUTE>[.<ATTRIBUTE>]
+func resolveDataReference(lit string, schem *state.ParsedState) (interface{}, error) {
+	reference := strings.Split(strings.TrimPrefix(lit, dataReferencePrefix), ".")
+	if len(reference) < 3 {
+		return nil, fmt.Errorf("invalid data reference, must be of the form data.<TYPE>.<NAME>.<ATTRIBUTE>: %s", lit)
+	}
+	dataType, name, nesting := reference[0], reference[1], reference[2:]
+	data, ok := schem.Data[dataType+"."+name]
+	if !ok {
+		return nil, fmt.Errorf("no such data declaration: %s.%s", dataType, name)
+	}
+	return data.GetAttributeNesting(nesting)
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestData(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		dataType   string
+		reference  string
+		attributes map[string]interface{}
+	}{
+		{
+			name:      "local reference",
+			src:       "data file limits {\n  reference = \"L::limits.json\"\n}\n",
+			dataType:  "file",
+			reference: "L::limits.json",
+		},
+		{
+			name:       "web reference with a schema",
+			src:        "data service limits {\n  reference = \"W::https://example.com/limits\"\n  schema = {\n    pidsMax = 20\n  }\n}\n",
+			dataType:   "service",
+			reference:  "W::https://example.com/limits",
+			attributes: map[string]interface{}{"pidsMax": 20},
+		},
+		{
+			name:       "nested schema",
+			src:        "data file limits {\n  reference = \"L::limits.json\"\n  schema {\n    config = {\n      memMax = 4096\n    }\n  }\n}\n",
+			dataType:   "file",
+			reference:  "L::limits.json",
+			attributes: map[string]interface{}{"config": map[string]interface{}{"memMax": 4096}},
+		},
+		{
+			name:      "reference from a variable",
+			src:       "variable source {\n  value = \"L::limits.json\"\n}\ndata file limits {\n  reference = var.source\n}\n",
+			dataType:  "file",
+			reference: "L::limits.json",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, ok := schem.Data[test.dataType+".limits"]
+			if !ok {
+				t.Fatal("data [limits] was not parsed")
+			}
+			if data.Name != "limits" || data.Type != test.dataType || data.Reference != test.reference {
+				t.Errorf("got %+v", data)
+			}
+			if !reflect.DeepEqual(data.Attributes, test.attributes) {
+				t.Errorf("got schema %#v, want %#v", data.Attributes, test.attributes)
+			}
+		})
+	}
+}
+
+func TestDataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "invalid type",
+			src:     "data http limits {\n  reference = \"L::limits.json\"\n}\n",
+			summary: "Invalid data type",
+			detail:  "invalid data type, must be one of [file, service]: http",
+		},
+		{
+			name:    "missing reference",
+			src:     "data file limits {\n}\n",
+			summary: "Missing reference",
+			detail:  "data [limits] is missing a reference declaration",
+		},
+		{
+			name:    "invalid reference",
+			src:     "data file limits {\n  reference = \"limits.json\"\n}\n",
+			summary: "Invalid data reference",
+			detail:  "invalid data reference, must be of the form <L | W>::<SOURCE>: limits.json",
+		},
+		{
+			name:    "unknown field",
+			src:     "data file limits {\n  source = \"L::limits.json\"\n}\n",
+			summary: "Unsupported field",
+			detail:  "data [limits] has no field: source",
+		},
+		{
+			name:    "schema not a block",
+			src:     "data file limits {\n  reference = \"L::limits.json\"\n  schema = 1\n}\n",
+			summary: "Invalid value",
+			detail:  "data field [schema] must be a block",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
+
+func TestDataReferences(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "limits.json")
+	if err := ioutil.WriteFile(filename, []byte(`{"id": "from_file", "pidsMax": 30, "config": {"memMax": 4096}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data := "data file limits {\n  reference = \"L::" + filename + "\"\n  schema = {\n    id = \"\"\n    pidsMax = 0\n    memMax = 2048\n    config = {\n      memMax = 0\n    }\n  }\n}\n"
+	tests := []struct {
+		name    string
+		value   string
+		nesting []string
+		want    interface{}
+	}{
+		{
+			name:    "string",
+			value:   "data.file.limits.id",
+			nesting: []string{"containerId"},
+			want:    "from_file",
+		},
+		{
+			name:    "number",
+			value:   "data.file.limits.pidsMax",
+			nesting: []string{"containerId"},
+			want:    "30",
+		},
+		{
+			name:    "nested attribute",
+			value:   "data.file.limits.config.memMax",
+			nesting: []string{"containerId"},
+			want:    "4096",
+		},
+		{
+			name:    "declared value when missing from the source",
+			value:   "data.file.limits.memMax",
+			nesting: []string{"containerId"},
+			want:    "2048",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := data + "instance \"test::container\" \"x\" {\n  containerId = " + test.value + "\n}\n"
+			schem, err := NewParser(strings.NewReader(src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := schem.Instances["x"].GetFromNesting(test.nesting)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDataReferencedBeforeDeclared(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "limits.json")
+	if err := ioutil.WriteFile(filename, []byte(`{"id": "from_file"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := "instance \"test::container\" \"x\" {\n  containerId = data.file.limits.id\n}\n" +
+		"data file limits {\n  reference = \"L::" + filename + "\"\n  schema = {\n    id = \"\"\n  }\n}\n"
+	schem, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := schem.Instances["x"].GetFromNesting([]string{"containerId"}); err != nil || got != "from_file" {
+		t.Errorf("got %#v, %v, want \"from_file\"", got, err)
+	}
+}
+
+func TestDataReferenceErrors(t *testing.T) {
+	data := "data file limits {\n  reference = \"L::missing.json\"\n  schema = {\n    pidsMax = 0\n  }\n}\n"
+	tests := []struct {
+		name    string
+		value   string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "no attribute",
+			value:   "data.file.limits",
+			summary: "Invalid data reference",
+			detail:  "invalid data reference, must be of the form data.<TYPE>.<NAME>.<ATTRIBUTE>: data.file.limits",
+		},
+		{
+			name:    "undeclared data",
+			value:   "data.file.other.pidsMax",
+			summary: "Invalid data reference",
+			detail:  "no such data declaration: file.other",
+		},
+		{
+			name:    "wrong type",
+			value:   "data.service.limits.pidsMax",
+			summary: "Invalid data reference",
+			detail:  "no such data declaration: service.limits",
+		},
+		{
+			name:    "not in the schema",
+			value:   "data.file.limits.memMax",
+			summary: "Invalid data reference",
+			detail:  "data [limits] has no schema field memMax: no such field: memMax",
+		},
+		{
+			name:    "missing source",
+			value:   "data.file.limits.pidsMax",
+			summary: "Invalid data reference",
+			detail:  "could not read data [limits] source: open missing.json: no such file or directory",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := data + "instance \"test::container\" \"x\" {\n  containerId = " + test.value + "\n}\n"
+			_, err := NewParser(strings.NewReader(src)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,958 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"strconv"
+	"strings"
+)
+
+// Expression is a parsed expression that can be evaluated into a value.
+type Expression interface {
+	Value(ctx *EvalContext) (cty.Value, error)
+	Range() diagnostics.Range
+	String() string
+}
+
+// EvalContext holds the values that references within an expression are
+// resolved against.
+type EvalContext struct {
+	Variables map[string]cty.Value
+	Locals    map[string]cty.Value
+	// State holds the data, instance and module declarations parsed so far
+	State *state.ParsedState
+	// Iterators holds the values of the symbols declared by template for
+	// directives
+	Iterators map[string]cty.Value
+
+	// locals evaluates the locals missing from Locals when referenced
+	locals *localScope
+	// blocks decodes the declarations missing from State when referenced
+	blocks *blockScope
+	// sensitive is set when a sensitive variable, local or module output is
+	// referenced, it is shared by the copies of a context
+	sensitive *bool
+}
+
+// newEvalContext returns an EvalContext for the declarations parsed so far
+func (p *Parser) newEvalContext(schem *state.ParsedState) *EvalContext {
+	variables := make(map[string]cty.Value, len(schem.Variables))
+	for name, variable := range schem.Variables {
+		variables[name] = variable.Value
+	}
+	ctx := &EvalContext{
+		Variables: variables,
+		State:     schem,
+	}
+	if p.locals != nil {
+		ctx.Locals = p.locals.values
+		ctx.locals = p.locals
+	}
+	ctx.blocks = p.blocks
+	return ctx
+}
+
+// markSensitive records that the expression references a sensitive value
+func (ctx *EvalContext) markSensitive() {
+	if ctx.sensitive != nil {
+		*ctx.sensitive = true
+	}
+}
+
+// resolve decodes the referenced declaration if it has not been decoded yet
+func (ctx *EvalContext) resolve(keyword string, name string, rng diagnostics.Range) error {
+	if ctx.blocks == nil {
+		return nil
+	}
+	return ctx.blocks.resolve(keyword, name, rng)
+}
+
+// withIterators returns a copy of the context with the given iterator values
+// added to those already in scope.
+func (ctx *EvalContext) withIterators(values map[string]cty.Value) *EvalContext {
+	iterators := make(map[string]cty.Value, len(ctx.Iterators)+len(values))
+	for name, value := range ctx.Iterators {
+		iterators[name] = value
+	}
+	for name, value := range values {
+		iterators[name] = value
+	}
+	return &EvalContext{
+		Variables: ctx.Variables,
+		Locals:    ctx.Locals,
+		State:     ctx.State,
+		Iterators: iterators,
+		locals:    ctx.locals,
+		blocks:    ctx.blocks,
+		sensitive: ctx.sensitive,
+	}
+}
+
+type binaryOperator struct {
+	precedence int
+	symbol     string
+	function   function.Function
+}
+
+// binaryOperators maps each operator token to its precedence, a higher
+// precedence binds more tightly.
+var binaryOperators = map[Token]binaryOperator{
+	OR:      {precedence: 1, symbol: "||", function: stdlib.OrFunc},
+	AND:     {precedence: 2, symbol: "&&", function: stdlib.AndFunc},
+	EQ:      {precedence: 3, symbol: "==", function: stdlib.EqualFunc},
+	NEQ:     {precedence: 3, symbol: "!=", function: stdlib.NotEqualFunc},
+	LT:      {precedence: 4, symbol: "<", function: stdlib.LessThanFunc},
+	LTE:     {precedence: 4, symbol: "<=", function: stdlib.LessThanOrEqualToFunc},
+	GT:      {precedence: 4, symbol: ">", function: stdlib.GreaterThanFunc},
+	GTE:     {precedence: 4, symbol: ">=", function: stdlib.GreaterThanOrEqualToFunc},
+	PLUS:    {precedence: 5, symbol: "+", function: stdlib.AddFunc},
+	MINUS:   {precedence: 5, symbol: "-", function: stdlib.SubtractFunc},
+	STAR:    {precedence: 6, symbol: "*", function: stdlib.MultiplyFunc},
+	SLASH:   {precedence: 6, symbol: "/", function: stdlib.DivideFunc},
+	PERCENT: {precedence: 6, symbol: "%", function: stdlib.ModuloFunc},
+}
+
+type literalExpr struct {
+	val cty.Value
+	lit string
+	rng diagnostics.Range
+}
+
+func (e *literalExpr) Value(*EvalContext) (cty.Value, error) { return e.val, nil }
+
+func (e *literalExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *literalExpr) String() string {
+	if e.val.Type() == cty.String {
+		return strconv.Quote(e.lit)
+	}
+	return e.lit
+}
+
+type variableExpr struct {
+	name string
+	rng  diagnostics.Range
+}
+
+func (e *variableExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	val, ok := ctx.Variables[e.name]
+	if !ok {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Reference to undeclared variable", "no such variable: %s", e.name)
+	}
+	if val.IsNull() {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Missing variable value", "variable [%s] has no value", e.name)
+	}
+	if ctx.State != nil && ctx.State.Variables[e.name] != nil && ctx.State.Variables[e.name].Sensitive {
+		ctx.markSensitive()
+	}
+	return val, nil
+}
+
+func (e *variableExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *variableExpr) String() string { return variableReferencePrefix + e.name }
+
+type dataExpr struct {
+	reference string
+	rng       diagnostics.Range
+}
+
+func (e *dataExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	if ctx.State == nil {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Invalid reference", "data references are not permitted here: %s", e.reference)
+	}
+	reference := strings.Split(strings.TrimPrefix(e.reference, dataReferencePrefix), ".")
+	if len(reference) > 1 {
+		if err := ctx.resolve(dataKeyword, reference[0]+"."+reference[1], e.rng); err != nil {
+			return cty.NilVal, err
+		}
+	}
+	value, err := resolveDataReference(e.reference, ctx.State)
+	if err != nil {
+		return cty.NilVal, wrapError(err, e.rng, "Invalid data reference")
+	}
+	return toCtyValue(value), nil
+}
+
+func (e *dataExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *dataExpr) String() string { return e.reference }
+
+type instanceExpr struct {
+	reference string
+	rng       diagnostics.Range
+}
+
+func (e *instanceExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	if ctx.State == nil {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Invalid reference", "instance references are not permitted here: %s", e.reference)
+	}
+	reference := strings.Split(strings.TrimPrefix(e.reference, instanceReferencePrefix), ".")
+	if len(reference) < 2 {
+		return cty.NilVal, diagnostics.Errorf(
+			e.rng,
+			"Invalid instance reference",
+			"invalid instance reference, must be of the form instance.<NAME>.<ATTRIBUTE>: %s",
+			e.reference,
+		)
+	}
+	if err := ctx.resolve(instanceKeyword, reference[0], e.rng); err != nil {
+		return cty.NilVal, err
+	}
+	instance, ok := ctx.State.Instances[reference[0]]
+	if !ok {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Reference to undeclared instance", "no such instance: %s", reference[0])
+	}
+	value, err := instanceAttribute(instance.Value(), reference[1:])
+	if err != nil {
+		return cty.NilVal, wrapError(err, e.rng, "Invalid instance reference")
+	}
+	return value, nil
+}
+
+// instanceAttribute returns the attribute of the value of an instance at the
+// given nesting. Fields that are not set are null, and fields computed by
+// the provider are unknown until the instance is applied.
+func instanceAttribute(value cty.Value, nesting []string) (cty.Value, error) {
+	for _, name := range nesting {
+		ty := value.Type()
+		switch {
+		case !value.IsKnown():
+			return cty.UnknownVal(cty.DynamicPseudoType), nil
+		case value.IsNull():
+			return cty.NilVal, fmt.Errorf("no such field: %s", name)
+		case ty.IsObjectType() && ty.HasAttribute(name):
+			value = value.GetAttr(name)
+		case ty.IsMapType() && value.HasIndex(cty.StringVal(name)).True():
+			value = value.Index(cty.StringVal(name))
+		default:
+			return cty.NilVal, fmt.Errorf("no such field: %s", name)
+		}
+	}
+	return value, nil
+}
+
+func (e *instanceExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *instanceExpr) String() string { return e.reference }
+
+type localExpr struct {
+	name string
+	rng  diagnostics.Range
+}
+
+func (e *localExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	val, ok := ctx.Locals[e.name]
+	if !ok && ctx.locals != nil {
+		var err error
+		if val, err = ctx.locals.resolve(e.name, e.rng); err != nil {
+			return cty.NilVal, err
+		}
+	} else if !ok {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Reference to undeclared local", "no such local: %s", e.name)
+	}
+	if ctx.locals != nil && ctx.locals.sensitive[e.name] {
+		ctx.markSensitive()
+	}
+	return val, nil
+}
+
+func (e *localExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *localExpr) String() string { return localReferencePrefix + e.name }
+
+type moduleExpr struct {
+	reference string
+	rng       diagnostics.Range
+}
+
+func (e *moduleExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	if ctx.State == nil {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Invalid reference", "module references are not permitted here: %s", e.reference)
+	}
+	reference := strings.Split(strings.TrimPrefix(e.reference, moduleReferencePrefix), ".")
+	if len(reference) < 2 {
+		return cty.NilVal, diagnostics.Errorf(
+			e.rng,
+			"Invalid module reference",
+			"invalid module reference, must be of the form module.<NAME>.<OUTPUT>: %s",
+			e.reference,
+		)
+	}
+	if err := ctx.resolve(moduleKeyword, reference[0], e.rng); err != nil {
+		return cty.NilVal, err
+	}
+	module, ok := ctx.State.Modules[reference[0]]
+	if !ok {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Reference to undeclared module", "no such module: %s", reference[0])
+	}
+	output, ok := module.ParsedState.Outputs[reference[1]]
+	if !ok {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Reference to undeclared output", "module [%s] has no output: %s", module.Name, reference[1])
+	}
+	if output.Sensitive {
+		ctx.markSensitive()
+	}
+	var expr Expression = &literalExpr{val: output.Value, rng: e.rng}
+	for _, attribute := range reference[2:] {
+		expr = &getAttrExpr{collection: expr, name: attribute, rng: e.rng}
+	}
+	return expr.Value(ctx)
+}
+
+func (e *moduleExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *moduleExpr) String() string { return e.reference }
+
+// unknownReferenceExpr is an identifier that is neither a keyword nor a
+// reference, such as a misspelled reference like vars.x
+type unknownReferenceExpr struct {
+	reference string
+	rng       diagnostics.Range
+}
+
+func (e *unknownReferenceExpr) Value(*EvalContext) (cty.Value, error) {
+	return cty.NilVal, diagnostics.Errorf(
+		e.rng,
+		"Unknown reference",
+		"unknown reference, must be var.<NAME>, local.<NAME>, data.<TYPE>.<NAME>, instance.<NAME>, module.<NAME> or a quoted string: %s",
+		e.reference,
+	)
+}
+
+func (e *unknownReferenceExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *unknownReferenceExpr) String() string { return e.reference }
+
+type iteratorExpr struct {
+	name string
+	rng  diagnostics.Range
+}
+
+func (e *iteratorExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	val, ok := ctx.Iterators[e.name]
+	if !ok {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Reference to undeclared symbol", "no such symbol: %s", e.name)
+	}
+	return val, nil
+}
+
+func (e *iteratorExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *iteratorExpr) String() string { return e.name }
+
+type tupleExpr struct {
+	elems []Expression
+	rng   diagnostics.Range
+}
+
+func (e *tupleExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	if len(e.elems) == 0 {
+		return cty.EmptyTupleVal, nil
+	}
+	elems := make([]cty.Value, len(e.elems))
+	for i, elem := range e.elems {
+		val, err := elem.Value(ctx)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		elems[i] = val
+	}
+	return cty.TupleVal(elems), nil
+}
+
+func (e *tupleExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *tupleExpr) String() string {
+	elems := make([]string, len(e.elems))
+	for i, elem := range e.elems {
+		elems[i] = elem.String()
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+type objectExpr struct {
+	keys  []string
+	elems []Expression
+	rng   diagnostics.Range
+}
+
+func (e *objectExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	if len(e.elems) == 0 {
+		return cty.EmptyObjectVal, nil
+	}
+	attributes := make(map[string]cty.Value, len(e.elems))
+	for i, elem := range e.elems {
+		val, err := elem.Value(ctx)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		attributes[e.keys[i]] = val
+	}
+	return cty.ObjectVal(attributes), nil
+}
+
+func (e *objectExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *objectExpr) String() string {
+	elems := make([]string, len(e.elems))
+	for i, elem := range e.elems {
+		elems[i] = e.keys[i] + " = " + elem.String()
+	}
+	return "{" + strings.Join(elems, ", ") + "}"
+}
+
+type indexExpr struct {
+	collection Expression
+	key        Expression
+	rng        diagnostics.Range
+}
+
+func (e *indexExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	collection, err := e.collection.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	key, err := e.key.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return index(collection, key, e.rng)
+}
+
+func (e *indexExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *indexExpr) String() string { return e.collection.String() + "[" + e.key.String() + "]" }
+
+type getAttrExpr struct {
+	collection Expression
+	name       string
+	rng        diagnostics.Range
+}
+
+func (e *getAttrExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	collection, err := e.collection.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return index(collection, cty.StringVal(e.name), e.rng)
+}
+
+func (e *getAttrExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *getAttrExpr) String() string { return e.collection.String() + "." + e.name }
+
+// index returns the element of a collection at the given key. Arrays are
+// indexed by number, blocks by string.
+func index(collection cty.Value, key cty.Value, rng diagnostics.Range) (cty.Value, error) {
+	if collection.IsNull() {
+		return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "cannot index a null value")
+	} else if key.IsNull() {
+		return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "index must not be null")
+	}
+	ty := collection.Type()
+	switch {
+	case ty.IsObjectType():
+		name, err := convert.Convert(key, cty.String)
+		if err != nil {
+			return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "block index must be a string")
+		}
+		if !ty.HasAttribute(name.AsString()) {
+			return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "block has no attribute: %s", name.AsString())
+		}
+		return collection.GetAttr(name.AsString()), nil
+	case ty.IsMapType():
+		name, err := convert.Convert(key, cty.String)
+		if err != nil {
+			return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "block index must be a string")
+		}
+		if !collection.HasIndex(name).True() {
+			return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "block has no attribute: %s", name.AsString())
+		}
+		return collection.Index(name), nil
+	case ty.IsListType() || ty.IsTupleType():
+		number, err := convert.Convert(key, cty.Number)
+		if err != nil || !number.AsBigFloat().IsInt() {
+			return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "array index must be a whole number")
+		}
+		if !collection.HasIndex(number).True() {
+			return cty.NilVal, diagnostics.Errorf(
+				rng,
+				"Invalid index",
+				"array index %s is out of range for an array of length %d",
+				number.AsBigFloat().String(),
+				collection.LengthInt(),
+			)
+		}
+		return collection.Index(number), nil
+	}
+	return cty.NilVal, diagnostics.Errorf(rng, "Invalid index", "cannot index %s", ty.FriendlyName())
+}
+
+type notExpr struct {
+	operand Expression
+	rng     diagnostics.Range
+}
+
+func (e *notExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	val, err := e.operand.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	result, err := stdlib.Not(val)
+	if err != nil {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Invalid operand", "invalid operand for !: %s", err.Error())
+	}
+	return result, nil
+}
+
+func (e *notExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *notExpr) String() string { return "!" + e.operand.String() }
+
+type parenExpr struct {
+	expr Expression
+	rng  diagnostics.Range
+}
+
+func (e *parenExpr) Value(ctx *EvalContext) (cty.Value, error) { return e.expr.Value(ctx) }
+
+func (e *parenExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *parenExpr) String() string { return "(" + e.expr.String() + ")" }
+
+type negateExpr struct {
+	operand Expression
+	rng     diagnostics.Range
+}
+
+func (e *negateExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	val, err := e.operand.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	result, err := stdlib.Negate(val)
+	if err != nil {
+		return cty.NilVal, diagnostics.Errorf(e.rng, "Invalid operand", "invalid operand for -: %s", err.Error())
+	}
+	return result, nil
+}
+
+func (e *negateExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *negateExpr) String() string { return "-" + e.operand.String() }
+
+type conditionalExpr struct {
+	condition Expression
+	then      Expression
+	otherwise Expression
+}
+
+func (e *conditionalExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	condition, err := e.condition.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if condition.Type() != cty.Bool || condition.IsNull() {
+		return cty.NilVal, diagnostics.Errorf(e.condition.Range(), "Invalid condition", "condition must be a boolean")
+	}
+	if condition.True() {
+		return e.then.Value(ctx)
+	}
+	return e.otherwise.Value(ctx)
+}
+
+func (e *conditionalExpr) Range() diagnostics.Range {
+	return e.condition.Range().Join(e.otherwise.Range())
+}
+
+func (e *conditionalExpr) String() string {
+	return e.condition.String() + " ? " + e.then.String() + " : " + e.otherwise.String()
+}
+
+type binaryExpr struct {
+	op  binaryOperator
+	lhs Expression
+	rhs Expression
+}
+
+func (e *binaryExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	lhs, err := e.lhs.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	rhs, err := e.rhs.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if (e.op.function == stdlib.DivideFunc || e.op.function == stdlib.ModuloFunc) &&
+		rhs.Type() == cty.Number && rhs.IsKnown() && !rhs.IsNull() && rhs.Equals(cty.Zero).True() {
+		return cty.NilVal, diagnostics.Errorf(e.Range(), "Invalid operands", "division by zero: %s", e.String())
+	}
+	result, err := e.op.function.Call([]cty.Value{lhs, rhs})
+	if err != nil {
+		return cty.NilVal, diagnostics.Errorf(e.Range(), "Invalid operands", "invalid operands for %s: %s", e.op.symbol, err.Error())
+	}
+	return result, nil
+}
+
+func (e *binaryExpr) Range() diagnostics.Range { return e.lhs.Range().Join(e.rhs.Range()) }
+
+func (e *binaryExpr) String() string {
+	return strings.Join([]string{e.lhs.String(), e.op.symbol, e.rhs.String()}, " ")
+}
+
+// parseExpression parses an expression up to the first token that cannot
+// continue it, that token is left on the buffer.
+func (p *Parser) parseExpression() (ast.Expression, error) {
+	condition, err := p.parseBinaryExpression(1)
+	if err != nil {
+		return nil, err
+	}
+	tok, _ := p.scanIgnoreWhitespace(false)
+	if tok != QUESTION {
+		p.unscan()
+		return condition, nil
+	}
+	expr := &ast.ConditionalExpr{Condition: condition, Question: p.token()}
+	expr.True, err = p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	tok, lit := p.scanIgnoreWhitespace(false)
+	if tok != COLON {
+		return nil, p.errorf("Invalid expression", "missing colon in conditional expression: %s", lit)
+	}
+	expr.Colon = p.token()
+	expr.False, err = p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func (p *Parser) parseBinaryExpression(minPrecedence int) (ast.Expression, error) {
+	lhs, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, _ := p.scanIgnoreWhitespace(false)
+		op, ok := binaryOperators[tok]
+		if !ok || op.precedence < minPrecedence {
+			p.unscan()
+			return lhs, nil
+		}
+		operator := p.token()
+		rhs, err := p.parseBinaryExpression(op.precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &ast.BinaryExpr{LHS: lhs, Operator: operator, RHS: rhs}
+	}
+}
+
+// parseOperand parses a unary operation or a single term, along with any
+// index or attribute access directly following it.
+func (p *Parser) parseOperand() (ast.Expression, error) {
+	tok, lit := p.scanIgnoreWhitespace(false)
+	start := p.token()
+	tok, lit = p.scanSigned(tok, lit)
+	switch tok {
+	case NOT, MINUS:
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.UnaryExpr{Operator: start, Operand: operand}, nil
+	}
+	term, err := p.parseTerm(tok, lit, p.token())
+	if err != nil {
+		return nil, err
+	}
+	return p.parseTraversal(term)
+}
+
+// parseTerm parses the term starting at the given token
+func (p *Parser) parseTerm(tok Token, lit string, start *ast.Token) (ast.Expression, error) {
+	switch tok {
+	case OPENPAREN:
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		tok, lit = p.scanIgnoreWhitespace(false)
+		if tok != CLOSEDPAREN {
+			return nil, p.errorf("Invalid expression", "missing closing parenthesis in expression: %s", lit)
+		}
+		return &ast.ParenExpr{Open: start, Expr: expr, Close: p.token()}, nil
+	case OPENBRACKET:
+		return p.parseTuple(start)
+	case OPENBRACE:
+		return p.parseObject(start)
+	case IDENT:
+		if tok, _ := p.scan(false); tok == OPENPAREN {
+			return p.parseFunctionCall(start, p.token())
+		}
+		p.unscan()
+		return &ast.IdentExpr{Name: start}, nil
+	case NUMBER:
+		return &ast.NumberExpr{Token: start}, nil
+	case STRING:
+		return &ast.StringExpr{Token: start}, nil
+	case TEMPLATE:
+		return &ast.TemplateExpr{Token: start}, nil
+	}
+	return nil, p.errorf("Invalid expression", "invalid operand in expression: %s", lit)
+}
+
+// parseTuple parses the elements of an array up to and including the closing
+// bracket.
+func (p *Parser) parseTuple(open *ast.Token) (ast.Expression, error) {
+	tuple := &ast.TupleExpr{Open: open}
+	for {
+		tok, _ := p.scanIgnoreWhitespace(false)
+		if tok == CLOSEDBRACKET {
+			break
+		}
+		p.unscan()
+		elem, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		tuple.Elems = append(tuple.Elems, elem)
+		tuple.Commas = append(tuple.Commas, nil)
+		tok, lit := p.scanIgnoreWhitespace(false)
+		if tok == CLOSEDBRACKET {
+			break
+		} else if tok != COMMA {
+			return nil, p.errorf("Missing comma", "missing comma between array elements: %s", lit)
+		}
+		tuple.Commas[len(tuple.Commas)-1] = p.token()
+	}
+	tuple.Close = p.token()
+	return tuple, nil
+}
+
+// parseObject parses the assignments of a block up to and including the
+// closing brace. Assignments may be separated by commas.
+func (p *Parser) parseObject(open *ast.Token) (ast.Expression, error) {
+	object := &ast.ObjectExpr{Open: open}
+	for {
+		tok, key := p.scanIgnoreWhitespace(false)
+		if tok == CLOSEDBRACE {
+			break
+		} else if tok == EOF {
+			return nil, p.errorf("Missing closing brace", "missing closing brace in block")
+		} else if !isLabel(tok) {
+			return nil, p.errorf("Invalid field", "invalid field in block: %s", key)
+		}
+		name := p.token()
+		tok, lit := p.scanIgnoreWhitespace(false)
+		if tok != EQUALS {
+			return nil, p.errorf("Invalid assignment", "assignment must be via equals operator. Invalid assignment: %s %s", key, lit)
+		}
+		attribute, err := p.parseAttribute(name)
+		if err != nil {
+			return nil, err
+		}
+		object.Attributes = append(object.Attributes, attribute)
+	}
+	object.Close = p.token()
+	return object, nil
+}
+
+// parseTraversal parses the index and attribute accesses directly following
+// an expression, such as var.list[0] or var.map["key"].name
+func (p *Parser) parseTraversal(expr ast.Expression) (ast.Expression, error) {
+	for {
+		tok, _ := p.scan(false)
+		switch tok {
+		case OPENBRACKET:
+			index := &ast.IndexExpr{Collection: expr, Open: p.token()}
+			key, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			index.Key = key
+			tok, lit := p.scanIgnoreWhitespace(false)
+			if tok != CLOSEDBRACKET {
+				return nil, p.errorf("Invalid index", "missing closing bracket in index: %s", lit)
+			}
+			index.Close = p.token()
+			expr = index
+		case PERIOD:
+			period := p.token()
+			tok, lit := p.scan(false)
+			if tok != IDENT {
+				return nil, p.errorf("Invalid attribute", "invalid attribute name: %s", lit)
+			}
+			expr = &ast.GetAttrExpr{Collection: expr, Period: period, Name: p.token()}
+		default:
+			p.unscan()
+			return expr, nil
+		}
+	}
+}
+
+// decodeExpression converts an expression of the syntax tree into an
+// expression that can be evaluated. Identifiers are resolved to references
+// here, so the template symbols in scope must already be set.
+func (p *Parser) decodeExpression(expr ast.Expression) (Expression, error) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		return p.decodeReference(e.Name.Lit, e.Range()), nil
+	case *ast.NumberExpr:
+		val, _, ok := parseNumber(e.Token.Lit)
+		if !ok {
+			return nil, diagnostics.Errorf(e.Range(), "Invalid number literal", "number is out of range: %s", e.Token.Lit)
+		}
+		return &literalExpr{val: val, lit: e.Token.Lit, rng: e.Range()}, nil
+	case *ast.StringExpr:
+		val, _ := parseLiteral(STRING, e.Token.Lit)
+		return &literalExpr{val: val, lit: e.Token.Lit, rng: e.Range()}, nil
+	case *ast.TemplateExpr:
+		return p.parseTemplate(e.Token.Lit, e.Range())
+	case *ast.TupleExpr:
+		tuple := &tupleExpr{rng: e.Range()}
+		for _, elem := range e.Elems {
+			decoded, err := p.decodeExpression(elem)
+			if err != nil {
+				return nil, err
+			}
+			tuple.elems = append(tuple.elems, decoded)
+		}
+		return tuple, nil
+	case *ast.ObjectExpr:
+		return p.decodeObject(e.Attributes, e.Range())
+	case *ast.FunctionCallExpr:
+		return p.decodeFunctionCall(e)
+	case *ast.ParenExpr:
+		inner, err := p.decodeExpression(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &parenExpr{expr: inner, rng: e.Range()}, nil
+	case *ast.UnaryExpr:
+		operand, err := p.decodeExpression(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if e.Operator.Text == "!" {
+			return &notExpr{operand: operand, rng: e.Range()}, nil
+		}
+		return &negateExpr{operand: operand, rng: e.Range()}, nil
+	case *ast.BinaryExpr:
+		lhs, err := p.decodeExpression(e.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := p.decodeExpression(e.RHS)
+		if err != nil {
+			return nil, err
+		}
+		for _, op := range binaryOperators {
+			if op.symbol == e.Operator.Text {
+				return &binaryExpr{op: op, lhs: lhs, rhs: rhs}, nil
+			}
+		}
+		return nil, diagnostics.Errorf(e.Operator.Range, "Invalid expression", "unknown operator: %s", e.Operator.Text)
+	case *ast.ConditionalExpr:
+		condition, err := p.decodeExpression(e.Condition)
+		if err != nil {
+			return nil, err
+		}
+		then, err := p.decodeExpression(e.True)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := p.decodeExpression(e.False)
+		if err != nil {
+			return nil, err
+		}
+		return &conditionalExpr{condition: condition, then: then, otherwise: otherwise}, nil
+	case *ast.IndexExpr:
+		collection, err := p.decodeExpression(e.Collection)
+		if err != nil {
+			return nil, err
+		}
+		key, err := p.decodeExpression(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		return &indexExpr{collection: collection, key: key, rng: e.Range()}, nil
+	case *ast.GetAttrExpr:
+		decoded, err := p.decodeExpression(e.Collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, attribute := range strings.Split(e.Name.Lit, ".") {
+			decoded = &getAttrExpr{collection: decoded, name: attribute, rng: e.Range()}
+		}
+		return decoded, nil
+	}
+	return nil, diagnostics.Errorf(expr.Range(), "Invalid expression", "unsupported expression: %s", ast.Bytes(expr))
+}
+
+// decodeObject converts the attributes of a block into an expression, each
+// attribute may only be assigned once.
+func (p *Parser) decodeObject(attributes []*ast.Attribute, rng diagnostics.Range) (Expression, error) {
+	object := &objectExpr{rng: rng}
+	seen := make(map[string]bool, len(attributes))
+	for _, attribute := range attributes {
+		key := attribute.Name.Lit
+		if seen[key] {
+			return nil, diagnostics.Errorf(attribute.Name.Range, "Duplicate field", "field [%s] is assigned more than once", key)
+		}
+		seen[key] = true
+		elem, err := p.decodeExpression(attribute.Value)
+		if err != nil {
+			return nil, err
+		}
+		object.keys = append(object.keys, key)
+		object.elems = append(object.elems, elem)
+	}
+	return object, nil
+}
+
+// decodeReference converts an identifier into a reference to a variable,
+// local, data source, instance, module or template symbol, or one of the
+// keywords true, false and null. Any other identifier is an unknown
+// reference, reported when evaluated.
+func (p *Parser) decodeReference(lit string, rng diagnostics.Range) Expression {
+	var expr Expression
+	symbol := strings.Split(lit, ".")
+	switch {
+	case strings.HasPrefix(lit, dataReferencePrefix):
+		return &dataExpr{reference: lit, rng: rng}
+	case strings.HasPrefix(lit, instanceReferencePrefix):
+		return &instanceExpr{reference: lit, rng: rng}
+	case strings.HasPrefix(lit, moduleReferencePrefix):
+		return &moduleExpr{reference: lit, rng: rng}
+	case strings.HasPrefix(lit, variableReferencePrefix) && len(symbol) > 1:
+		expr = &variableExpr{name: symbol[1], rng: rng}
+		symbol = symbol[2:]
+	case strings.HasPrefix(lit, localReferencePrefix) && len(symbol) > 1:
+		expr = &localExpr{name: symbol[1], rng: rng}
+		symbol = symbol[2:]
+	case p.iterators[symbol[0]]:
+		expr = &iteratorExpr{name: symbol[0], rng: rng}
+		symbol = symbol[1:]
+	case lit == "true" || lit == "false":
+		return &literalExpr{val: cty.BoolVal(lit == "true"), lit: lit, rng: rng}
+	case lit == "null":
+		return &literalExpr{val: cty.NullVal(cty.DynamicPseudoType), lit: lit, rng: rng}
+	default:
+		return &unknownReferenceExpr{reference: lit, rng: rng}
+	}
+	for _, attribute := range symbol {
+		expr = &getAttrExpr{collection: expr, name: attribute, rng: rng}
+	}
+	return expr
+}
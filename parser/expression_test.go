@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+// outputValue returns the value of the output o, declared after the given
+// source with the expression as its value
+func outputValue(src string, expr string) (cty.Value, error) {
+	schem, _, err := parseSource(src+"\noutput \"o\" {\nvalue = "+expr+"\n}\n", nil)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return schem.Outputs["o"].Value, nil
+}
+
+func TestExpressions(t *testing.T) {
+	vars := "variable \"n\" = 4\nvariable \"s\" = \"svc\"\nvariable \"prod\" = true\n"
+	tests := []struct {
+		name string
+		expr string
+		want cty.Value
+	}{
+		{"integer", "5821", cty.NumberIntVal(5821)},
+		{"float suffix", "2f", cty.NumberFloatVal(2)},
+		{"exponent", "4e3", cty.NumberIntVal(4000)},
+		{"negative", "-20", cty.NumberIntVal(-20)},
+		{"string", `"text"`, cty.StringVal("text")},
+		{"true", "true", cty.True},
+		{"null", "null", cty.NullVal(cty.DynamicPseudoType)},
+		{"precedence", "1 + 2 * 3", cty.NumberIntVal(7)},
+		{"parentheses", "(1 + 2) * 3", cty.NumberIntVal(9)},
+		{"modulo", "7 % 3", cty.NumberIntVal(1)},
+		{"comparison", "var.n >= 4 && var.n < 5", cty.True},
+		{"equality", `var.s == "svc" || false`, cty.True},
+		{"not", "!var.prod", cty.False},
+		{"conditional", "var.prod ? 100 : 20", cty.NumberIntVal(100)},
+		{"variable arithmetic", "var.n * 2", cty.NumberIntVal(8)},
+		{"index", `["a", "b"][1]`, cty.StringVal("b")},
+		{"attribute", `{ a = 1, b = "x" }.b`, cty.StringVal("x")},
+		{"key index", `{ a = 1, b = "x" }["a"]`, cty.NumberIntVal(1)},
+		{"interpolation", `"${var.s}-${var.n}"`, cty.StringVal("svc-4")},
+		{"escaped interpolation", `"$${var.s}"`, cty.StringVal("${var.s}")},
+		{"if directive", `"%{if var.prod}prod%{else}dev%{endif}"`, cty.StringVal("prod")},
+		{"for directive", `"%{for k, v in { a = 1, b = 2 }}${k}=${v} %{endfor}"`, cty.StringVal("a=1 b=2 ")},
+		{"heredoc", "<<-EOT\n  ${var.s}\n    indented\n  EOT", cty.StringVal("svc\n  indented\n")},
+		{
+			name: "inline block",
+			expr: `{ name = var.s, port = 80 }`,
+			want: cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("svc"), "port": cty.NumberIntVal(80)}),
+		},
+		{
+			name: "array",
+			expr: `[1, var.n]`,
+			want: cty.TupleVal([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(4)}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := outputValue(vars, test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "unknown reference",
+			expr:    "svc",
+			summary: "Unknown reference",
+			detail:  "must be var.<NAME>, local.<NAME>, data.<TYPE>.<NAME>, instance.<NAME>, module.<NAME> or a quoted string: svc",
+		},
+		{
+			name:    "number out of range",
+			expr:    "1e400",
+			summary: "Invalid number literal",
+			detail:  "number is out of range: 1e400",
+		},
+		{
+			name:    "undeclared variable",
+			expr:    "var.missing",
+			summary: "Reference to undeclared variable",
+			detail:  "missing",
+		},
+		{
+			name:    "undeclared local",
+			expr:    "local.missing",
+			summary: "Reference to undeclared local",
+			detail:  "no such local: missing",
+		},
+		{
+			name:    "operand types",
+			expr:    `1 + "a"`,
+			summary: "Invalid operands",
+			detail:  "invalid operands for +: number required, but received string",
+		},
+		{
+			name:    "index out of range",
+			expr:    `["a"][3]`,
+			summary: "Invalid index",
+			detail:  "3",
+		},
+		{
+			name:    "conditional on a string",
+			expr:    `"yes" ? 1 : 2`,
+			summary: "Invalid condition",
+			detail:  "bool",
+		},
+		{
+			name:    "division by zero",
+			expr:    "1 / 0",
+			summary: "Invalid operands",
+			detail:  "division by zero: 1 / 0",
+		},
+		{
+			name:    "missing block attribute",
+			expr:    `{ a = "b" }.c`,
+			summary: "Invalid index",
+			detail:  "block has no attribute: c",
+		},
+		{
+			name:    "missing colon",
+			expr:    "true ? 1 2",
+			summary: "Invalid expression",
+			detail:  "missing colon in conditional expression",
+		},
+		{
+			name:    "missing closing parenthesis",
+			expr:    "(1 + 2",
+			summary: "Invalid expression",
+			detail:  "missing closing parenthesis in expression",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := outputValue("", test.expr)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
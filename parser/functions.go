@@ -0,0 +1,352 @@
+package parser
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// functions holds the functions that can be called from expressions, other
+// than the filesystem functions returned by fileFunction.
+var functions = map[string]function.Function{
+	// String functions
+	"chomp":      stdlib.ChompFunc,
+	"format":     stdlib.FormatFunc,
+	"formatlist": stdlib.FormatListFunc,
+	"indent":     stdlib.IndentFunc,
+	"join":       stdlib.JoinFunc,
+	"lower":      stdlib.LowerFunc,
+	"regex":      stdlib.RegexFunc,
+	"regexall":   stdlib.RegexAllFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"split":      stdlib.SplitFunc,
+	"strlen":     stdlib.StrlenFunc,
+	"strrev":     stdlib.ReverseFunc,
+	"substr":     stdlib.SubstrFunc,
+	"title":      stdlib.TitleFunc,
+	"trim":       stdlib.TrimFunc,
+	"trimprefix": stdlib.TrimPrefixFunc,
+	"trimspace":  stdlib.TrimSpaceFunc,
+	"trimsuffix": stdlib.TrimSuffixFunc,
+	"upper":      stdlib.UpperFunc,
+	// Numeric functions
+	"abs":      stdlib.AbsoluteFunc,
+	"ceil":     stdlib.CeilFunc,
+	"floor":    stdlib.FloorFunc,
+	"log":      stdlib.LogFunc,
+	"max":      stdlib.MaxFunc,
+	"min":      stdlib.MinFunc,
+	"parseint": stdlib.ParseIntFunc,
+	"pow":      stdlib.PowFunc,
+	"signum":   stdlib.SignumFunc,
+	// Collection functions
+	"chunklist":    stdlib.ChunklistFunc,
+	"coalesce":     stdlib.CoalesceFunc,
+	"coalescelist": stdlib.CoalesceListFunc,
+	"compact":      stdlib.CompactFunc,
+	"concat":       stdlib.ConcatFunc,
+	"contains":     stdlib.ContainsFunc,
+	"distinct":     stdlib.DistinctFunc,
+	"element":      stdlib.ElementFunc,
+	"flatten":      stdlib.FlattenFunc,
+	"keys":         stdlib.KeysFunc,
+	"length":       stdlib.LengthFunc,
+	"lookup":       stdlib.LookupFunc,
+	"merge":        stdlib.MergeFunc,
+	"range":        stdlib.RangeFunc,
+	"reverse":      stdlib.ReverseListFunc,
+	"setunion":     stdlib.SetUnionFunc,
+	"slice":        stdlib.SliceFunc,
+	"sort":         stdlib.SortFunc,
+	"values":       stdlib.ValuesFunc,
+	"zipmap":       stdlib.ZipmapFunc,
+	// Type conversion functions
+	"tobool":   stdlib.MakeToFunc(cty.Bool),
+	"tonumber": stdlib.MakeToFunc(cty.Number),
+	"tostring": stdlib.MakeToFunc(cty.String),
+	// Encoding functions
+	"base64decode": base64DecodeFunc,
+	"base64encode": base64EncodeFunc,
+	"csvdecode":    stdlib.CSVDecodeFunc,
+	"jsondecode":   stdlib.JSONDecodeFunc,
+	"jsonencode":   stdlib.JSONEncodeFunc,
+	// Hashing functions
+	"md5":          makeHashFunc(md5.New, hex.EncodeToString),
+	"sha1":         makeHashFunc(sha1.New, hex.EncodeToString),
+	"sha256":       makeHashFunc(sha256.New, hex.EncodeToString),
+	"sha512":       makeHashFunc(sha512.New, hex.EncodeToString),
+	"base64sha256": makeHashFunc(sha256.New, base64.StdEncoding.EncodeToString),
+	"base64sha512": makeHashFunc(sha512.New, base64.StdEncoding.EncodeToString),
+}
+
+// fileFunction returns the filesystem function of the given name. Relative
+// paths are read from dir, the directory of the file calling the function,
+// as with local data references.
+func fileFunction(name string, dir string) (function.Function, bool) {
+	switch name {
+	case "file":
+		return makeFileFunc(dir), true
+	case "fileexists":
+		return makeFileExistsFunc(dir), true
+	case "templatefile":
+		return makeTemplateFileFunc(dir), true
+	}
+	return function.Function{}, false
+}
+
+// resolvePath returns the path relative to dir, unless it is absolute
+func resolvePath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "str", Type: cty.String}},
+	Type:   function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+var base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "str", Type: cty.String}},
+	Type:   function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		decoded, err := base64.StdEncoding.DecodeString(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, function.NewArgErrorf(0, "invalid base64 data: %s", err.Error())
+		} else if !utf8.Valid(decoded) {
+			return cty.NilVal, function.NewArgErrorf(0, "decoded base64 data is not valid UTF-8")
+		}
+		return cty.StringVal(string(decoded)), nil
+	},
+})
+
+func makeFileFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := resolvePath(dir, args[0].AsString())
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return cty.NilVal, function.NewArgErrorf(0, "could not read file %s: %s", path, err.Error())
+			} else if !utf8.Valid(contents) {
+				return cty.NilVal, function.NewArgErrorf(0, "contents of %s are not valid UTF-8", path)
+			}
+			return cty.StringVal(string(contents)), nil
+		},
+	})
+}
+
+func makeFileExistsFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "path", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := resolvePath(dir, args[0].AsString())
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				return cty.False, nil
+			} else if err != nil {
+				return cty.NilVal, function.NewArgErrorf(0, "could not stat file %s: %s", path, err.Error())
+			} else if !info.Mode().IsRegular() {
+				return cty.NilVal, function.NewArgErrorf(0, "%s is not a regular file", path)
+			}
+			return cty.True, nil
+		},
+	})
+}
+
+// makeTemplateFileFunc returns a function rendering the template in a file,
+// the attributes of the second argument are in scope as symbols within the
+// template.
+func makeTemplateFileFunc(dir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+			{Name: "vars", Type: cty.DynamicPseudoType},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, vars := resolvePath(dir, args[0].AsString()), args[1]
+			if ty := vars.Type(); !ty.IsObjectType() && !ty.IsMapType() {
+				return cty.NilVal, function.NewArgErrorf(1, "template variables must be a block, not %s", ty.FriendlyName())
+			}
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return cty.NilVal, function.NewArgErrorf(0, "could not read file %s: %s", path, err.Error())
+			}
+			return renderTemplateFile(path, string(src), vars)
+		},
+	})
+}
+
+func renderTemplateFile(path string, src string, vars cty.Value) (cty.Value, error) {
+	p := NewParser(strings.NewReader(""))
+	p.SetFilename(path)
+	p.iterators = make(map[string]bool)
+	values := make(map[string]cty.Value)
+	for it := vars.ElementIterator(); it.Next(); {
+		key, value := it.Element()
+		p.iterators[key.AsString()] = true
+		values[key.AsString()] = value
+	}
+	// The file is positioned as the body of a heredoc opened on line 0, so
+	// the first line of the file is line 1. Backslashes are literal as they
+	// are in heredocs.
+	rng := diagnostics.Range{
+		Filename: path,
+		Start:    diagnostics.Pos{Line: 0, Column: 1, Byte: 0},
+		End:      diagnostics.Pos{Line: 1 + strings.Count(src, "\n"), Column: 1, Byte: len(src)},
+	}
+	template, err := p.parseTemplate(strings.ReplaceAll(src, "\\", "\\\\"), rng)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	ctx := &EvalContext{Iterators: values}
+	return template.Value(ctx)
+}
+
+// makeHashFunc returns a function that hashes a string with the given
+// algorithm and encodes the digest.
+func makeHashFunc(newHash func() hash.Hash, encode func([]byte) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "str", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			h := newHash()
+			h.Write([]byte(args[0].AsString()))
+			return cty.StringVal(encode(h.Sum(nil))), nil
+		},
+	})
+}
+
+type functionCallExpr struct {
+	name     string
+	function function.Function
+	args     []Expression
+	rng      diagnostics.Range
+}
+
+func (e *functionCallExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	params, varParam := e.function.Params(), e.function.VarParam()
+	args := make([]cty.Value, len(e.args))
+	for i, arg := range e.args {
+		val, err := arg.Value(ctx)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		// Arrays and blocks are tuples and objects, which are converted to
+		// the list and map types most functions accept
+		var param *function.Parameter
+		if i < len(params) {
+			param = &params[i]
+		} else {
+			param = varParam
+		}
+		if param != nil {
+			converted, err := convert.Convert(val, param.Type)
+			if err != nil {
+				return cty.NilVal, diagnostics.Errorf(arg.Range(), "Invalid function argument", "invalid value for %s parameter of %s: %s", param.Name, e.name, err.Error())
+			}
+			val = converted
+		}
+		args[i] = val
+	}
+	result, err := e.function.Call(args)
+	if err != nil {
+		rng := e.rng
+		switch callErr := err.(type) {
+		case *diagnostics.Diagnostic:
+			// Raised within a template file rendered by templatefile
+			return cty.NilVal, err
+		case function.ArgError:
+			if callErr.Index < len(e.args) {
+				rng = e.args[callErr.Index].Range()
+			}
+		}
+		return cty.NilVal, diagnostics.Errorf(rng, "Error in function call", "call to function %s failed: %s", e.name, err.Error())
+	}
+	return result, nil
+}
+
+func (e *functionCallExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *functionCallExpr) String() string {
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.String()
+	}
+	return e.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// parseFunctionCall parses the arguments of a function call up to and
+// including the closing parenthesis. Arguments are separated by commas, a
+// trailing comma is permitted.
+func (p *Parser) parseFunctionCall(name *ast.Token, open *ast.Token) (ast.Expression, error) {
+	call := &ast.FunctionCallExpr{Name: name, Open: open}
+	for {
+		tok, _ := p.scanIgnoreWhitespace(false)
+		if tok == CLOSEDPAREN {
+			break
+		} else if tok == EOF {
+			return nil, p.errorf("Invalid function call", "missing closing parenthesis in call to function: %s", name.Lit)
+		}
+		p.unscan()
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		call.Commas = append(call.Commas, nil)
+		tok, lit := p.scanIgnoreWhitespace(false)
+		if tok == CLOSEDPAREN {
+			break
+		} else if tok != COMMA {
+			return nil, p.errorf("Missing comma", "missing comma between function arguments: %s", lit)
+		}
+		call.Commas[len(call.Commas)-1] = p.token()
+	}
+	call.Close = p.token()
+	return call, nil
+}
+
+// decodeFunctionCall resolves the function called by name and decodes its
+// arguments.
+func (p *Parser) decodeFunctionCall(call *ast.FunctionCallExpr) (Expression, error) {
+	name := call.Name.Lit
+	fn, ok := functions[name]
+	if !ok {
+		fn, ok = fileFunction(name, filepath.Dir(call.Name.Range.Filename))
+	}
+	if !ok {
+		return nil, diagnostics.Errorf(call.Name.Range, "Call to unknown function", "no function named: %s", name)
+	}
+	decoded := &functionCallExpr{name: name, function: fn, rng: call.Range()}
+	for _, arg := range call.Args {
+		decodedArg, err := p.decodeExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		decoded.args = append(decoded.args, decodedArg)
+	}
+	return decoded, nil
+}
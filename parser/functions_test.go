@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "text.txt")
+	if err := ioutil.WriteFile(textPath, []byte("contents\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templatePath := filepath.Join(dir, "handler.tpl")
+	if err := ioutil.WriteFile(templatePath, []byte("%{for host in hosts}${host}:${port} %{endfor}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		expr string
+		want cty.Value
+	}{
+		{"lower", `lower("SVC")`, cty.StringVal("svc")},
+		{"join", `join("/", ["a", "b", "c"])`, cty.StringVal("a/b/c")},
+		{"format", `format("%s-%d", "svc", 3)`, cty.StringVal("svc-3")},
+		{"trailing comma", `upper("a",)`, cty.StringVal("A")},
+		{"max", `max(3, 9, 4)`, cty.NumberIntVal(9)},
+		{"length", `length(keys({ a = 1, b = 2 }))`, cty.NumberIntVal(2)},
+		{"lookup", `lookup({ a = 1 }, "b", 5)`, cty.NumberIntVal(5)},
+		{"contains", `contains(["a", "b"], "b")`, cty.True},
+		{"tonumber", `tonumber("12")`, cty.NumberIntVal(12)},
+		{"jsonencode", `jsonencode({ a = [1, true] })`, cty.StringVal(`{"a":[1,true]}`)},
+		{"base64 round trip", `base64decode(base64encode("schematic"))`, cty.StringVal("schematic")},
+		{"md5", `md5("a")`, cty.StringVal("0cc175b9c0f1b6a831c399e269772661")},
+		{"base64sha256", `base64sha256("a")`, cty.StringVal("ypeBEsobvcr6wjGzmiPcTaeG7/gUfE5yuYB3ha/uSLs=")},
+		{"nested", `upper(join("-", split(",", "a,b")))`, cty.StringVal("A-B")},
+		{"file", `file(` + strconv.Quote(textPath) + `)`, cty.StringVal("contents\n")},
+		{"fileexists", `fileexists(` + strconv.Quote(filepath.Join(dir, "missing")) + `)`, cty.False},
+		{
+			name: "templatefile",
+			expr: `templatefile(` + strconv.Quote(templatePath) + `, { hosts = ["a", "b"], port = 80 })`,
+			want: cty.StringVal("a:80 b:80 "),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := outputValue("", test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "unknown function",
+			expr:    `nope(1)`,
+			summary: "Call to unknown function",
+			detail:  "no function named: nope",
+		},
+		{
+			name:    "argument type",
+			expr:    `upper(["a"])`,
+			summary: "Invalid function argument",
+			detail:  "invalid value for str parameter of upper",
+		},
+		{
+			name:    "argument count",
+			expr:    `upper("a", "b")`,
+			summary: "Error in function call",
+			detail:  "call to function upper failed",
+		},
+		{
+			name:    "invalid base64",
+			expr:    `base64decode("!")`,
+			summary: "Error in function call",
+			detail:  "invalid base64 data",
+		},
+		{
+			name:    "missing file",
+			expr:    `file("does/not/exist")`,
+			summary: "Error in function call",
+			detail:  "could not read file does/not/exist",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := outputValue("", test.expr)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
+
+func TestFileFunctionPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, map[string]string{
+		"main.schm": `output "o" {
+  value = "${file("text.txt")}${fileexists("text.txt")}${templatefile("templates/port.tpl", { port = 80 })}"
+}
+`,
+		"text.txt":           "contents,",
+		"templates/port.tpl": `${port}${file("../text.txt")}`,
+	})
+	schem, _, err := NewParser(nil).ParseConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cty.StringVal("contents,true80contents,")
+	if got := schem.Outputs["o"].Value; !got.RawEquals(want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
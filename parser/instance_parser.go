@@ -2,79 +2,143 @@ package parser
 
 import (
 	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
 	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
 	"github.com/EngineersBox/Schematic/providers"
 	"github.com/EngineersBox/Schematic/schema"
 	"github.com/EngineersBox/Schematic/state"
-	"strconv"
 	"strings"
 )
 
 const (
+	instanceKeyword = "instance"
+
 	variableReferencePrefix = "var."
+	dataReferencePrefix     = "data."
+	instanceReferencePrefix = "instance."
+	localReferencePrefix    = "local."
+	moduleReferencePrefix   = "module."
 	fieldNestingDelimiter   = "->"
+
+	instanceHasDependencyField = "hasDependency"
 )
 
-func (p *Parser) parseInstance(schem *state.ParsedState) (string, *state.InstanceState, error) {
-	newInst := &state.InstanceState{}
-	tok, lit := p.scanLine()
-	if tok[0] != IDENT || !strings.Contains(lit[0], providerReferenceDelimiter) {
-		return "", nil, fmt.Errorf("invalid provider reference for instance: " + lit[0])
-	}
-	provRef, err := newProviderReference(lit[0])
-	if err != nil {
-		return "", nil, err
+func (p *Parser) decodeInstance(block *ast.Block, schem *state.ParsedState) (*state.InstanceState, error) {
+	if err := checkBlock(block, false, "provider reference", "name"); err != nil {
+		return nil, err
 	}
-	if tok[1] != IDENT {
-		return "", nil, fmt.Errorf("not a valid variable name")
+	provRefToken, name := block.Labels[0], block.Labels[1]
+	if !strings.Contains(provRefToken.Lit, providerReferenceDelimiter) {
+		return nil, diagnostics.Errorf(provRefToken.Range, "Invalid provider reference", "invalid provider reference for instance: %s", provRefToken.Lit)
 	}
-	newInst.ID = lit[1]
-	if tok[2] != OPENBRACE {
-		return "", nil, fmt.Errorf("missing open brace in instance declaration")
+	provRef, err := newProviderReference(provRefToken.Lit)
+	if err != nil {
+		return nil, wrapError(err, provRefToken.Range, "Invalid provider reference")
 	}
-	err = p.parseInstanceBody(newInst, provRef, schem)
+	newInst := &state.InstanceState{ID: name.Lit}
+	err = p.decodeInstanceBody(block, newInst, provRef, provRefToken.Range, schem)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-	return lit[1], newInst, nil
+	return newInst, nil
 }
 
-func (p *Parser) parseInstanceBody(newInst *state.InstanceState, providerReference *ProviderReference, schem *state.ParsedState) error {
+func (p *Parser) decodeInstanceBody(block *ast.Block, newInst *state.InstanceState, providerReference *ProviderReference, provRefRange diagnostics.Range, schem *state.ParsedState) error {
 	provider := providers.InstalledProviders[providerReference.Provider]
 	if provider == nil {
-		return fmt.Errorf("not such provider: %s", providerReference.Provider)
+		return diagnostics.Errorf(provRefRange, "Unknown provider", "not such provider: %s", providerReference.Provider)
 	}
 	instanceReference := provider.InstancesMap[providerReference.Kind]
 	if instanceReference == nil {
-		return fmt.Errorf("provider [%s] has no instance defintion: %s", providerReference.Provider, providerReference.Kind)
+		return diagnostics.Errorf(
+			provRefRange,
+			"Unknown instance kind",
+			"provider [%s] has no instance defintion: %s",
+			providerReference.Provider,
+			providerReference.Kind,
+		)
 	}
-	instanceSchema := instanceReference.Schema
 	newInst.Provider = providerReference.Provider
 	newInst.Type = providerReference.Kind
 	newInst.Attributes = make(map[string]interface{})
-	blockDepth := 0
-	var nesting []string
-	for {
-		tokens, literals := p.scanLine()
-		if len(tokens) == 1 && tokens[0] == CLOSEDBRACE {
-			if blockDepth == 0 {
-				break
+	newInst.Meta = make(map[string]interface{})
+	for _, item := range block.Body {
+		if nested, ok := item.(*ast.Block); ok {
+			return diagnostics.Errorf(
+				nested.Type.Range,
+				"Invalid assignment",
+				"assignment must be via equals operator. Invalid assignment: %s",
+				nested.Type.Lit,
+			)
+		}
+	}
+	err := p.decodeInstanceBlock(nil, block.Attributes(), instanceReference.Schema, schem, providerReference, newInst)
+	if err != nil {
+		return err
+	}
+	diags := validateInstanceSchema(block, newInst.ID, newInst.Attributes, instanceReference.Schema)
+	if diags.HasErrors() {
+		return diags
+	}
+	p.warnings = append(p.warnings, diags...)
+	err = applyDefaults(nil, newInst.Attributes, instanceReference.Schema)
+	if err != nil {
+		return wrapError(err, block.Labels[len(block.Labels)-1].Range, "Invalid default")
+	}
+	value, err := instanceReference.ObjectValue(newInst.Attributes)
+	if err != nil {
+		return wrapError(err, block.Labels[len(block.Labels)-1].Range, "Invalid instance")
+	}
+	newInst.Value = instanceReference.PlannedValue(value)
+	return nil
+}
+
+func (p *Parser) decodeInstanceBlock(nesting []string, attributes []*ast.Attribute, instanceSchema map[string]*schema.Schema, schem *state.ParsedState, providerReference *ProviderReference, newInst *state.InstanceState) error {
+	for _, attribute := range attributes {
+		field := attribute.Name.Lit
+		currentNesting := append(append([]string{}, nesting...), field)
+		if len(nesting) == 0 && field == instanceHasDependencyField {
+			dependencies, err := p.decodeDependencies(instanceHasDependencyField, attribute.Value, schem)
+			if err != nil {
+				return err
 			}
-			blockDepth--
+			newInst.Meta[instanceHasDependencyField] = dependencies
 			continue
 		}
-		if len(tokens) != 3 {
-			return fmt.Errorf("invalid assignment in instance body: \"%s\"", strings.Join(literals, " "))
-		}
-		if tokens[1] != EQUALS {
-			return fmt.Errorf("assignment must be via equals operator. Invalid assignment: %s", strings.Join(literals, " "))
+		fieldSchema := getSchemaField(currentNesting, instanceSchema)
+		if fieldSchema == nil {
+			return diagnostics.Errorf(
+				attribute.Name.Range,
+				"Unsupported attribute",
+				"instance [%s] has no schema field for: %s",
+				providerReference.AsString(),
+				strings.Join(currentNesting, fieldNestingDelimiter),
+			)
 		}
-		if tokens[2] == OPENBRACE {
-			nesting = append(nesting, literals[0])
-			blockDepth++
-			continue
+		var err error
+		switch value := attribute.Value.(type) {
+		case *ast.ObjectExpr:
+			if fieldSchema.Type != schematic.TypeMap {
+				return diagnostics.Errorf(
+					attribute.Name.Range,
+					"Invalid block",
+					"instance field [%s] is not a block",
+					strings.Join(currentNesting, fieldNestingDelimiter),
+				)
+			}
+			if _, isBlock := fieldSchema.Elem.(map[string]*schema.Schema); !isBlock {
+				// A map of values rather than a block of fields
+				err = p.updateInstanceFields(currentNesting, fieldSchema, value, schem, newInst)
+			} else if len(value.Attributes) == 0 {
+				// An empty block is set, unlike one that is not declared
+				newInst.Attributes, err = recurseAssign(currentNesting, make(map[string]interface{}), newInst.Attributes)
+			} else {
+				err = p.decodeInstanceBlock(currentNesting, value.Attributes, instanceSchema, schem, providerReference, newInst)
+			}
+		default:
+			err = p.updateInstanceFields(currentNesting, fieldSchema, value, schem, newInst)
 		}
-		err := updateInstanceFields(nesting, literals, instanceSchema, schem, providerReference, newInst)
 		if err != nil {
 			return err
 		}
@@ -82,35 +146,70 @@ func (p *Parser) parseInstanceBody(newInst *state.InstanceState, providerReferen
 	return nil
 }
 
-func updateInstanceFields(nesting []string, literals []string, instanceSchema map[string]*schema.Schema, schem *state.ParsedState, providerReference *ProviderReference, newInst *state.InstanceState) error {
-	currentNesting := append(nesting, literals[0])
-	if !validateSchemaFields(currentNesting, instanceSchema) {
-		return fmt.Errorf(
-			"instance [%s] has no schema field for: %s",
-			providerReference.AsString(),
-			strings.Join(currentNesting, fieldNestingDelimiter),
-		)
+// updateInstanceFields evaluates the expression assigned to a field, checks
+// it against the type of the field and stores the result in the instance
+// attributes.
+func (p *Parser) updateInstanceFields(currentNesting []string, fieldSchema *schema.Schema, expr ast.Expression, schem *state.ParsedState, newInst *state.InstanceState) error {
+	value, err := p.evaluate(expr, schem)
+	if err != nil {
+		return err
+	} else if value.IsNull() {
+		// A field assigned null is left unset
+		return nil
 	}
-	assignableValue := literals[2]
-	if strings.Contains(assignableValue, variableReferencePrefix) {
-		variableReference := strings.TrimPrefix(assignableValue, variableReferencePrefix)
-		variableType := schem.Variables[variableReference].BaseType
-		if variableType == schematic.TypeInt {
-			val, _ := schem.Variables[variableReference].Value.AsBigFloat().Int64()
-			assignableValue = strconv.FormatInt(val, 10)
-		} else if variableType == schematic.TypeFloat {
-			val, _ := schem.Variables[variableReference].Value.AsBigFloat().Float64()
-			assignableValue = fmt.Sprintf("%f", val)
-		} else if variableType == schematic.TypeBool {
-			assignableValue = schem.Variables[variableReference].Value.AsString()
-		} else {
-			return fmt.Errorf("unknown variable type: %v", variableType)
-		}
+	valueRange := expr.Range()
+	value, err = convertToSchemaType(currentNesting, value, fieldSchema)
+	if err != nil {
+		return wrapError(err, valueRange, "Incorrect attribute value type")
+	}
+	assignableValue, err := fromCtyValue(value)
+	if err != nil {
+		return wrapError(err, valueRange, "Invalid value")
+	}
+	assignableValue, err = validateValue(currentNesting, assignableValue, fieldSchema)
+	if err != nil {
+		return wrapError(err, valueRange, "Invalid value")
 	}
 	updatedFields, err := recurseAssign(currentNesting, assignableValue, newInst.Attributes)
 	if err != nil {
-		return err
+		return wrapError(err, valueRange, "Invalid value")
 	}
 	newInst.Attributes = updatedFields
 	return nil
 }
+
+// applyDefaults sets each field that is not set in the configuration to the
+// default of its schema, converted to the type of the field. The fields of a
+// nested block are only defaulted when the block is set.
+func applyDefaults(nesting []string, block map[string]interface{}, blockSchema map[string]*schema.Schema) error {
+	for key, fieldSchema := range blockSchema {
+		fieldNesting := append(append([]string{}, nesting...), key)
+		if value, ok := block[key]; ok {
+			nested, isBlock := value.(map[string]interface{})
+			fields, hasFields := fieldSchema.Elem.(map[string]*schema.Schema)
+			if isBlock && hasFields && fieldSchema.Type == schematic.TypeMap {
+				if err := applyDefaults(fieldNesting, nested, fields); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		defaultValue, err := fieldSchema.DefaultValue()
+		if err != nil {
+			return fmt.Errorf("could not get the default of field [%s]: %s", strings.Join(fieldNesting, fieldNestingDelimiter), err.Error())
+		} else if defaultValue == nil {
+			continue
+		}
+		// Converted through cty so that the schema default is not modified
+		copied, err := fromCtyValue(toCtyValue(defaultValue))
+		if err != nil {
+			return fmt.Errorf("field [%s] has an invalid default: %s", strings.Join(fieldNesting, fieldNestingDelimiter), err.Error())
+		}
+		converted, err := validateValue(fieldNesting, copied, fieldSchema)
+		if err != nil {
+			return err
+		}
+		block[key] = converted
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInstanceFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		nesting []string
+		want    interface{}
+	}{
+		{
+			name:    "nested block",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\nconfig = {\npidsMax = 20\n}\n}",
+			nesting: []string{"config", "pidsMax"},
+			want:    20,
+		},
+		{
+			name:    "bool",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\ninbuilt = true\n}",
+			nesting: []string{"inbuilt"},
+			want:    true,
+		},
+		{
+			name:    "list",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\nnames = [\"a\", \"b\",]\n}",
+			nesting: []string{"names"},
+			want:    []interface{}{"a", "b"},
+		},
+		{
+			name:    "set without duplicates",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\ntags = [\"a\", \"b\", \"a\"]\n}",
+			nesting: []string{"tags"},
+			want:    []interface{}{"a", "b"},
+		},
+		{
+			name:    "list of blocks",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\nmounts = [{ source = \"/a\" }, { volume = \"b\" }]\n}",
+			nesting: []string{"mounts"},
+			want:    []interface{}{map[string]interface{}{"source": "/a"}, map[string]interface{}{"volume": "b"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := schem.Instances["x"].GetFromNesting(test.nesting)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInstanceValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		field string
+		want  cty.Value
+	}{
+		{
+			name:  "map of values",
+			src:   `instance "test::container" "x" { containerId = "a", labels = { a = 1, b = 2 } }`,
+			field: "labels",
+			want:  cty.MapVal(map[string]cty.Value{"a": cty.NumberIntVal(1), "b": cty.NumberIntVal(2)}),
+		},
+		{
+			name:  "nested block",
+			src:   "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\nconfig = {\npidsMax = 20\n}\n}",
+			field: "config",
+			want: cty.ObjectVal(map[string]cty.Value{
+				"pidsMax": cty.NumberIntVal(20),
+				"memMax":  cty.NullVal(cty.Number),
+			}),
+		},
+		{
+			name:  "list",
+			src:   `instance "test::container" "x" { containerId = "a", names = ["a", "b"] }`,
+			field: "names",
+			want:  cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		},
+		{
+			name:  "set",
+			src:   `instance "test::container" "x" { containerId = "a", tags = ["b", "a", "b"] }`,
+			field: "tags",
+			want:  cty.SetVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		},
+		{
+			name:  "list of blocks",
+			src:   `instance "test::container" "x" { containerId = "a", mounts = [{ source = "/a" }, { volume = "b" }] }`,
+			field: "mounts",
+			want: cty.ListVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"source": cty.StringVal("/a"), "volume": cty.NullVal(cty.String)}),
+				cty.ObjectVal(map[string]cty.Value{"source": cty.NullVal(cty.String), "volume": cty.StringVal("b")}),
+			}),
+		},
+		{
+			name:  "unset",
+			src:   `instance "test::container" "x" { containerId = "a" }`,
+			field: "inbuilt",
+			want:  cty.NullVal(cty.Bool),
+		},
+		{
+			name:  "null is unset",
+			src:   `instance "test::container" "x" { containerId = "a", inbuilt = null }`,
+			field: "inbuilt",
+			want:  cty.NullVal(cty.Bool),
+		},
+		{
+			name:  "forward reference",
+			src:   "instance \"test::container\" \"x\" { containerId = instance.y.containerId }\ninstance \"test::container\" \"y\" { containerId = \"from_y\" }",
+			field: "containerId",
+			want:  cty.StringVal("from_y"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, _, err := parseSource(test.src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := schem.Instances["x"].Value().GetAttr(test.field)
+			if !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInstanceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "map value of the wrong type",
+			src:     `instance "test::container" "x" { containerId = "a", labels = { a = "many" } }`,
+			summary: "Invalid value",
+			detail:  "field [labels->a] must be an int",
+		},
+		{
+			name:    "array for a literal field",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = [\"a\"]\n}",
+			summary: "Incorrect attribute value type",
+			detail:  "field [containerId] must be a string",
+		},
+		{
+			name:    "literal for a list field",
+			src:     "instance \"test::container\" \"x\" {\nnames = \"a\"\n}",
+			summary: "Incorrect attribute value type",
+			detail:  "field [names] must be an array",
+		},
+		{
+			name:    "too many items",
+			src:     "instance \"test::container\" \"x\" {\ntags = [\"a\", \"b\", \"c\", \"d\"]\n}",
+			summary: "Invalid value",
+			detail:  "field [tags] has 4 items, maximum is 3",
+		},
+		{
+			name:    "too few items of an optional field",
+			src:     `instance "test::network" "x" { cidr = "10.0.0.0/8", dns = ["1.1.1.1"] }`,
+			summary: "Invalid value",
+			detail:  "field [dns] has 1 items, minimum is 2",
+		},
+		{
+			name:    "more than exactly one of",
+			src:     `instance "test::network" "x" { cidr = "10.0.0.0/8", subnet = "a", gateway = "10.0.0.1" }`,
+			summary: "Conflicting attributes",
+			detail:  "only one of cidr, subnet can be set, field [subnet] conflicts with [cidr]",
+		},
+		{
+			name:    "none of exactly one of",
+			src:     `instance "test::network" "x" { gateway = "10.0.0.1" }`,
+			summary: "Missing required attribute",
+			detail:  "instance [x] must set one of: cidr, subnet",
+		},
+		{
+			name:    "none of at least one of",
+			src:     `instance "test::network" "x" { cidr = "10.0.0.0/8" }`,
+			summary: "Missing required attribute",
+			detail:  "instance [x] must set one of: dns, gateway",
+		},
+		{
+			name:    "required with",
+			src:     `instance "test::network" "x" { cidr = "10.0.0.0/8", gateway = "10.0.0.1", password = "a" }`,
+			summary: "Missing required attribute",
+			detail:  "field [password] requires [user] to be set",
+		},
+		{
+			name:    "failed validate func",
+			src:     `instance "test::network" "x" { cidr = "10.0.0.0/8", gateway = "10.0.0.1", mode = "nat" }`,
+			summary: "Invalid value",
+			detail:  "field [mode]: must be bridge or host, got nat",
+		},
+		{
+			name:    "block in a list of literals",
+			src:     "instance \"test::container\" \"x\" {\nnames = [{ a = \"b\" }]\n}",
+			summary: "Invalid value",
+			detail:  "field [names->0] cannot be a block",
+		},
+		{
+			name:    "unknown field of a list element",
+			src:     "instance \"test::container\" \"x\" {\nmounts = [{ path = \"/a\" }]\n}",
+			summary: "Invalid value",
+			detail:  "no schema field for: mounts->0->path",
+		},
+		{
+			name:    "literal in a list of blocks",
+			src:     "instance \"test::container\" \"x\" {\nmounts = [\"a\"]\n}",
+			summary: "Invalid value",
+			detail:  "field [mounts->0] must be a block",
+		},
+		{
+			name:    "missing closing bracket",
+			src:     "instance \"test::container\" \"x\" {\nnames = [\"a\",",
+			summary: "Invalid expression",
+			detail:  "invalid operand in expression",
+		},
+		{
+			name:    "expression of the wrong type",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\ninbuilt = 1 + 2\n}",
+			summary: "Incorrect attribute value type",
+			detail:  "field [inbuilt] must be a bool",
+		},
+		{
+			name:    "missing required field",
+			src:     "instance \"test::container\" \"x\" {\ninbuilt = true\n}",
+			summary: "Missing required attribute",
+			detail:  "instance [x] is missing required field: containerId",
+		},
+		{
+			name:    "conflicting fields of a list element",
+			src:     "instance \"test::container\" \"x\" {\ncontainerId = \"a\"\nmounts = [{ source = \"/a\", volume = \"b\" }]\n}",
+			summary: "Conflicting attributes",
+			detail:  "field [mounts->0->source] conflicts with [mounts->0->volume]",
+		},
+		{
+			name:    "cycle",
+			src:     "instance \"test::container\" \"x\" { containerId = instance.y.containerId }\ninstance \"test::container\" \"y\" { containerId = instance.x.containerId }",
+			summary: "Cycle in declarations",
+			detail:  "instance.x -> instance.y -> instance.x",
+		},
+		{
+			name:    "undeclared instance",
+			src:     `instance "test::container" "x" { containerId = instance.z.containerId }`,
+			summary: "Reference to undeclared instance",
+			detail:  "z",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
+
+func TestInstanceDefaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		env   string
+		field string
+		want  cty.Value
+	}{
+		{
+			name:  "default",
+			src:   `instance "test::service" "s" {}`,
+			field: "replicas",
+			want:  cty.NumberIntVal(1),
+		},
+		{
+			name:  "converted to the field type",
+			src:   `instance "test::service" "s" {}`,
+			field: "tags",
+			want:  cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("1")}),
+		},
+		{
+			name:  "set field",
+			src:   `instance "test::service" "s" { replicas = 3 }`,
+			field: "replicas",
+			want:  cty.NumberIntVal(3),
+		},
+		{
+			name:  "default func",
+			src:   `instance "test::service" "s" {}`,
+			field: "region",
+			want:  cty.StringVal("us"),
+		},
+		{
+			name:  "default func from the environment",
+			src:   `instance "test::service" "s" {}`,
+			env:   "eu",
+			field: "region",
+			want:  cty.StringVal("eu"),
+		},
+		{
+			name:  "nested block not set",
+			src:   `instance "test::service" "s" {}`,
+			field: "limits",
+			want: cty.NullVal(cty.Object(map[string]cty.Type{
+				"pidsMax": cty.Number,
+				"enabled": cty.Bool,
+			})),
+		},
+		{
+			name:  "nested block",
+			src:   `instance "test::service" "s" { limits = { enabled = false } }`,
+			field: "limits",
+			want: cty.ObjectVal(map[string]cty.Value{
+				"pidsMax": cty.NumberIntVal(10),
+				"enabled": cty.False,
+			}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" {
+				os.Setenv("SCHEMATIC_TEST_REGION", test.env)
+				defer os.Unsetenv("SCHEMATIC_TEST_REGION")
+			}
+			schem, _, err := parseSource(test.src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := schem.Instances["s"].Value().GetAttr(test.field)
+			if !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"strings"
+)
+
+const localsKeyword = "locals"
+
+// localScope holds the locals of a configuration. Each local is evaluated
+// when it is first referenced, so locals can reference each other and any
+// declaration decoded before the reference, regardless of the order they
+// are declared in.
+type localScope struct {
+	p     *Parser
+	schem *state.ParsedState
+	// decls holds the attribute declaring each local
+	decls  map[string]*ast.Attribute
+	order  []string
+	values map[string]cty.Value
+	errs   map[string]error
+	// sensitive holds the locals that reference a sensitive value
+	sensitive map[string]bool
+	// evaluating holds the locals being evaluated, innermost last
+	evaluating []string
+}
+
+// decodeLocals collects the attributes of each locals block of the form
+// locals { <NAME> = <E> ... }, without evaluating them.
+func (p *Parser) decodeLocals(blocks []*ast.Block, schem *state.ParsedState) (*localScope, diagnostics.Diagnostics) {
+	var diags diagnostics.Diagnostics
+	scope := &localScope{
+		p:         p,
+		schem:     schem,
+		decls:     make(map[string]*ast.Attribute),
+		order:     make([]string, 0),
+		values:    make(map[string]cty.Value),
+		errs:      make(map[string]error),
+		sensitive: make(map[string]bool),
+	}
+	for _, block := range blocks {
+		if err := checkBlock(block, false); err != nil {
+			diags = append(diags, diagnostics.FromError(err, block.Range(), "Invalid locals declaration")...)
+			continue
+		}
+		for _, item := range block.Body {
+			attribute, ok := item.(*ast.Attribute)
+			if !ok {
+				nested := item.(*ast.Block)
+				diags = append(diags, diagnostics.Errorf(nested.Type.Range, "Unsupported block", "locals have no block: %s", nested.Type.Lit))
+				continue
+			}
+			name := attribute.Name.Lit
+			if previous, ok := scope.decls[name]; ok {
+				diags = append(diags, diagnostics.Errorf(
+					attribute.Name.Range,
+					"Duplicate local declaration",
+					"local [%s] is already declared at %s",
+					name,
+					previous.Name.Range,
+				))
+				continue
+			}
+			scope.decls[name] = attribute
+			scope.order = append(scope.order, name)
+		}
+	}
+	return scope, diags
+}
+
+// resolve returns the value of a local, evaluating it if it has not been
+// already. A local that is invalid returns the same error each time it is
+// referenced, so that it can be reported once.
+func (s *localScope) resolve(name string, rng diagnostics.Range) (cty.Value, error) {
+	if value, ok := s.values[name]; ok {
+		return value, nil
+	} else if err, ok := s.errs[name]; ok {
+		return cty.NilVal, err
+	}
+	decl, ok := s.decls[name]
+	if !ok {
+		return cty.NilVal, diagnostics.Errorf(rng, "Reference to undeclared local", "no such local: %s", name)
+	}
+	for i, evaluating := range s.evaluating {
+		if evaluating == name {
+			cycle := append(append([]string{}, s.evaluating[i:]...), name)
+			return cty.NilVal, diagnostics.Errorf(
+				decl.Name.Range,
+				"Cycle in locals",
+				"local [%s] refers to itself: %s%s",
+				name,
+				localReferencePrefix,
+				strings.Join(cycle, " -> "+localReferencePrefix),
+			)
+		}
+	}
+	s.evaluating = append(s.evaluating, name)
+	value, sensitive, err := s.p.evaluateSensitive(decl.Value, s.schem)
+	s.evaluating = s.evaluating[:len(s.evaluating)-1]
+	if err != nil {
+		s.errs[name] = err
+		return cty.NilVal, err
+	}
+	s.values[name] = value
+	s.sensitive[name] = sensitive
+	return value, nil
+}
+
+// evaluateAll evaluates every local that has not been referenced, and
+// returns the errors of all invalid locals.
+func (s *localScope) evaluateAll() diagnostics.Diagnostics {
+	var diags diagnostics.Diagnostics
+	for _, name := range s.order {
+		decl := s.decls[name]
+		if _, err := s.resolve(name, decl.Name.Range); err != nil {
+			diags = append(diags, diagnostics.FromError(err, decl.Value.Range(), "Invalid local")...)
+		}
+	}
+	return diags
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+func TestLocals(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		expr string
+		want cty.Value
+	}{
+		{
+			name: "declared before use",
+			src:  "locals {\nprefix = \"svc\"\n}",
+			expr: "local.prefix",
+			want: cty.StringVal("svc"),
+		},
+		{
+			name: "declared after use",
+			src:  "locals {\nid = \"${local.prefix}_1\"\nprefix = \"svc\"\n}",
+			expr: "local.id",
+			want: cty.StringVal("svc_1"),
+		},
+		{
+			name: "across blocks",
+			src:  "locals {\na = local.b + 1\n}\nlocals {\nb = var.n\n}\nvariable \"n\" = 2",
+			expr: "local.a",
+			want: cty.NumberIntVal(3),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := outputValue(test.src, test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLocalsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "refers to itself",
+			src:     "locals {\na = local.a\n}",
+			summary: "Cycle in locals",
+			detail:  "local [a] refers to itself: local.a -> local.a",
+		},
+		{
+			name:    "cycle through other locals",
+			src:     "locals {\na = local.b\nb = local.c\nc = local.a\n}",
+			summary: "Cycle in locals",
+			detail:  "local [a] refers to itself: local.a -> local.b -> local.c -> local.a",
+		},
+		{
+			name:    "duplicate",
+			src:     "locals {\na = 1\n}\nlocals {\na = 2\n}",
+			summary: "Duplicate local declaration",
+			detail:  "local [a] is already declared at test.schm:2:1",
+		},
+		{
+			name:    "nested block",
+			src:     "locals {\nblock {\n}\n}",
+			summary: "Unsupported block",
+			detail:  "locals have no block: block",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := parseSource(test.src, nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
+
+func TestLocalsCycleReportedOnce(t *testing.T) {
+	_, _, err := parseSource("locals {\na = local.b\nb = local.a\n}\noutput \"o\" {\nvalue = local.a\n}", nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	cycles := 0
+	for _, summary := range summaries(err) {
+		if summary == "Cycle in locals" {
+			cycles++
+		}
+	}
+	if cycles != 1 {
+		t.Errorf("got %d cycle diagnostics in %v, want 1", cycles, summaries(err))
+	}
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	moduleKeyword     = "module"
+	moduleSourceField = "source"
+)
+
+// decodeModule decodes a module block of the form
+// module "name" { source = "<PATH>" <VARIABLE> = <E> ... }, loading the
+// configuration at the source path with each input assigned to the variable
+// of the same name.
+func (p *Parser) decodeModule(block *ast.Block, schem *state.ParsedState) (*state.Module, error) {
+	if err := checkBlock(block, false, "name"); err != nil {
+		return nil, err
+	}
+	name := block.Labels[0]
+	newModule := &state.Module{
+		Name:   name.Lit,
+		Inputs: make(map[string]cty.Value),
+	}
+	var sourceRange diagnostics.Range
+	inputs := make(map[string]*ast.Attribute)
+	for _, item := range block.Body {
+		attribute, ok := item.(*ast.Attribute)
+		if !ok {
+			nested := item.(*ast.Block)
+			return nil, diagnostics.Errorf(nested.Type.Range, "Unsupported block", "module [%s] has no block: %s", newModule.Name, nested.Type.Lit)
+		}
+		field := attribute.Name.Lit
+		if field == moduleSourceField {
+			str, ok := attribute.Value.(*ast.StringExpr)
+			if !ok {
+				return nil, diagnostics.Errorf(attribute.Value.Range(), "Invalid value", "module [%s] source must be a string", newModule.Name)
+			}
+			newModule.Source = str.Token.Lit
+			sourceRange = attribute.Value.Range()
+			continue
+		}
+		value, err := p.evaluate(attribute.Value, schem)
+		if err != nil {
+			return nil, err
+		}
+		newModule.Inputs[field] = value
+		inputs[field] = attribute
+	}
+	if newModule.Source == "" {
+		return nil, diagnostics.Errorf(name.Range, "Missing source", "module [%s] is missing a %s declaration", newModule.Name, moduleSourceField)
+	}
+	if !strings.HasPrefix(newModule.Source, "./") && !strings.HasPrefix(newModule.Source, "../") {
+		return nil, diagnostics.Errorf(sourceRange, "Invalid module source", "module source must be a local path starting with ./ or ../: %s", newModule.Source)
+	}
+	overrides, err := moduleInputOverrides(newModule, inputs)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(filepath.Dir(name.Range.Filename), newModule.Source)
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, wrapError(err, sourceRange, "Invalid module source")
+	}
+	for _, configPath := range p.configPaths {
+		if configPath == absPath {
+			return nil, diagnostics.Errorf(sourceRange, "Module cycle", "module [%s] includes the configuration it is declared in: %s", newModule.Name, newModule.Source)
+		}
+	}
+	child := NewParser(nil)
+	child.overrides = overrides
+	child.sources = p.sources
+	child.configPaths = append([]string{}, p.configPaths...)
+	childState, _, err := child.ParseConfig(path)
+	if childState == nil {
+		return nil, wrapError(err, sourceRange, "Invalid module source")
+	} else if err != nil {
+		return nil, err
+	}
+	newModule.ParsedState = childState
+	p.warnings = append(p.warnings, child.warnings...)
+	return newModule, checkModuleInputs(newModule, inputs)
+}
+
+// moduleInputOverrides converts the inputs of a module into the values of
+// the variables of its configuration.
+func moduleInputOverrides(module *state.Module, inputs map[string]*ast.Attribute) (VariableOverrides, error) {
+	overrides := make(VariableOverrides)
+	for name, value := range module.Inputs {
+		baseType := valueBaseType(value)
+		if baseType == schematic.TypeInvalid {
+			return nil, diagnostics.Errorf(
+				inputs[name].Value.Range(),
+				"Invalid module input",
+				"input [%s] of module [%s] must be a string, number, bool, array or block",
+				name,
+				module.Name,
+			)
+		}
+		overrides[name] = &VariableOverride{
+			Value:    value,
+			BaseType: baseType,
+			Source:   "input of module " + module.Name,
+		}
+	}
+	return overrides, nil
+}
+
+// checkModuleInputs checks each input of a module is assigned to a variable
+// declared by its configuration.
+func checkModuleInputs(module *state.Module, inputs map[string]*ast.Attribute) error {
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := module.ParsedState.Variables[name]; !ok {
+			return diagnostics.Errorf(inputs[name].Name.Range, "Unsupported input", "module [%s] has no variable: %s", module.Name, name)
+		}
+	}
+	return nil
+}
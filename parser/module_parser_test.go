@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+// childModule is a module configuration with typed variables, outputs
+// derived from them, a sensitive output and an output read from a data
+// source in its own directory
+var childModule = map[string]string{
+	"modules/svc/main.schm": `variable "clsid" {
+  type = int
+}
+
+variable "prefix" {
+  default = "svc"
+}
+
+variable "names" {
+  type    = list(string)
+  default = []
+}
+
+data "file" "limits" {
+  reference = "L::limits.json"
+  schema = {
+    pidsMax = 0
+  }
+}
+
+output "container" {
+  value = "${var.prefix}_${var.clsid}"
+}
+
+output "double" {
+  value = var.clsid * 2
+}
+
+output "count" {
+  value = length(var.names)
+}
+
+output "pids" {
+  value = data.file.limits.pidsMax
+}
+
+output "secret" {
+  value     = "hidden"
+  sensitive = true
+}
+`,
+	"modules/svc/limits.json": `{"pidsMax": 30}`,
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want cty.Value
+	}{
+		{
+			name: "input converted to the variable type",
+			src:  "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = \"85831\"\n}\noutput \"o\" {\nvalue = module.svc.container\n}\n",
+			want: cty.StringVal("svc_85831"),
+		},
+		{
+			name: "input over a default",
+			src:  "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 1\nprefix = \"app\"\n}\noutput \"o\" {\nvalue = module.svc.container\n}\n",
+			want: cty.StringVal("app_1"),
+		},
+		{
+			name: "list input",
+			src:  "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 1\nnames = [\"a\", \"b\"]\n}\noutput \"o\" {\nvalue = module.svc.count\n}\n",
+			want: cty.NumberIntVal(2),
+		},
+		{
+			name: "input from the parent",
+			src:  "variable \"id\" = 7\nmodule \"svc\" {\nsource = \"./modules/svc\"\nclsid = var.id * 2\n}\noutput \"o\" {\nvalue = module.svc.container\n}\n",
+			want: cty.StringVal("svc_14"),
+		},
+		{
+			name: "number output",
+			src:  "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 4\n}\noutput \"o\" {\nvalue = module.svc.double\n}\n",
+			want: cty.NumberIntVal(8),
+		},
+		{
+			name: "data read from the module directory",
+			src:  "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 1\n}\noutput \"o\" {\nvalue = module.svc.pids\n}\n",
+			want: cty.NumberIntVal(30),
+		},
+		{
+			name: "referenced before declared",
+			src:  "output \"o\" {\nvalue = module.svc.container\n}\nmodule \"svc\" {\nsource = \"./modules/svc\"\nclsid = 2\n}\n",
+			want: cty.StringVal("svc_2"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfig(t, dir, childModule)
+			writeConfig(t, dir, map[string]string{"main.schm": test.src})
+			schem, _, err := NewParser(nil).ParseConfig(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schem.Outputs["o"].Value; !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "missing source",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nclsid = 1\n}\n"},
+			summary: "Missing source",
+			detail:  "module [svc] is missing a source declaration",
+		},
+		{
+			name:    "source without a relative prefix",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nsource = \"modules/svc\"\n}\n"},
+			summary: "Invalid module source",
+			detail:  "module source must be a local path starting with ./ or ../: modules/svc",
+		},
+		{
+			name:    "undeclared input",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 1\nport = 80\n}\n"},
+			summary: "Unsupported input",
+			detail:  "module [svc] has no variable: port",
+		},
+		{
+			name:    "input of the wrong type",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = \"many\"\n}\n"},
+			summary: "Invalid variable value",
+			detail:  "variable [clsid] value from input of module svc is not a valid int",
+		},
+		{
+			name:    "missing input",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nsource = \"./modules/svc\"\n}\n"},
+			summary: "Missing variable value",
+			detail:  "no value for required variable [clsid]",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.schm":   "module \"a\" {\nsource = \"./a\"\n}\n",
+				"a/main.schm": "module \"b\" {\nsource = \"../\"\n}\n",
+			},
+			summary: "Module cycle",
+			detail:  "module [b] includes the configuration it is declared in: ../",
+		},
+		{
+			name:    "undeclared output",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 1\n}\noutput \"o\" {\nvalue = module.svc.missing\n}\n"},
+			summary: "Reference to undeclared output",
+			detail:  "module [svc] has no output: missing",
+		},
+		{
+			name:    "sensitive output",
+			files:   map[string]string{"main.schm": "module \"svc\" {\nsource = \"./modules/svc\"\nclsid = 1\n}\noutput \"o\" {\nvalue = module.svc.secret\n}\n"},
+			summary: "Output refers to sensitive values",
+			detail:  "output [o] refers to a sensitive variable, local or module output",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfig(t, dir, childModule)
+			writeConfig(t, dir, test.files)
+			_, _, err := NewParser(nil).ParseConfig(dir)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+)
+
+const (
+	outputKeyword          = "output"
+	outputValueField       = "value"
+	outputSensitiveField   = "sensitive"
+	outputDescriptionField = "description"
+)
+
+// decodeOutput decodes an output block of the form
+// output "name" { value = <E> sensitive = <B> description = <B> },
+// evaluating its value against the other declarations of the configuration.
+func (p *Parser) decodeOutput(block *ast.Block, schem *state.ParsedState) (*state.Output, error) {
+	if err := checkBlock(block, false, "name"); err != nil {
+		return nil, err
+	}
+	name := block.Labels[0]
+	newOutput := &state.Output{Name: name.Lit}
+	hasValue, sensitiveValue := false, false
+	var valueRange diagnostics.Range
+	for _, item := range block.Body {
+		attribute, ok := item.(*ast.Attribute)
+		if !ok {
+			nested := item.(*ast.Block)
+			return nil, diagnostics.Errorf(nested.Type.Range, "Unsupported block", "output [%s] has no block: %s", newOutput.Name, nested.Type.Lit)
+		}
+		field := attribute.Name.Lit
+		switch field {
+		case outputValueField:
+			value, sensitive, err := p.evaluateSensitive(attribute.Value, schem)
+			if err != nil {
+				return nil, err
+			}
+			newOutput.Value = value
+			hasValue, sensitiveValue = true, sensitive
+			valueRange = attribute.Value.Range()
+		case outputSensitiveField:
+			value, baseType, err := p.decodeVariableValue(field, attribute.Value)
+			if err != nil || baseType != schematic.TypeBool {
+				return nil, diagnostics.Errorf(attribute.Value.Range(), "Invalid value", "output [%s] sensitive must be a boolean", newOutput.Name)
+			}
+			newOutput.Sensitive = value.True()
+		case outputDescriptionField:
+			str, ok := attribute.Value.(*ast.StringExpr)
+			if !ok {
+				return nil, diagnostics.Errorf(attribute.Value.Range(), "Invalid value", "output [%s] description must be a string", newOutput.Name)
+			}
+			newOutput.Description = str.Token.Lit
+		default:
+			return nil, diagnostics.Errorf(attribute.Name.Range, "Unsupported field", "output [%s] has no field: %s", newOutput.Name, field)
+		}
+	}
+	if !hasValue {
+		return nil, diagnostics.Errorf(name.Range, "Missing value", "output [%s] is missing a %s declaration", newOutput.Name, outputValueField)
+	} else if sensitiveValue && !newOutput.Sensitive {
+		return nil, diagnostics.Errorf(
+			valueRange,
+			"Output refers to sensitive values",
+			"output [%s] refers to a sensitive variable, local or module output, set %s = true so that it is only displayed when requested by name",
+			newOutput.Name,
+			outputSensitiveField,
+		)
+	}
+	return newOutput, nil
+}
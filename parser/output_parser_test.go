@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+func TestOutputs(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		want        cty.Value
+		sensitive   bool
+		description string
+	}{
+		{
+			name: "value",
+			src:  "variable \"n\" = 4\noutput \"o\" {\nvalue = var.n * 2\n}\n",
+			want: cty.NumberIntVal(8),
+		},
+		{
+			name:        "sensitive with a description",
+			src:         "output \"o\" {\nvalue = \"abc\"\nsensitive = true\ndescription = \"A token\"\n}\n",
+			want:        cty.StringVal("abc"),
+			sensitive:   true,
+			description: "A token",
+		},
+		{
+			name: "declared before its references",
+			src:  "output \"o\" {\nvalue = var.s\n}\nvariable \"s\" = \"svc\"\n",
+			want: cty.StringVal("svc"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := parseWithOverrides(test.src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := schem.Outputs["o"]
+			if !output.Value.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", output.Value, test.want)
+			}
+			if output.Sensitive != test.sensitive || output.Description != test.description {
+				t.Errorf("got sensitive %v and description %q", output.Sensitive, output.Description)
+			}
+		})
+	}
+}
+
+func TestOutputSensitive(t *testing.T) {
+	secret := "variable \"token\" {\nvalue = \"abc\"\nsensitive = true\n}\n"
+	tests := []struct {
+		name      string
+		src       string
+		sensitive bool
+		wantErr   bool
+	}{
+		{
+			name:      "declared sensitive",
+			src:       secret + "output \"o\" {\nvalue = var.token\nsensitive = true\n}\n",
+			sensitive: true,
+		},
+		{
+			name:    "sensitive variable",
+			src:     secret + "output \"o\" {\nvalue = var.token\n}\n",
+			wantErr: true,
+		},
+		{
+			name:    "through a local",
+			src:     secret + "locals {\nheader = \"Bearer ${var.token}\"\n}\noutput \"o\" {\nvalue = local.header\n}\n",
+			wantErr: true,
+		},
+		{
+			name:    "in a function call",
+			src:     secret + "output \"o\" {\nvalue = upper(var.token)\n}\n",
+			wantErr: true,
+		},
+		{
+			name: "other variables",
+			src:  secret + "variable \"name\" = \"svc\"\noutput \"o\" {\nvalue = var.name\n}\n",
+		},
+		{
+			name:      "sensitive without a sensitive value",
+			src:       "output \"o\" {\nvalue = 1\nsensitive = true\n}\n",
+			sensitive: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, _, err := parseSource(test.src, nil)
+			if test.wantErr {
+				if !hasDiagnostic(err, "Output refers to sensitive values", "output [o] refers to a sensitive variable") {
+					t.Errorf("got %v, want Output refers to sensitive values", err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := schem.Outputs["o"].Sensitive; got != test.sensitive {
+				t.Errorf("got sensitive %v, want %v", got, test.sensitive)
+			}
+		})
+	}
+}
+
+func TestOutputErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "missing value",
+			src:     "output \"o\" {\ndescription = \"none\"\n}\n",
+			summary: "Missing value",
+			detail:  "output [o] is missing a value declaration",
+		},
+		{
+			name:    "sensitive is not a boolean",
+			src:     "output \"o\" {\nvalue = 1\nsensitive = \"yes\"\n}\n",
+			summary: "Invalid value",
+			detail:  "output [o] sensitive must be a boolean",
+		},
+		{
+			name:    "description is not a string",
+			src:     "output \"o\" {\nvalue = 1\ndescription = 2\n}\n",
+			summary: "Invalid value",
+			detail:  "output [o] description must be a string",
+		},
+		{
+			name:    "unsupported field",
+			src:     "output \"o\" {\nvalue = 1\ntype = int\n}\n",
+			summary: "Unsupported field",
+			detail:  "output [o] has no field: type",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseWithOverrides(test.src, nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
@@ -1,52 +1,390 @@
 package parser
 
 import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
 	"github.com/EngineersBox/Schematic/state"
 	"io"
 	"strings"
 )
 
 type Parser struct {
-	s   *Scanner
-	buf struct {
-		tok Token  // last read token
-		lit string // last read literal
-		n   int    // buffer size (max=1)
+	s         *Scanner
+	overrides VariableOverrides
+	prompt    VariablePrompt
+	// iterators holds the symbols declared by the enclosing template for
+	// directives
+	iterators map[string]bool
+	// sources holds the source of each file read by ParseFiles, including
+	// those of modules
+	sources map[string][]byte
+	// configPaths holds the absolute path of each configuration being
+	// loaded, from the root to the innermost module
+	configPaths []string
+	// locals holds the locals of the configuration being decoded
+	locals *localScope
+	// blocks holds the blocks of the configuration that are decoded when
+	// first referenced
+	blocks *blockScope
+	// warnings holds the warnings of the declarations decoded, which do not
+	// prevent a declaration from being decoded
+	warnings diagnostics.Diagnostics
+	// trivia holds the whitespace and comments read since the last token
+	trivia strings.Builder
+	// depth is the number of braces opened and not yet closed by the tokens
+	// read since the start of the current top-level declaration
+	depth int
+	buf   struct {
+		tok     Token                   // last read token
+		lit     string                  // last read literal
+		text    string                  // source text of the last read token
+		leading string                  // trivia preceding the last read token
+		rng     diagnostics.Range       // source range of the last read token
+		illegal *diagnostics.Diagnostic // reason the last read token is ILLEGAL
+		n       int                     // buffer size (max=1)
 	}
 }
 
-// NewParser returns a new instance of Parser.
+// NewParser returns a new instance of Parser. The reader is only used by
+// Parse and ParseFile, it may be nil when parsing files with ParseFiles.
 func NewParser(r io.Reader) *Parser {
 	return &Parser{s: NewScanner(r)}
 }
 
-// Parse parses tokens into a map of declarations
+// SetFilename sets the name of the file being parsed, used in the source
+// range of diagnostics.
+func (p *Parser) SetFilename(filename string) {
+	p.s.filename = filename
+}
+
+// Parse parses a file and decodes its blocks into a map of declarations. When
+// a declaration is invalid the parser recovers at the next top-level
+// declaration, so every problem in the file is reported at once. Errors are
+// returned as diagnostics.Diagnostics along with the declarations that were
+// decoded.
 func (p *Parser) Parse() (*state.ParsedState, error) {
-	schem := &state.ParsedState{
+	file, err := p.ParseFile()
+	diags := diagnostics.FromError(err, file.Range(), "Invalid file")
+	schem := newParsedState()
+	diags = append(diags, p.decodeBlocks(file.Blocks, schem)...)
+	diags = append(diags, p.warnings...)
+	diags.Sort()
+	if diags.HasErrors() {
+		return schem, diags
+	}
+	return schem, nil
+}
+
+// Warnings returns the warnings found while decoding, such as those of the
+// ValidateFunc of an instance schema. They are included in the diagnostics
+// returned when parsing fails.
+func (p *Parser) Warnings() diagnostics.Diagnostics {
+	return p.warnings
+}
+
+func newParsedState() *state.ParsedState {
+	return &state.ParsedState{
 		Variables: make(map[string]*state.Variable),
 		Instances: make(map[string]*state.InstanceData),
+		Captures:  make(map[string]*state.Capture),
+		Data:      make(map[string]*state.Data),
+		Modules:   make(map[string]*state.Module),
+		Outputs:   make(map[string]*state.Output),
 	}
+}
+
+// ParseFile parses tokens into a syntax tree, without decoding the blocks.
+// Declarations with syntax errors are left out of the tree and reported as
+// diagnostics.Diagnostics, along with the blocks that were parsed.
+func (p *Parser) ParseFile() (*ast.File, error) {
+	file := &ast.File{Filename: p.s.filename}
+	var diags diagnostics.Diagnostics
 	for {
-		token, _ := p.scanIgnoreWhitespace(false)
-		if token == EOF {
+		tok, lit := p.scanIgnoreWhitespace(false)
+		if tok == EOF {
+			file.EOF = p.token()
 			break
 		}
-		switch token {
-		case VARIABLE:
-			name, newVar, err := p.parseVariable()
-			if err != nil {
-				return nil, err
-			}
-			schem.Variables[name] = newVar
-		case INSTANCE:
-			name, newInstance, err := p.parseInstance(schem)
-			if err != nil {
-				return nil, err
-			}
-			schem.Instances[name] = state.NewInstanceData(newInstance, nil)
+		declStart := p.rng().Start
+		p.depth = 0
+		if !isDeclaration(tok) {
+			err := p.errorf(
+				"Unexpected token",
+				"expected a variable, locals, instance, capture, data, module or output declaration, got: %s",
+				lit,
+			)
+			diags = append(diags, diagnostics.FromError(err, p.rng(), "Unexpected token")...)
+			p.recover(declStart)
+			continue
+		}
+		block, err := p.parseBlock(p.token())
+		if err != nil {
+			diags = append(diags, diagnostics.FromError(err, p.rng(), "Invalid "+lit+" declaration")...)
+			p.recover(declStart)
+			continue
 		}
+		file.Blocks = append(file.Blocks, block)
 	}
-	return schem, nil
+	if diags.HasErrors() {
+		return file, diags
+	}
+	return file, nil
+}
+
+// decodeBlocks decodes each block into a declaration. Variables are decoded
+// first so that they can be referenced from any block and outputs last so
+// that they can reference any block. Locals are evaluated and instances,
+// data and modules are decoded when first referenced, so that they can
+// reference declarations made after them or in another file. Those that are
+// never referenced are decoded in the order they are declared.
+func (p *Parser) decodeBlocks(blocks []*ast.Block, schem *state.ParsedState) diagnostics.Diagnostics {
+	var diags diagnostics.Diagnostics
+	declared := make(declarations)
+	var variables, locals, outputs, others []*ast.Block
+	for _, block := range blocks {
+		switch strings.ToLower(block.Type.Lit) {
+		case variableKeyword:
+			variables = append(variables, block)
+		case localsKeyword:
+			locals = append(locals, block)
+		case outputKeyword:
+			outputs = append(outputs, block)
+		default:
+			others = append(others, block)
+		}
+	}
+	for _, block := range variables {
+		diags = append(diags, p.decodeBlock(block, schem, declared)...)
+	}
+	p.warnings = append(p.warnings, p.undeclaredOverrides(variables)...)
+	var localDiags diagnostics.Diagnostics
+	p.locals, localDiags = p.decodeLocals(locals, schem)
+	diags = append(diags, localDiags...)
+	p.blocks = newBlockScope(p, others, schem, declared)
+	for _, block := range others {
+		diags = append(diags, p.blocks.decode(block)...)
+	}
+	for _, block := range outputs {
+		diags = append(diags, p.decodeBlock(block, schem, declared)...)
+	}
+	diags = append(diags, p.locals.evaluateAll()...)
+	// An invalid local or declaration is reported by each declaration
+	// referencing it
+	return diags.Deduplicate()
+}
+
+// blockScope holds the instance, capture, data and module blocks of a
+// configuration, so that each can be decoded when first referenced.
+type blockScope struct {
+	p        *Parser
+	schem    *state.ParsedState
+	declared declarations
+	// blocks holds the first block of each name, keyed by blockKey
+	blocks map[string]*ast.Block
+	// diags holds the diagnostics of each decoded block
+	diags map[*ast.Block]diagnostics.Diagnostics
+	// decoding holds the blocks being decoded, innermost last
+	decoding []*ast.Block
+}
+
+func newBlockScope(p *Parser, blocks []*ast.Block, schem *state.ParsedState, declared declarations) *blockScope {
+	scope := &blockScope{
+		p:        p,
+		schem:    schem,
+		declared: declared,
+		blocks:   make(map[string]*ast.Block),
+		diags:    make(map[*ast.Block]diagnostics.Diagnostics),
+	}
+	for _, block := range blocks {
+		if len(block.Labels) == 0 {
+			continue
+		}
+		if _, ok := scope.blocks[blockKey(block)]; !ok {
+			scope.blocks[blockKey(block)] = block
+		}
+	}
+	return scope
+}
+
+// decode decodes a block if it has not been already, returning its
+// diagnostics.
+func (s *blockScope) decode(block *ast.Block) diagnostics.Diagnostics {
+	if diags, ok := s.diags[block]; ok {
+		return diags
+	}
+	s.decoding = append(s.decoding, block)
+	diags := s.p.decodeBlock(block, s.schem, s.declared)
+	s.decoding = s.decoding[:len(s.decoding)-1]
+	s.diags[block] = diags
+	return diags
+}
+
+// resolve decodes the declaration of the given keyword and name referenced
+// from an expression. A declaration that is invalid returns its first
+// error, so that it is reported once. Names that are not declared are left
+// for the reference to report.
+func (s *blockScope) resolve(keyword string, name string, rng diagnostics.Range) error {
+	block, ok := s.blocks[keyword+"."+name]
+	if !ok {
+		return nil
+	}
+	for i, decoding := range s.decoding {
+		if decoding != block {
+			continue
+		}
+		cycle := make([]string, 0, len(s.decoding)-i+1)
+		for _, b := range append(s.decoding[i:], block) {
+			cycle = append(cycle, strings.ToLower(b.Type.Lit)+"."+b.Labels[len(b.Labels)-1].Lit)
+		}
+		return diagnostics.Errorf(
+			rng,
+			"Cycle in declarations",
+			"%s [%s] refers to itself: %s",
+			keyword,
+			name,
+			strings.Join(cycle, " -> "),
+		)
+	}
+	for _, diag := range s.decode(block) {
+		if diag.Severity == diagnostics.SeverityError {
+			return diag
+		}
+	}
+	return nil
+}
+
+// decodeBlock decodes a block into a declaration of the parsed state
+func (p *Parser) decodeBlock(block *ast.Block, schem *state.ParsedState, declared declarations) diagnostics.Diagnostics {
+	var err error
+	switch keyword := strings.ToLower(block.Type.Lit); keyword {
+	case variableKeyword:
+		var newVar *state.Variable
+		newVar, err = p.decodeVariable(block, schem)
+		if err == nil {
+			err = declared.declare(keyword, block)
+		}
+		if err == nil {
+			schem.Variables[newVar.Name] = newVar
+		}
+	case instanceKeyword:
+		var newInstance *state.InstanceState
+		newInstance, err = p.decodeInstance(block, schem)
+		if err == nil {
+			err = declared.declare(keyword, block)
+		}
+		if err == nil {
+			schem.Instances[newInstance.ID] = state.NewInstanceData(newInstance, nil)
+		}
+	case captureKeyword:
+		var newCapture *state.Capture
+		newCapture, err = p.decodeCapture(block, schem)
+		if err == nil {
+			err = declared.declare(keyword, block)
+		}
+		if err == nil {
+			schem.Captures[newCapture.Name] = newCapture
+		}
+	case dataKeyword:
+		var newData *state.Data
+		newData, err = p.decodeData(block, schem)
+		if err == nil {
+			err = declared.declare(keyword, block)
+		}
+		if err == nil {
+			schem.Data[newData.Type+"."+newData.Name] = newData
+		}
+	case moduleKeyword:
+		var newModule *state.Module
+		newModule, err = p.decodeModule(block, schem)
+		if err == nil {
+			err = declared.declare(keyword, block)
+		}
+		if err == nil {
+			schem.Modules[newModule.Name] = newModule
+		}
+	case outputKeyword:
+		var newOutput *state.Output
+		newOutput, err = p.decodeOutput(block, schem)
+		if err == nil {
+			err = declared.declare(keyword, block)
+		}
+		if err == nil {
+			schem.Outputs[newOutput.Name] = newOutput
+		}
+	}
+	return diagnostics.FromError(err, block.Range(), "Invalid "+block.Type.Lit+" declaration")
+}
+
+// declarations holds the name of each decoded declaration, keyed by its
+// keyword and name.
+type declarations map[string]*ast.Token
+
+// declare records the name of a declaration, which is its last label. If
+// the name is already declared the error points at both declarations.
+func (d declarations) declare(keyword string, block *ast.Block) error {
+	name := block.Labels[len(block.Labels)-1]
+	key := blockKey(block)
+	if previous, ok := d[key]; ok {
+		return diagnostics.Errorf(
+			name.Range,
+			"Duplicate "+keyword+" declaration",
+			"%s [%s] is already declared at %s",
+			keyword,
+			name.Lit,
+			previous.Range,
+		)
+	}
+	d[key] = name
+	return nil
+}
+
+// checkBlock checks the block has a label for each of the given names, and
+// is only in the shorthand form if permitted.
+func checkBlock(block *ast.Block, shorthand bool, labels ...string) error {
+	keyword := strings.ToLower(block.Type.Lit)
+	if len(block.Labels) < len(labels) {
+		rng := block.Type.Range
+		if len(block.Labels) > 0 {
+			rng = block.Labels[len(block.Labels)-1].Range
+		}
+		missing := labels[len(block.Labels)]
+		return diagnostics.Errorf(rng, "Missing "+missing, "%s declaration is missing a %s", keyword, missing)
+	} else if len(block.Labels) > len(labels) {
+		extra := block.Labels[len(labels)]
+		return diagnostics.Errorf(extra.Range, "Extraneous label", "unexpected label in %s declaration: %s", keyword, extra.Text)
+	} else if block.Value != nil && !shorthand {
+		return diagnostics.Errorf(block.Equals.Range, "Missing open brace", "missing open brace in %s declaration: %s", keyword, block.Labels[len(block.Labels)-1].Lit)
+	}
+	return nil
+}
+
+// isDeclaration returns true if the token starts a top-level declaration
+func isDeclaration(tok Token) bool {
+	return tok == VARIABLE || tok == INSTANCE || tok == CAPTURE || tok == DATA || tok == MODULE || tok == OUTPUT || tok == LOCALS
+}
+
+// recover skips tokens up to the next top-level declaration after the one
+// starting at declStart, leaving its keyword on the buffer. A declaration is
+// only recognised when its keyword is outside of any braces, so that fields
+// sharing a name with a keyword are skipped.
+func (p *Parser) recover(declStart diagnostics.Pos) {
+	if p.buf.n == 0 && p.atDeclaration(declStart) {
+		p.unscan()
+		return
+	}
+	for {
+		tok, _ := p.scanIgnoreWhitespace(false)
+		if tok == EOF || p.atDeclaration(declStart) {
+			p.unscan()
+			return
+		}
+	}
+}
+
+// atDeclaration returns true if the last read token is the keyword of a
+// top-level declaration after declStart.
+func (p *Parser) atDeclaration(declStart diagnostics.Pos) bool {
+	return isDeclaration(p.buf.tok) && p.depth <= 0 && p.rng().Start.Byte > declStart.Byte
 }
 
 // scan returns the next token from the underlying scanner.
@@ -59,41 +397,98 @@ func (p *Parser) scan(returnOnNL bool) (tok Token, lit string) {
 	}
 
 	// Otherwise read the next token from the scanner.
-	tok, lit = p.s.Scan(returnOnNL)
+	tok, lit, rng := p.s.Scan(returnOnNL)
 
 	// Save it to the buffer in case we unscan later.
-	p.buf.tok, p.buf.lit = tok, lit
-
-	return
-}
+	p.buf.tok, p.buf.lit, p.buf.rng = tok, lit, rng
+	p.buf.text = p.s.Text()
+	p.buf.illegal = p.s.Illegal(rng)
+	switch tok {
+	case OPENBRACE:
+		p.depth++
+	case CLOSEDBRACE:
+		p.depth--
+	}
 
-func (p *Parser) scanLine() (tokens []Token, literals []string) {
-	for {
-		tok, lit := p.scan(true)
-		if tok == EOF {
-			break
-		}
-		if strings.ContainsRune(lit, '\n') {
-			break
-		}
-		if tok != WS {
-			tokens = append(tokens, tok)
-			literals = append(literals, lit)
-		}
+	// Trivia is attached to the token following it
+	p.buf.leading = ""
+	if isTrivia(tok) {
+		p.trivia.WriteString(p.buf.text)
+	} else {
+		p.buf.leading = p.trivia.String()
+		p.trivia.Reset()
 	}
+
 	return
 }
 
-// scanIgnoreWhitespace scans the next non-whitespace tokens.
+// scanIgnoreWhitespace scans the next token that is not whitespace or a
+// comment.
 func (p *Parser) scanIgnoreWhitespace(returnOnNL bool) (tok Token, lit string) {
 	for {
 		tok, lit = p.scan(returnOnNL)
-		if (returnOnNL && strings.ContainsRune(lit, '\n')) || tok != WS {
+		if (returnOnNL && strings.ContainsRune(lit, '\n')) || !isTrivia(tok) {
 			break
 		}
 	}
 	return
 }
 
+// isTrivia returns true if the token has no meaning to the parser, these are
+// kept in the token stream so that they can be preserved when formatting.
+func isTrivia(tok Token) bool { return tok == WS || tok == COMMENT }
+
 // unscan pushes the previously read token back onto the buffer.
 func (p *Parser) unscan() { p.buf.n = 1 }
+
+// rng returns the source range of the last read token.
+func (p *Parser) rng() diagnostics.Range { return p.buf.rng }
+
+// token returns the last read token as a node of the syntax tree
+func (p *Parser) token() *ast.Token {
+	return &ast.Token{
+		Leading: p.buf.leading,
+		Text:    p.buf.text,
+		Lit:     p.buf.lit,
+		Range:   p.buf.rng,
+	}
+}
+
+// errorf creates an error diagnostic for the last read token. If the token
+// is ILLEGAL and the scanner knows why, that is reported instead.
+func (p *Parser) errorf(summary string, format string, args ...interface{}) error {
+	if p.buf.tok == ILLEGAL && p.buf.illegal != nil {
+		return p.buf.illegal
+	}
+	return diagnostics.Errorf(p.rng(), summary, format, args...)
+}
+
+// scanSigned combines a MINUS token and the NUMBER directly following it into
+// a single negative NUMBER, any other token is returned as is. A MINUS that
+// is not directly followed by a digit is left as the last read token, so
+// that errors refer to its position.
+func (p *Parser) scanSigned(tok Token, lit string) (Token, string) {
+	if tok != MINUS || !isDigit(p.s.peek()) {
+		return tok, lit
+	}
+	start, leading, text := p.rng(), p.buf.leading, p.buf.text
+	tok, lit = p.scan(false)
+	if tok != NUMBER {
+		p.unscan()
+		return MINUS, "-"
+	}
+	p.buf.rng = start.Join(p.rng())
+	p.buf.leading = leading
+	p.buf.text = text + p.buf.text
+	p.buf.lit = "-" + lit
+	return NUMBER, p.buf.lit
+}
+
+// wrapError converts an error into an error diagnostic for the given range,
+// errors that are already diagnostics are returned as is.
+func wrapError(err error, subject diagnostics.Range, summary string) error {
+	if _, ok := err.(*diagnostics.Diagnostic); ok {
+		return err
+	}
+	return diagnostics.Errorf(subject, summary, "%s", err.Error())
+}
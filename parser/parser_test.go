@@ -0,0 +1,301 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/providers"
+	"github.com/EngineersBox/Schematic/schema"
+	"github.com/EngineersBox/Schematic/state"
+	"strings"
+	"testing"
+)
+
+// testProvider is installed as "test" for the instances declared by tests
+var testProvider = &providers.Provider{
+	InstancesMap: map[string]*schema.Instance{
+		"container": {
+			Schema: map[string]*schema.Schema{
+				"containerId": {Type: schematic.TypeString, Required: true},
+				"inbuilt":     {Type: schematic.TypeBool, Optional: true},
+				"labels":      {Type: schematic.TypeMap, Optional: true, Elem: &schema.Schema{Type: schematic.TypeInt}},
+				"names":       {Type: schematic.TypeList, Optional: true, Elem: &schema.Schema{Type: schematic.TypeString}},
+				"tags":        {Type: schematic.TypeSet, Optional: true, MaxItems: 3, Elem: &schema.Schema{Type: schematic.TypeString}},
+				"mounts": {
+					Type:     schematic.TypeList,
+					Optional: true,
+					Elem: &schema.Instance{
+						Schema: map[string]*schema.Schema{
+							"source": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"mounts->0->volume"}},
+							"volume": {Type: schematic.TypeString, Optional: true},
+						},
+					},
+				},
+				"config": {
+					Type:     schematic.TypeMap,
+					Optional: true,
+					Elem: map[string]*schema.Schema{
+						"pidsMax": {Type: schematic.TypeInt, Optional: true},
+						"memMax":  {Type: schematic.TypeInt, Optional: true},
+					},
+				},
+			},
+		},
+		"network": {
+			Schema: map[string]*schema.Schema{
+				"cidr":     {Type: schematic.TypeString, Optional: true, ExactlyOneOf: []string{"cidr", "subnet"}},
+				"subnet":   {Type: schematic.TypeString, Optional: true, ExactlyOneOf: []string{"cidr", "subnet"}},
+				"dns":      {Type: schematic.TypeList, Optional: true, MinItems: 2, AtLeastOneOf: []string{"dns", "gateway"}, Elem: &schema.Schema{Type: schematic.TypeString}},
+				"gateway":  {Type: schematic.TypeString, Optional: true, AtLeastOneOf: []string{"dns", "gateway"}},
+				"user":     {Type: schematic.TypeString, Optional: true},
+				"password": {Type: schematic.TypeString, Optional: true, RequiredWith: []string{"user"}},
+				"mode": {
+					Type:     schematic.TypeString,
+					Optional: true,
+					ValidateFunc: func(value interface{}, field string) ([]string, []error) {
+						if value != "bridge" && value != "host" {
+							return nil, []error{fmt.Errorf("must be bridge or host, got %v", value)}
+						}
+						return nil, nil
+					},
+				},
+			},
+		},
+		"service": {
+			Schema: map[string]*schema.Schema{
+				"region":   {Type: schematic.TypeString, Optional: true, DefaultFunc: schema.EnvDefaultFunc("SCHEMATIC_TEST_REGION", "us")},
+				"replicas": {Type: schematic.TypeInt, Optional: true, Default: 1},
+				"ratio":    {Type: schematic.TypeFloat, Optional: true, Default: 1},
+				"tags":     {Type: schematic.TypeList, Optional: true, Default: []interface{}{"a", 1}, Elem: &schema.Schema{Type: schematic.TypeString}},
+				"limits": {
+					Type:     schematic.TypeMap,
+					Optional: true,
+					Elem: map[string]*schema.Schema{
+						"pidsMax": {Type: schematic.TypeInt, Optional: true, Default: 10},
+						"enabled": {Type: schematic.TypeBool, Optional: true, Default: true},
+					},
+				},
+			},
+		},
+	},
+}
+
+func init() {
+	if err := providers.Register("test", testProvider); err != nil {
+		panic(err)
+	}
+}
+
+// hasDiagnostic returns true if the error has a diagnostic with the summary
+// whose detail contains the given text
+func hasDiagnostic(err error, summary string, detail string) bool {
+	diags, ok := err.(diagnostics.Diagnostics)
+	if !ok {
+		return false
+	}
+	for _, diag := range diags {
+		if diag.Summary == summary && strings.Contains(diag.Detail, detail) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "unexpected token",
+			src:  `foo "a" {}`,
+			want: "test.schm:1:1: Unexpected token; expected a variable, locals, instance, capture, data, module or output declaration, got: foo",
+		},
+		{
+			name: "position of a field",
+			src:  "capture c {\n  target = \"x\"\n}\n",
+			want: "test.schm:2:3: Unsupported field; capture [c] has no field: target",
+		},
+		{
+			name: "unknown provider",
+			src:  `instance "nope::container" "a" { containerId = "x" }`,
+			want: "test.schm:1:10: Unknown provider; not such provider: nope",
+		},
+		{
+			name: "unknown kind",
+			src:  `instance "test::volume" "a" {}`,
+			want: "test.schm:1:10: Unknown instance kind; provider [test] has no instance defintion: volume",
+		},
+		{
+			name: "unknown field",
+			src:  "instance \"test::container\" \"a\" {\n  size = 1\n}",
+			want: "test.schm:2:3: Unsupported attribute; instance [test::container] has no schema field for: size",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewParser(strings.NewReader(test.src))
+			p.SetFilename("test.schm")
+			_, err := p.Parse()
+			if err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+// parseSource parses the source as test.schm with the given overrides
+func parseSource(src string, overrides VariableOverrides) (*state.ParsedState, *Parser, error) {
+	p := NewParser(strings.NewReader(src))
+	p.SetFilename("test.schm")
+	p.SetVariableOverrides(overrides)
+	schem, err := p.Parse()
+	return schem, p, err
+}
+
+// summaries returns the summary of each diagnostic of an error
+func summaries(err error) []string {
+	diags, ok := err.(diagnostics.Diagnostics)
+	if !ok {
+		return []string{err.Error()}
+	}
+	result := make([]string, 0, len(diags))
+	for _, diag := range diags {
+		result = append(result, diag.Summary)
+	}
+	return result
+}
+
+func TestParseComments(t *testing.T) {
+	src := "# leading\nvariable \"a\" { // trailing\n  /* before */ value = /* inline */ 1\n}\n// variable \"b\" = 2\nvariable \"c\" = 3 # after\n"
+	schem, err := NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schem.Variables) != 2 || schem.Variables["a"] == nil || schem.Variables["c"] == nil {
+		t.Errorf("got variables %v, want a and c", schem.Variables)
+	}
+}
+
+func TestParseRecovers(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		summaries []string
+		declared  []string
+	}{
+		{
+			name:      "invalid declarations",
+			src:       "variable \"a\" = \nvariable \"b\" = 2\nfoo\nvariable \"c\" = 3\n",
+			summaries: []string{"Invalid expression", "Unexpected token"},
+			declared:  []string{"b", "c"},
+		},
+		{
+			name:      "invalid block body",
+			src:       "variable \"a\" {\n  size = 1\n  value = 2\n}\nvariable \"b\" = 2\n",
+			summaries: []string{"Unsupported field"},
+			declared:  []string{"b"},
+		},
+		{
+			name:      "field named as a keyword",
+			src:       "capture \"c\" {\n  target = 1\n  data = 2\n}\nvariable \"b\" = 2\n",
+			summaries: []string{"Invalid field"},
+			declared:  []string{"b"},
+		},
+		{
+			name:      "indented declaration",
+			src:       "variable \"a\" = \n  variable \"b\" {\n    type = number\n  }\n  variable \"c\" = 3\n",
+			summaries: []string{"Invalid expression", "Invalid type"},
+			declared:  []string{"c"},
+		},
+		{
+			name:      "field named as a keyword at the start of a line",
+			src:       "capture \"c\" {\ntarget = 1\ndata = 2\n}\nvariable \"b\" = 2\n",
+			summaries: []string{"Invalid field"},
+			declared:  []string{"b"},
+		},
+		{
+			name:      "error in each declaration",
+			src:       "variable \"a\" 1\nvariable \"b\" {\n  type = number\n}\nvariable \"c\" = 3\n",
+			summaries: []string{"Missing open brace", "Invalid type"},
+			declared:  []string{"c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			got := summaries(err)
+			if strings.Join(got, ", ") != strings.Join(test.summaries, ", ") {
+				t.Errorf("got diagnostics %v, want %v", got, test.summaries)
+			}
+			for _, name := range test.declared {
+				if _, ok := schem.Variables[name]; !ok {
+					t.Errorf("variable %s was not parsed after an invalid declaration", name)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	src := "variable \"a\" = 1\ncapture \"c\" {\n  source = var.a\n  handler = \"h\"\n}\n"
+	file, err := NewParser(strings.NewReader(src)).ParseFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Blocks) != 2 {
+		t.Fatalf("got %d blocks, want 2", len(file.Blocks))
+	}
+	variable, capture := file.Blocks[0], file.Blocks[1]
+	if variable.Type.Lit != "variable" || variable.Value == nil || len(variable.Body) != 0 {
+		t.Errorf("got variable block %s", ast.Bytes(variable))
+	}
+	if capture.Type.Lit != "capture" || len(capture.Labels) != 1 || len(capture.Body) != 2 {
+		t.Errorf("got capture block %s", ast.Bytes(capture))
+	}
+}
+
+func TestParseFileSkipsDecoding(t *testing.T) {
+	src := "capture \"c\" {\n  source = var.missing\n}\n"
+	if _, err := NewParser(strings.NewReader(src)).ParseFile(); err != nil {
+		t.Errorf("got %v, want undeclared references to be left to decoding", err)
+	}
+	if _, err := NewParser(strings.NewReader(src)).Parse(); !hasDiagnostic(err, "Reference to undeclared variable", "missing") {
+		t.Errorf("got %v, want an undeclared variable diagnostic", err)
+	}
+}
+
+func TestScanSigned(t *testing.T) {
+	tests := []struct {
+		src     string
+		tok     Token
+		lit     string
+		columns [2]int
+		next    Token
+	}{
+		{"-1 x", NUMBER, "-1", [2]int{1, 3}, IDENT},
+		{"- 1", MINUS, "-", [2]int{1, 2}, NUMBER},
+		{"-x", MINUS, "-", [2]int{1, 2}, IDENT},
+		{"-", MINUS, "-", [2]int{1, 2}, EOF},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			p := NewParser(strings.NewReader(test.src))
+			tok, lit := p.scanSigned(p.scanIgnoreWhitespace(false))
+			if tok != test.tok || lit != test.lit {
+				t.Fatalf("got %v %q, want %v %q", tok, lit, test.tok, test.lit)
+			}
+			if rng := p.rng(); rng.Start.Column != test.columns[0] || rng.End.Column != test.columns[1] {
+				t.Errorf("got columns %d to %d, want %d to %d", rng.Start.Column, rng.End.Column, test.columns[0], test.columns[1])
+			}
+			if next, _ := p.scanIgnoreWhitespace(false); next != test.next {
+				t.Errorf("got next token %v, want %v", next, test.next)
+			}
+		})
+	}
+}
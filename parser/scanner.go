@@ -3,22 +3,76 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"github.com/EngineersBox/Schematic/diagnostics"
 	"io"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Scanner represents a lexical scanner.
 type Scanner struct {
-	r *bufio.Reader
+	r        *bufio.Reader
+	filename string
+
+	pos        diagnostics.Pos // position of the next rune
+	prevColumn int             // column before the last newline, restored on unread
+	last       rune            // last rune read, eof if it cannot be unread
+	lastSize   int             // size in bytes of the last rune read
+	raw        bytes.Buffer    // source text of the token being scanned
+
+	// Reason the last token is ILLEGAL, if known
+	illegalSummary string
+	illegalDetail  string
 }
 
 // NewScanner returns a new instance of Scanner.
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+	return &Scanner{
+		r:    bufio.NewReader(r),
+		pos:  diagnostics.InitialPos,
+		last: eof,
+	}
+}
+
+// Scan returns the next token, its literal value and the range of source it
+// spans.
+func (s *Scanner) Scan(returnOnNL bool) (tok Token, lit string, rng diagnostics.Range) {
+	start := s.pos
+	s.raw.Reset()
+	s.illegalSummary, s.illegalDetail = "", ""
+	tok, lit = s.scanToken(returnOnNL)
+	return tok, lit, diagnostics.Range{
+		Filename: s.filename,
+		Start:    start,
+		End:      s.pos,
+	}
+}
+
+// Text returns the source text of the last scanned token
+func (s *Scanner) Text() string {
+	return s.raw.String()
 }
 
-// Scan returns the next token and literal value.
-func (s *Scanner) Scan(returnOnNL bool) (tok Token, lit string) {
+// Illegal returns a diagnostic describing why the last scanned token is
+// ILLEGAL, nil is returned if the reason is not known.
+func (s *Scanner) Illegal(rng diagnostics.Range) *diagnostics.Diagnostic {
+	if s.illegalSummary == "" {
+		return nil
+	}
+	return diagnostics.Errorf(rng, s.illegalSummary, "%s", s.illegalDetail)
+}
+
+// illegal records the reason the token being scanned is ILLEGAL
+func (s *Scanner) illegal(lit string, summary string, format string, args ...interface{}) (tok Token, illegalLit string) {
+	s.illegalSummary = summary
+	s.illegalDetail = fmt.Sprintf(format, args...)
+	return ILLEGAL, lit
+}
+
+// scanToken returns the next token and literal value.
+func (s *Scanner) scanToken(returnOnNL bool) (tok Token, lit string) {
 	// Read the next rune.
 	ch := s.read()
 
@@ -28,16 +82,25 @@ func (s *Scanner) Scan(returnOnNL bool) (tok Token, lit string) {
 	if isWhitespace(ch) {
 		s.unread()
 		return s.scanWhitespace(returnOnNL)
-	} else if isLetter(ch) || isDigit(ch) {
+	} else if isLetter(ch) {
 		s.unread()
 		return s.scanIdent(returnOnNL)
+	} else if isDigit(ch) {
+		s.unread()
+		return s.scanNumber()
 	} else if isQuotation(ch) {
-		tok, lit := s.scanIdent(returnOnNL)
-		ch = s.read()
-		if isQuotation(ch) {
-			return tok, lit
+		return s.scanQuoted(ch)
+	} else if ch == '#' {
+		return s.scanLineComment(ch)
+	} else if ch == '/' {
+		switch s.read() {
+		case '/':
+			return s.scanLineComment(ch, '/')
+		case '*':
+			return s.scanBlockComment()
 		}
-		return ILLEGAL, string(ch)
+		s.unread()
+		return SLASH, string(ch)
 	}
 
 	// Otherwise read the individual character.
@@ -59,7 +122,38 @@ func (s *Scanner) Scan(returnOnNL bool) (tok Token, lit string) {
 	case ',':
 		return COMMA, string(ch)
 	case '=':
-		return EQUALS, string(ch)
+		return s.scanCompound('=', EQ, EQUALS, ch)
+	case '!':
+		return s.scanCompound('=', NEQ, NOT, ch)
+	case '<':
+		switch s.read() {
+		case '=':
+			return LTE, "<="
+		case '<':
+			return s.scanHeredoc()
+		}
+		s.unread()
+		return LT, string(ch)
+	case '>':
+		return s.scanCompound('=', GTE, GT, ch)
+	case '&':
+		return s.scanCompound('&', AND, ILLEGAL, ch)
+	case '|':
+		return s.scanCompound('|', OR, ILLEGAL, ch)
+	case '+':
+		return PLUS, string(ch)
+	case '-':
+		return MINUS, string(ch)
+	case '*':
+		return STAR, string(ch)
+	case '%':
+		return PERCENT, string(ch)
+	case '?':
+		return QUESTION, string(ch)
+	case ':':
+		return COLON, string(ch)
+	case '.':
+		return PERIOD, string(ch)
 	}
 
 	return ILLEGAL, string(ch)
@@ -67,6 +161,10 @@ func (s *Scanner) Scan(returnOnNL bool) (tok Token, lit string) {
 
 func isQuotation(ch rune) bool { return ch == '"' || ch == '\'' }
 
+// isLabel returns true if the token can be used as a name or field, either
+// as a bare identifier or a quoted string.
+func isLabel(tok Token) bool { return tok == IDENT || tok == STRING }
+
 // scanWhitespace consumes the current rune and all contiguous whitespace.
 func (s *Scanner) scanWhitespace(returnOnNL bool) (tok Token, lit string) {
 	// Create a buffer and read the current character into it.
@@ -119,24 +217,437 @@ func (s *Scanner) scanIdent(returnOnNL bool) (tok Token, lit string) {
 		return CAPTURE, buf.String()
 	case "VARIABLE":
 		return VARIABLE, buf.String()
+	case "MODULE":
+		return MODULE, buf.String()
+	case "OUTPUT":
+		return OUTPUT, buf.String()
+	case "LOCALS":
+		return LOCALS, buf.String()
 	}
 
 	// Otherwise return as a regular identifier.
 	return IDENT, buf.String()
 }
 
+// scanLineComment consumes all runes up to the end of the line, the newline
+// is left to be scanned as whitespace. The literal includes the comment
+// markers given in prefix.
+func (s *Scanner) scanLineComment(prefix ...rune) (tok Token, lit string) {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString(string(prefix))
+	for {
+		ch := s.read()
+		if ch == eof {
+			break
+		} else if ch == '\n' {
+			s.unread()
+			break
+		}
+		_, _ = buf.WriteRune(ch)
+	}
+	return COMMENT, buf.String()
+}
+
+// scanBlockComment consumes all runes up to and including the closing */ of
+// a block comment. The literal includes the comment markers.
+func (s *Scanner) scanBlockComment() (tok Token, lit string) {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("/*")
+	for {
+		ch := s.read()
+		if ch == eof {
+			return s.illegal(buf.String(), "Unterminated comment", "missing closing */ for block comment")
+		}
+		_, _ = buf.WriteRune(ch)
+		if ch == '*' {
+			if next := s.read(); next == '/' {
+				_, _ = buf.WriteRune(next)
+				return COMMENT, buf.String()
+			}
+			s.unread()
+		}
+	}
+}
+
+// scanCompound returns the compound token if the next rune matches, otherwise
+// the single rune token is returned.
+func (s *Scanner) scanCompound(next rune, compound Token, single Token, ch rune) (tok Token, lit string) {
+	if s.read() == next {
+		return compound, string([]rune{ch, next})
+	}
+	s.unread()
+	return single, string(ch)
+}
+
+// scanNumber consumes a number of the form <DIGITS>[.<DIGITS>][e[+|-]<DIGITS>][f].
+// A trailing f marks the number as a float. The literal is the source text
+// of the number, negative numbers are formed by the parser from MINUS and
+// NUMBER tokens.
+func (s *Scanner) scanNumber() (tok Token, lit string) {
+	var buf bytes.Buffer
+	s.scanDigits(&buf)
+	ch := s.read()
+	if ch == '.' {
+		_, _ = buf.WriteRune(ch)
+		if s.scanDigits(&buf) == 0 {
+			return s.illegal(buf.String(), "Invalid number literal", "missing digits after decimal point: %s", buf.String())
+		}
+		ch = s.read()
+	}
+	if ch == 'e' || ch == 'E' {
+		_, _ = buf.WriteRune(ch)
+		if ch = s.read(); ch == '+' || ch == '-' {
+			_, _ = buf.WriteRune(ch)
+		} else {
+			s.unread()
+		}
+		if s.scanDigits(&buf) == 0 {
+			return s.illegal(buf.String(), "Invalid number literal", "missing digits in exponent: %s", buf.String())
+		}
+		ch = s.read()
+	}
+	if ch == 'f' || ch == 'F' {
+		_, _ = buf.WriteRune(ch)
+		ch = s.read()
+	}
+	if isLetter(ch) || isDigit(ch) || ch == '_' || ch == '.' {
+		_, _ = buf.WriteRune(ch)
+		return s.illegal(buf.String(), "Invalid number literal", "unexpected character in number: %s", buf.String())
+	}
+	s.unread()
+	return NUMBER, buf.String()
+}
+
+// scanDigits consumes all contiguous digits, returning how many were read
+func (s *Scanner) scanDigits(buf *bytes.Buffer) int {
+	count := 0
+	for {
+		ch := s.read()
+		if !isDigit(ch) {
+			s.unread()
+			return count
+		}
+		_, _ = buf.WriteRune(ch)
+		count++
+	}
+}
+
+// scanQuoted consumes all runes up to the closing quotation matching the
+// opening quote, replacing escape sequences with the runes they represent.
+// The quotation marks are not included in the literal. Strings containing
+// interpolations or directives are returned as a TEMPLATE with the literal
+// left as written in the source, to be parsed by parseTemplate.
+func (s *Scanner) scanQuoted(quote rune) (tok Token, lit string) {
+	var buf, raw bytes.Buffer
+	invalidEscape := ""
+	template := false
+	for {
+		ch := s.read()
+		if ch == quote && invalidEscape != "" {
+			return s.illegal(buf.String(), "Invalid escape sequence", "invalid escape sequence in string: \\%s", invalidEscape)
+		} else if ch == quote && template {
+			return TEMPLATE, raw.String()
+		} else if ch == quote {
+			return STRING, buf.String()
+		} else if ch == eof || ch == '\n' {
+			return s.illegal(buf.String(), "Unterminated string", "missing closing quotation mark %c in string: %s", quote, buf.String())
+		} else if ch == '\\' {
+			// The rest of the string is consumed after an invalid escape so
+			// that scanning resumes after the closing quotation mark
+			start := raw.Len()
+			_, _ = raw.WriteRune(ch)
+			escaped, ok := s.scanEscape(&raw)
+			if !ok && invalidEscape == "" {
+				invalidEscape = raw.String()[start+1:]
+			}
+			_, _ = buf.WriteString(escaped)
+			continue
+		} else if ch == '$' || ch == '%' {
+			_, _ = raw.WriteRune(ch)
+			_, _ = buf.WriteRune(ch)
+			next := s.read()
+			if next == ch {
+				// $${ and %%{ are escaped template sequences
+				template = true
+				_, _ = raw.WriteRune(next)
+				_, _ = buf.WriteRune(next)
+			} else if next == '{' {
+				template = true
+				_, _ = raw.WriteRune(next)
+				if !s.scanTemplateSequence(&raw) {
+					return s.illegal(raw.String(), "Unterminated template sequence", "missing closing brace in template sequence: %s", raw.String())
+				}
+			} else {
+				s.unread()
+			}
+			continue
+		}
+		_, _ = raw.WriteRune(ch)
+		_, _ = buf.WriteRune(ch)
+	}
+}
+
+// scanTemplateSequence consumes the runes of an interpolation or directive up
+// to and including its closing brace, quoted strings within the sequence may
+// contain braces.
+func (s *Scanner) scanTemplateSequence(raw *bytes.Buffer) bool {
+	depth := 1
+	var quote rune
+	for {
+		ch := s.read()
+		if ch == eof || ch == '\n' {
+			return false
+		}
+		_, _ = raw.WriteRune(ch)
+		switch {
+		case quote != 0 && ch == '\\':
+			next := s.read()
+			if next == eof || next == '\n' {
+				return false
+			}
+			_, _ = raw.WriteRune(next)
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+		case isQuotation(ch):
+			quote = ch
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+}
+
+// scanEscape consumes an escape sequence following a backslash and returns
+// the string it represents, the runes consumed are written to raw.
+func (s *Scanner) scanEscape(raw *bytes.Buffer) (string, bool) {
+	ch := s.read()
+	if ch == eof || ch == '\n' {
+		s.unread()
+		return "", false
+	}
+	_, _ = raw.WriteRune(ch)
+	switch ch {
+	case 'n':
+		return "\n", true
+	case 'r':
+		return "\r", true
+	case 't':
+		return "\t", true
+	case '"', '\'', '\\':
+		return string(ch), true
+	case 'u':
+		return s.scanUnicodeEscape(raw, 4)
+	case 'U':
+		return s.scanUnicodeEscape(raw, 8)
+	}
+	return string(ch), false
+}
+
+// scanUnicodeEscape consumes the given number of hex digits of a \u or \U
+// escape sequence.
+func (s *Scanner) scanUnicodeEscape(raw *bytes.Buffer, digits int) (string, bool) {
+	var hex bytes.Buffer
+	for i := 0; i < digits; i++ {
+		ch := s.read()
+		if !isHexDigit(ch) {
+			s.unread()
+			return hex.String(), false
+		}
+		_, _ = hex.WriteRune(ch)
+		_, _ = raw.WriteRune(ch)
+	}
+	code, err := strconv.ParseUint(hex.String(), 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return hex.String(), false
+	}
+	return string(rune(code)), true
+}
+
+// unescape replaces the escape sequences in a string as they would be in a
+// quoted string.
+func unescape(str string) (string, bool) {
+	s := NewScanner(strings.NewReader(str))
+	var buf, raw bytes.Buffer
+	for {
+		ch := s.read()
+		if ch == eof {
+			return buf.String(), true
+		} else if ch == '\\' {
+			escaped, ok := s.scanEscape(&raw)
+			if !ok {
+				return "", false
+			}
+			_, _ = buf.WriteString(escaped)
+			continue
+		}
+		_, _ = buf.WriteRune(ch)
+	}
+}
+
+// scanHeredoc consumes a heredoc string following the opening <<. The
+// heredoc starts on the line after its marker and ends at the first line
+// containing only the marker:
+//
+//	<<EOT
+//	some text
+//	EOT
+//
+// With <<-EOT the indentation common to every line is removed. The literal
+// is the content of the heredoc, including the final newline.
+func (s *Scanner) scanHeredoc() (tok Token, lit string) {
+	strip := false
+	if ch := s.read(); ch == '-' {
+		strip = true
+	} else {
+		s.unread()
+	}
+	var marker bytes.Buffer
+	for {
+		ch := s.read()
+		if !isLetter(ch) && !isDigit(ch) && ch != '_' {
+			s.unread()
+			break
+		}
+		_, _ = marker.WriteRune(ch)
+	}
+	if marker.Len() == 0 {
+		return s.illegal("<<", "Invalid heredoc", "missing heredoc marker after <<")
+	}
+	if ch := s.read(); ch != '\n' {
+		return s.illegal("<<"+marker.String(), "Invalid heredoc", "heredoc marker %s must be followed by a newline", marker.String())
+	}
+	lines := make([]string, 0)
+	for {
+		line, terminated := s.scanLine()
+		if strings.TrimSpace(line) == marker.String() {
+			break
+		} else if !terminated {
+			return s.illegal(
+				strings.Join(lines, "\n"),
+				"Unterminated heredoc",
+				"missing closing marker %s for heredoc",
+				marker.String(),
+			)
+		}
+		lines = append(lines, line)
+	}
+	if strip {
+		lines = stripIndent(lines)
+	}
+	if len(lines) == 0 {
+		return STRING, ""
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	if strings.Contains(content, "${") || strings.Contains(content, "%{") {
+		// Heredocs have no escape sequences, so backslashes are escaped
+		// for the template to be parsed in the same way as a quoted string
+		return TEMPLATE, strings.ReplaceAll(content, "\\", "\\\\")
+	}
+	return STRING, content
+}
+
+// scanLine consumes all runes up to and including the next newline, which is
+// not included in the returned line. Returns false if the end of the reader
+// was reached before a newline.
+func (s *Scanner) scanLine() (string, bool) {
+	var buf bytes.Buffer
+	for {
+		ch := s.read()
+		if ch == eof {
+			return buf.String(), false
+		} else if ch == '\n' {
+			return buf.String(), true
+		}
+		_, _ = buf.WriteRune(ch)
+	}
+}
+
+// stripIndent removes the leading whitespace common to every line that is
+// not blank.
+func stripIndent(lines []string) []string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || width < indent {
+			indent = width
+		}
+	}
+	if indent <= 0 {
+		return lines
+	}
+	stripped := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= indent {
+			stripped[i] = line[indent:]
+		} else {
+			stripped[i] = strings.TrimLeft(line, " \t")
+		}
+	}
+	return stripped
+}
+
 // read reads the next rune from the buffered reader.
 // Returns the rune(0) if an error occurs (or io.EOF is returned).
 func (s *Scanner) read() rune {
-	ch, _, err := s.r.ReadRune()
+	ch, size, err := s.r.ReadRune()
 	if err != nil {
+		s.last = eof
 		return eof
 	}
+	s.last = ch
+	s.lastSize = size
+	if ch == utf8.RuneError && size == 1 {
+		// Keep the invalid byte as is so the source text is preserved
+		_ = s.r.UnreadRune()
+		b, _ := s.r.ReadByte()
+		_ = s.raw.WriteByte(b)
+	} else {
+		_, _ = s.raw.WriteRune(ch)
+	}
+	s.pos.Byte += size
+	if ch == '\n' {
+		s.prevColumn = s.pos.Column
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
+	return ch
+}
+
+// peek returns the next rune without consuming it.
+func (s *Scanner) peek() rune {
+	ch := s.read()
+	s.unread()
 	return ch
 }
 
 // unread places the previously read rune back on the reader.
-func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+func (s *Scanner) unread() {
+	if s.last == eof {
+		return
+	}
+	if err := s.r.UnreadRune(); err != nil {
+		_ = s.r.UnreadByte()
+	}
+	s.raw.Truncate(s.raw.Len() - s.lastSize)
+	s.pos.Byte -= s.lastSize
+	if s.last == '\n' {
+		s.pos.Line--
+		s.pos.Column = s.prevColumn
+	} else {
+		s.pos.Column--
+	}
+	s.last = eof
+}
 
 // isWhitespace returns true if the rune is a space, tab, or newline.
 func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' }
@@ -147,6 +658,11 @@ func isLetter(ch rune) bool { return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && c
 // isDigit returns true if the rune is a digit.
 func isDigit(ch rune) bool { return ch >= '0' && ch <= '9' }
 
+// isHexDigit returns true if the rune is a hexadecimal digit.
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
 func isSpecial(ch rune) bool { return ch == '_' || ch == ':' || ch == '.' }
 
 // eof represents a marker rune for the end of the reader.
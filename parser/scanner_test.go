@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+type scannedToken struct {
+	tok Token
+	lit string
+}
+
+// scanAll returns every token of the source up to EOF, skipping whitespace
+func scanAll(src string) []scannedToken {
+	s := NewScanner(strings.NewReader(src))
+	tokens := make([]scannedToken, 0)
+	for {
+		tok, lit, _ := s.Scan(false)
+		if tok == EOF {
+			return tokens
+		} else if tok != WS {
+			tokens = append(tokens, scannedToken{tok, lit})
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []scannedToken
+	}{
+		{
+			name: "keywords and labels",
+			src:  `variable "a" instance data capture name var.a`,
+			want: []scannedToken{
+				{VARIABLE, "variable"}, {STRING, "a"}, {INSTANCE, "instance"}, {DATA, "data"},
+				{CAPTURE, "capture"}, {IDENT, "name"}, {IDENT, "var.a"},
+			},
+		},
+		{
+			name: "strings",
+			src:  `"a b" 'c'`,
+			want: []scannedToken{{STRING, "a b"}, {STRING, "c"}},
+		},
+		{
+			name: "templates",
+			src:  `"${var.a}-x" "$${literal}" "100%"`,
+			want: []scannedToken{{TEMPLATE, "${var.a}-x"}, {TEMPLATE, "$${literal}"}, {STRING, "100%"}},
+		},
+		{
+			name: "numbers",
+			src:  `5821 63.64f 4e3 2f 1.5E-2 -3`,
+			want: []scannedToken{
+				{NUMBER, "5821"}, {NUMBER, "63.64f"}, {NUMBER, "4e3"}, {NUMBER, "2f"}, {NUMBER, "1.5E-2"},
+				{MINUS, "-"}, {NUMBER, "3"},
+			},
+		},
+		{
+			name: "invalid numbers",
+			src:  `1. 2e 3x`,
+			want: []scannedToken{{ILLEGAL, "1."}, {ILLEGAL, "2e"}, {ILLEGAL, "3x"}},
+		},
+		{
+			name: "escapes",
+			src:  `"a\tb\n" 'it\'s' "\"q\"" "\u00e9\\"`,
+			want: []scannedToken{{STRING, "a\tb\n"}, {STRING, "it's"}, {STRING, `"q"`}, {STRING, "é\\"}},
+		},
+		{
+			name: "invalid escape",
+			src:  `"a\qb" c`,
+			want: []scannedToken{{ILLEGAL, "aqb"}, {IDENT, "c"}},
+		},
+		{
+			name: "heredoc",
+			src:  "<<EOT\nline one\n  line two\nEOT\n",
+			want: []scannedToken{{STRING, "line one\n  line two\n"}},
+		},
+		{
+			name: "indented heredoc",
+			src:  "<<-EOT\n    line one\n      line two\n    EOT\n",
+			want: []scannedToken{{STRING, "line one\n  line two\n"}},
+		},
+		{
+			name: "unterminated string",
+			src:  "\"a\nb",
+			want: []scannedToken{{ILLEGAL, "a"}, {IDENT, "b"}},
+		},
+		{
+			name: "operators",
+			src:  `== != <= >= < > && || ! = , ( ) [ ] { }`,
+			want: []scannedToken{
+				{EQ, "=="}, {NEQ, "!="}, {LTE, "<="}, {GTE, ">="}, {LT, "<"}, {GT, ">"},
+				{AND, "&&"}, {OR, "||"}, {NOT, "!"}, {EQUALS, "="}, {COMMA, ","},
+				{OPENPAREN, "("}, {CLOSEDPAREN, ")"}, {OPENBRACKET, "["}, {CLOSEDBRACKET, "]"},
+				{OPENBRACE, "{"}, {CLOSEDBRACE, "}"},
+			},
+		},
+		{
+			name: "single ampersand",
+			src:  `a & b`,
+			want: []scannedToken{{IDENT, "a"}, {ILLEGAL, "&"}, {IDENT, "b"}},
+		},
+		{
+			name: "comments",
+			src:  "# hash\n// slashes\n/* block\n */ a / b",
+			want: []scannedToken{
+				{COMMENT, "# hash"}, {COMMENT, "// slashes"}, {COMMENT, "/* block\n */"}, {IDENT, "a"},
+				{SLASH, "/"}, {IDENT, "b"},
+			},
+		},
+		{
+			name: "unterminated block comment",
+			src:  "/* a",
+			want: []scannedToken{{ILLEGAL, "/* a"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := scanAll(test.src)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d tokens %v, want %d tokens %v", len(got), got, len(test.want), test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("token %d: got %v, want %v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScannerRange(t *testing.T) {
+	s := NewScanner(strings.NewReader("a\n  bc"))
+	s.filename = "test.schm"
+	s.Scan(false)
+	s.Scan(false)
+	_, lit, rng := s.Scan(false)
+	if lit != "bc" || rng.Filename != "test.schm" {
+		t.Fatalf("got %s in %s, want bc in test.schm", lit, rng.Filename)
+	}
+	if rng.Start.Line != 2 || rng.Start.Column != 3 || rng.End.Line != 2 || rng.End.Column != 5 {
+		t.Errorf("got %v to %v, want line 2 columns 3 to 5", rng.Start, rng.End)
+	}
+}
@@ -0,0 +1,259 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/schema"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaValidator checks the decoded attributes of an instance against the
+// constraints of its schema. Every violation is collected, so that all of
+// the problems with an instance are reported at once.
+type schemaValidator struct {
+	instance string
+	// attributes holds the attribute declaring each field set in the
+	// configuration, keyed by the path of the field
+	attributes map[string]*ast.Attribute
+	// set holds the path of each field that has a value
+	set map[string]bool
+	// checked holds the ExactlyOneOf and AtLeastOneOf key sets already
+	// checked, as each field in a set declares the same constraint
+	checked map[string]bool
+	subject diagnostics.Range
+	diags   diagnostics.Diagnostics
+}
+
+// validateInstanceSchema checks the attributes of an instance against the
+// Required, Optional, Computed, ConflictsWith, ExactlyOneOf, AtLeastOneOf,
+// RequiredWith, MinItems, MaxItems and ValidateFunc constraints of its
+// schema. Diagnostics of fields that are not set refer to the name of the
+// instance.
+func validateInstanceSchema(block *ast.Block, instance string, attributes map[string]interface{}, instanceSchema map[string]*schema.Schema) diagnostics.Diagnostics {
+	v := &schemaValidator{
+		instance:   instance,
+		attributes: make(map[string]*ast.Attribute),
+		set:        make(map[string]bool),
+		checked:    make(map[string]bool),
+		subject:    block.Labels[len(block.Labels)-1].Range,
+	}
+	v.collectAttributes(nil, block.Attributes())
+	v.collectValues(nil, attributes)
+	v.validateBlock(nil, attributes, instanceSchema)
+	return v.diags
+}
+
+// collectAttributes records the attribute declaring each field, including
+// the fields of nested blocks.
+func (v *schemaValidator) collectAttributes(nesting []string, attributes []*ast.Attribute) {
+	for _, attribute := range attributes {
+		if len(nesting) == 0 && attribute.Name.Lit == instanceHasDependencyField {
+			continue
+		}
+		fieldNesting := append(append([]string{}, nesting...), attribute.Name.Lit)
+		path := strings.Join(fieldNesting, fieldNestingDelimiter)
+		v.attributes[path] = attribute
+		if object, ok := attribute.Value.(*ast.ObjectExpr); ok {
+			v.collectAttributes(fieldNesting, object.Attributes)
+		}
+	}
+}
+
+// collectValues records the path of each field with a value, covering the
+// fields of blocks that are not written as a nested block, such as the
+// elements of an array.
+func (v *schemaValidator) collectValues(nesting []string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range value {
+			fieldNesting := append(append([]string{}, nesting...), key)
+			v.set[strings.Join(fieldNesting, fieldNestingDelimiter)] = true
+			v.collectValues(fieldNesting, elem)
+		}
+	case []interface{}:
+		for i, elem := range value {
+			v.collectValues(append(append([]string{}, nesting...), strconv.Itoa(i)), elem)
+		}
+	}
+}
+
+// fieldRange returns the range of the attribute declaring a field, or of the
+// closest enclosing attribute if the field is not declared by one.
+func (v *schemaValidator) fieldRange(nesting []string) diagnostics.Range {
+	for i := len(nesting); i > 0; i-- {
+		if attribute, ok := v.attributes[strings.Join(nesting[:i], fieldNestingDelimiter)]; ok {
+			return attribute.Name.Range
+		}
+	}
+	return v.subject
+}
+
+// valueRange returns the range of the value assigned to a field, or of the
+// closest enclosing value if the field is not declared by an attribute.
+func (v *schemaValidator) valueRange(nesting []string) diagnostics.Range {
+	for i := len(nesting); i > 0; i-- {
+		if attribute, ok := v.attributes[strings.Join(nesting[:i], fieldNestingDelimiter)]; ok {
+			return attribute.Value.Range()
+		}
+	}
+	return v.subject
+}
+
+func (v *schemaValidator) validateBlock(nesting []string, block map[string]interface{}, blockSchema map[string]*schema.Schema) {
+	keys := make([]string, 0, len(blockSchema))
+	for key := range blockSchema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fieldNesting := append(append([]string{}, nesting...), key)
+		v.validateField(fieldNesting, block[key], blockSchema[key])
+	}
+}
+
+func (v *schemaValidator) validateField(nesting []string, value interface{}, fieldSchema *schema.Schema) {
+	field := strings.Join(nesting, fieldNestingDelimiter)
+	v.checkOneOf(nesting, "ExactlyOneOf", fieldSchema.ExactlyOneOf)
+	v.checkOneOf(nesting, "AtLeastOneOf", fieldSchema.AtLeastOneOf)
+	if !v.set[field] {
+		if fieldSchema.Required {
+			v.diags = append(v.diags, diagnostics.Errorf(
+				v.fieldRange(nesting),
+				"Missing required attribute",
+				"instance [%s] is missing required field: %s",
+				v.instance,
+				field,
+			))
+		}
+		return
+	}
+	rng := v.fieldRange(nesting)
+	if fieldSchema.Computed && !fieldSchema.Optional && !fieldSchema.Required {
+		v.diags = append(v.diags, diagnostics.Errorf(rng, "Invalid attribute", "field [%s] is computed and cannot be set", field))
+	}
+	for _, key := range fieldSchema.ConflictsWith {
+		if v.set[key] {
+			v.diags = append(v.diags, diagnostics.Errorf(rng, "Conflicting attributes", "field [%s] conflicts with [%s]", field, key))
+		}
+	}
+	for _, key := range fieldSchema.RequiredWith {
+		if key != field && !v.set[key] {
+			v.diags = append(v.diags, diagnostics.Errorf(rng, "Missing required attribute", "field [%s] requires [%s] to be set", field, key))
+		}
+	}
+	if value == nil {
+		return
+	}
+	v.validateValue(nesting, value, fieldSchema)
+	switch elem := value.(type) {
+	case []interface{}:
+		v.validateItems(nesting, elem, fieldSchema)
+	case map[string]interface{}:
+		if nestedSchema, ok := fieldSchema.Elem.(map[string]*schema.Schema); ok {
+			v.validateBlock(nesting, elem, nestedSchema)
+		}
+	}
+}
+
+// checkOneOf checks that at least one of a set of fields is set, and for
+// ExactlyOneOf that no more than one is. A set of fields is only checked
+// once, as it is declared by each field in the set.
+func (v *schemaValidator) checkOneOf(nesting []string, constraint string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	id := constraint + ":" + strings.Join(sorted, ",")
+	if v.checked[id] {
+		return
+	}
+	v.checked[id] = true
+	set := make([]string, 0, len(sorted))
+	for _, key := range sorted {
+		if v.set[key] {
+			set = append(set, key)
+		}
+	}
+	if len(set) == 0 {
+		v.diags = append(v.diags, diagnostics.Errorf(
+			v.fieldRange(nesting[:len(nesting)-1]),
+			"Missing required attribute",
+			"instance [%s] must set one of: %s",
+			v.instance,
+			strings.Join(sorted, ", "),
+		))
+	} else if constraint == "ExactlyOneOf" && len(set) > 1 {
+		for _, key := range set[1:] {
+			v.diags = append(v.diags, diagnostics.Errorf(
+				v.fieldRange(strings.Split(key, fieldNestingDelimiter)),
+				"Conflicting attributes",
+				"only one of %s can be set, field [%s] conflicts with [%s]",
+				strings.Join(sorted, ", "),
+				key,
+				set[0],
+			))
+		}
+	}
+}
+
+// validateItems checks the number of items in an array, and each item
+// against the schema of its elements. MinItems applies to any array that is
+// set, including that of an Optional field.
+func (v *schemaValidator) validateItems(nesting []string, list []interface{}, fieldSchema *schema.Schema) {
+	field := strings.Join(nesting, fieldNestingDelimiter)
+	if fieldSchema.MaxItems > 0 && len(list) > fieldSchema.MaxItems {
+		v.diags = append(v.diags, diagnostics.Errorf(
+			v.valueRange(nesting),
+			"Invalid value",
+			"field [%s] has %d items, maximum is %d",
+			field,
+			len(list),
+			fieldSchema.MaxItems,
+		))
+	}
+	if len(list) < fieldSchema.MinItems {
+		v.diags = append(v.diags, diagnostics.Errorf(
+			v.valueRange(nesting),
+			"Invalid value",
+			"field [%s] has %d items, minimum is %d",
+			field,
+			len(list),
+			fieldSchema.MinItems,
+		))
+	}
+	for i, elem := range list {
+		elemNesting := append(append([]string{}, nesting...), strconv.Itoa(i))
+		switch elemSchema := fieldSchema.Elem.(type) {
+		case *schema.Schema:
+			v.validateValue(elemNesting, elem, elemSchema)
+		case *schema.Instance:
+			if block, ok := elem.(map[string]interface{}); ok {
+				v.validateBlock(elemNesting, block, elemSchema.Schema)
+			}
+		case map[string]*schema.Schema:
+			if block, ok := elem.(map[string]interface{}); ok {
+				v.validateBlock(elemNesting, block, elemSchema)
+			}
+		}
+	}
+}
+
+// validateValue runs the ValidateFunc of a field, its warnings are reported
+// along with any errors.
+func (v *schemaValidator) validateValue(nesting []string, value interface{}, fieldSchema *schema.Schema) {
+	if fieldSchema.ValidateFunc == nil {
+		return
+	}
+	field := strings.Join(nesting, fieldNestingDelimiter)
+	rng := v.valueRange(nesting)
+	warnings, errs := fieldSchema.ValidateFunc(value, field)
+	for _, warning := range warnings {
+		v.diags = append(v.diags, diagnostics.Warningf(rng, "Attribute warning", "field [%s]: %s", field, warning))
+	}
+	for _, err := range errs {
+		v.diags = append(v.diags, diagnostics.Errorf(rng, "Invalid value", "field [%s]: %s", field, err.Error()))
+	}
+}
@@ -0,0 +1,469 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	templateInterpolationStart = "${"
+	templateDirectiveStart     = "%{"
+
+	templateIfDirective     = "if"
+	templateElseDirective   = "else"
+	templateEndIfDirective  = "endif"
+	templateForDirective    = "for"
+	templateEndForDirective = "endfor"
+)
+
+// templateExpr is a string template, the result is the concatenation of the
+// literal text, interpolations and directives within it.
+type templateExpr struct {
+	parts []Expression
+	rng   diagnostics.Range
+}
+
+func (e *templateExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	var buf strings.Builder
+	for _, part := range e.parts {
+		val, err := part.Value(ctx)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		str, err := templateString(val, part.Range())
+		if err != nil {
+			return cty.NilVal, err
+		}
+		buf.WriteString(str)
+	}
+	return cty.StringVal(buf.String()), nil
+}
+
+func (e *templateExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *templateExpr) String() string { return `"` + e.source() + `"` }
+
+// source returns the template as it would be written within quotes
+func (e *templateExpr) source() string {
+	var buf strings.Builder
+	for _, part := range e.parts {
+		switch p := part.(type) {
+		case *templateExpr:
+			buf.WriteString(p.source())
+		case *literalExpr:
+			quoted := strconv.Quote(p.val.AsString())
+			literal := strings.ReplaceAll(quoted[1:len(quoted)-1], templateInterpolationStart, "$"+templateInterpolationStart)
+			buf.WriteString(strings.ReplaceAll(literal, templateDirectiveStart, "%"+templateDirectiveStart))
+		default:
+			buf.WriteString(part.String())
+		}
+	}
+	return buf.String()
+}
+
+type templateInterpolationExpr struct {
+	expr Expression
+	rng  diagnostics.Range
+}
+
+func (e *templateInterpolationExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	return e.expr.Value(ctx)
+}
+
+func (e *templateInterpolationExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *templateInterpolationExpr) String() string {
+	return templateInterpolationStart + e.expr.String() + "}"
+}
+
+type templateIfExpr struct {
+	condition Expression
+	then      *templateExpr
+	otherwise *templateExpr
+	rng       diagnostics.Range
+}
+
+func (e *templateIfExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	condition, err := e.condition.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if condition.Type() != cty.Bool || condition.IsNull() {
+		return cty.NilVal, diagnostics.Errorf(e.condition.Range(), "Invalid condition", "template if condition must be a boolean")
+	}
+	if condition.True() {
+		return e.then.Value(ctx)
+	} else if e.otherwise != nil {
+		return e.otherwise.Value(ctx)
+	}
+	return cty.StringVal(""), nil
+}
+
+func (e *templateIfExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *templateIfExpr) String() string {
+	var buf strings.Builder
+	buf.WriteString(templateDirectiveStart + templateIfDirective + " " + e.condition.String() + "}")
+	buf.WriteString(e.then.source())
+	if e.otherwise != nil {
+		buf.WriteString(templateDirectiveStart + templateElseDirective + "}")
+		buf.WriteString(e.otherwise.source())
+	}
+	buf.WriteString(templateDirectiveStart + templateEndIfDirective + "}")
+	return buf.String()
+}
+
+type templateForExpr struct {
+	key        string
+	value      string
+	collection Expression
+	body       *templateExpr
+	rng        diagnostics.Range
+}
+
+func (e *templateForExpr) Value(ctx *EvalContext) (cty.Value, error) {
+	collection, err := e.collection.Value(ctx)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	if collection.IsNull() || !collection.CanIterateElements() {
+		return cty.NilVal, diagnostics.Errorf(
+			e.collection.Range(),
+			"Invalid for collection",
+			"template for collection must be an array or block: %s",
+			e.collection.String(),
+		)
+	}
+	var buf strings.Builder
+	for it := collection.ElementIterator(); it.Next(); {
+		key, value := it.Element()
+		iterators := map[string]cty.Value{e.value: value}
+		if e.key != "" {
+			iterators[e.key] = key
+		}
+		result, err := e.body.Value(ctx.withIterators(iterators))
+		if err != nil {
+			return cty.NilVal, err
+		}
+		buf.WriteString(result.AsString())
+	}
+	return cty.StringVal(buf.String()), nil
+}
+
+func (e *templateForExpr) Range() diagnostics.Range { return e.rng }
+
+func (e *templateForExpr) String() string {
+	symbols := e.value
+	if e.key != "" {
+		symbols = e.key + ", " + e.value
+	}
+	return templateDirectiveStart + templateForDirective + " " + symbols + " in " + e.collection.String() + "}" +
+		e.body.source() +
+		templateDirectiveStart + templateEndForDirective + "}"
+}
+
+// templateString converts the result of a template part to a string
+func templateString(val cty.Value, rng diagnostics.Range) (string, error) {
+	if val.IsNull() {
+		return "", diagnostics.Errorf(rng, "Invalid template value", "cannot include a null value in a template")
+	}
+	str, err := convert.Convert(val, cty.String)
+	if err != nil {
+		return "", diagnostics.Errorf(rng, "Invalid template value", "cannot include %s in a template", val.Type().FriendlyName())
+	}
+	return str.AsString(), nil
+}
+
+// templateParser parses the source of a TEMPLATE token
+type templateParser struct {
+	p      *Parser
+	src    string
+	offset int
+	rng    diagnostics.Range
+}
+
+// parseTemplate parses the literal of a TEMPLATE token starting at the given
+// range.
+func (p *Parser) parseTemplate(src string, rng diagnostics.Range) (Expression, error) {
+	t := &templateParser{
+		p:   p,
+		src: src,
+		rng: rng,
+	}
+	template, end, err := t.parseParts()
+	if err != nil {
+		return nil, err
+	} else if end != "" {
+		return nil, diagnostics.Errorf(rng, "Invalid template", "unexpected %s%s} directive in template", templateDirectiveStart, end)
+	}
+	return template, nil
+}
+
+// parseParts parses the template up to the end of the source or the first
+// of the given directives, which is returned.
+func (t *templateParser) parseParts(ends ...string) (*templateExpr, string, error) {
+	template := &templateExpr{rng: t.rng}
+	var literal strings.Builder
+	literalStart := t.offset
+	flush := func() error {
+		if literal.Len() == 0 {
+			return nil
+		}
+		rng := t.rangeOf(literalStart, t.offset)
+		str, ok := unescape(literal.String())
+		if !ok {
+			return diagnostics.Errorf(rng, "Invalid escape sequence", "invalid escape sequence in template: %s", literal.String())
+		}
+		template.parts = append(template.parts, &literalExpr{val: cty.StringVal(str), lit: str, rng: rng})
+		literal.Reset()
+		return nil
+	}
+	for t.offset < len(t.src) {
+		rest := t.src[t.offset:]
+		switch {
+		case strings.HasPrefix(rest, "$"+templateInterpolationStart):
+			literal.WriteString(templateInterpolationStart)
+			t.offset += 3
+		case strings.HasPrefix(rest, "%"+templateDirectiveStart):
+			literal.WriteString(templateDirectiveStart)
+			t.offset += 3
+		case strings.HasPrefix(rest, templateInterpolationStart):
+			if err := flush(); err != nil {
+				return nil, "", err
+			}
+			start := t.offset
+			content, contentStart, err := t.scanSequence()
+			if err != nil {
+				return nil, "", err
+			}
+			expr, err := t.parseExpression(content, contentStart)
+			if err != nil {
+				return nil, "", err
+			}
+			template.parts = append(template.parts, &templateInterpolationExpr{expr: expr, rng: t.rangeOf(start, t.offset)})
+			literalStart = t.offset
+		case strings.HasPrefix(rest, templateDirectiveStart):
+			if err := flush(); err != nil {
+				return nil, "", err
+			}
+			start := t.offset
+			content, contentStart, err := t.scanSequence()
+			if err != nil {
+				return nil, "", err
+			}
+			keyword := strings.Fields(content)
+			if len(keyword) == 0 {
+				return nil, "", diagnostics.Errorf(t.rangeOf(start, t.offset), "Invalid template directive", "empty template directive")
+			}
+			for _, end := range ends {
+				if keyword[0] == end {
+					return template, end, nil
+				}
+			}
+			var directive Expression
+			switch keyword[0] {
+			case templateIfDirective:
+				directive, err = t.parseIf(content, contentStart, start)
+			case templateForDirective:
+				directive, err = t.parseFor(content, contentStart, start)
+			default:
+				err = diagnostics.Errorf(
+					t.rangeOf(start, t.offset),
+					"Invalid template directive",
+					"unexpected template directive: %s",
+					keyword[0],
+				)
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			template.parts = append(template.parts, directive)
+			literalStart = t.offset
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			literal.WriteString(rest[:size])
+			t.offset += size
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, "", err
+	}
+	if len(ends) > 0 {
+		return nil, "", diagnostics.Errorf(
+			t.rng,
+			"Invalid template",
+			"missing %s%s} directive in template",
+			templateDirectiveStart,
+			ends[len(ends)-1],
+		)
+	}
+	return template, "", nil
+}
+
+// parseIf parses an if directive, its body and optional else body
+func (t *templateParser) parseIf(content string, contentStart int, start int) (Expression, error) {
+	conditionStart := contentStart + strings.Index(content, templateIfDirective) + len(templateIfDirective)
+	condition, err := t.parseExpression(t.src[conditionStart:contentStart+len(content)], conditionStart)
+	if err != nil {
+		return nil, err
+	}
+	directive := &templateIfExpr{condition: condition}
+	var end string
+	directive.then, end, err = t.parseParts(templateElseDirective, templateEndIfDirective)
+	if err != nil {
+		return nil, err
+	}
+	if end == templateElseDirective {
+		directive.otherwise, _, err = t.parseParts(templateEndIfDirective)
+		if err != nil {
+			return nil, err
+		}
+	}
+	directive.rng = t.rangeOf(start, t.offset)
+	return directive, nil
+}
+
+// parseFor parses a for directive of the form for <VALUE> in <E> or
+// for <KEY>, <VALUE> in <E>, and its body.
+func (t *templateParser) parseFor(content string, contentStart int, start int) (Expression, error) {
+	headerStart := contentStart + strings.Index(content, templateForDirective) + len(templateForDirective)
+	sub := t.subParser(t.src[headerStart:contentStart+len(content)], headerStart)
+	directive := &templateForExpr{}
+	tok, symbol := sub.scanIgnoreWhitespace(false)
+	if tok != IDENT {
+		return nil, sub.errorf("Invalid template directive", "invalid symbol in template for directive: %s", symbol)
+	}
+	directive.value = symbol
+	tok, lit := sub.scanIgnoreWhitespace(false)
+	if tok == COMMA {
+		tok, symbol = sub.scanIgnoreWhitespace(false)
+		if tok != IDENT {
+			return nil, sub.errorf("Invalid template directive", "invalid symbol in template for directive: %s", symbol)
+		}
+		directive.key, directive.value = directive.value, symbol
+		tok, lit = sub.scanIgnoreWhitespace(false)
+	}
+	if tok != IDENT || lit != "in" {
+		return nil, sub.errorf("Invalid template directive", "missing in keyword in template for directive: %s", lit)
+	}
+	collection, err := sub.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit = sub.scanIgnoreWhitespace(false); tok != EOF {
+		return nil, sub.errorf("Invalid template directive", "unexpected %s in template for directive", lit)
+	}
+	directive.collection, err = t.p.decodeExpression(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	// The symbols are only in scope within the body of the directive
+	previous := t.p.iterators
+	t.p.iterators = make(map[string]bool, len(previous)+2)
+	for name := range previous {
+		t.p.iterators[name] = true
+	}
+	t.p.iterators[directive.value] = true
+	if directive.key != "" {
+		t.p.iterators[directive.key] = true
+	}
+	directive.body, _, err = t.parseParts(templateEndForDirective)
+	t.p.iterators = previous
+	if err != nil {
+		return nil, err
+	}
+	directive.rng = t.rangeOf(start, t.offset)
+	return directive, nil
+}
+
+// scanSequence consumes an interpolation or directive at the current offset,
+// returning its content without the enclosing braces and the offset the
+// content starts at.
+func (t *templateParser) scanSequence() (string, int, error) {
+	start := t.offset
+	contentStart := start + 2
+	depth := 1
+	var quote rune
+	escaped := false
+	for i, ch := range t.src[contentStart:] {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && ch == '\\':
+			escaped = true
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+		case isQuotation(ch):
+			quote = ch
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+			if depth == 0 {
+				end := contentStart + i
+				t.offset = end + 1
+				return t.src[contentStart:end], contentStart, nil
+			}
+		}
+	}
+	return "", 0, diagnostics.Errorf(t.rng, "Unterminated template sequence", "missing closing brace in template sequence: %s", t.src[start:])
+}
+
+// parseExpression parses the source of an interpolation or directive as an
+// expression, which must span the whole source.
+func (t *templateParser) parseExpression(src string, offset int) (Expression, error) {
+	sub := t.subParser(src, offset)
+	expr, err := sub.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := sub.scanIgnoreWhitespace(false); tok != EOF {
+		return nil, sub.errorf("Invalid expression", "unexpected %s in template expression", lit)
+	}
+	return t.p.decodeExpression(expr)
+}
+
+// subParser returns a parser for part of the template source, starting at
+// the position of the given offset.
+func (t *templateParser) subParser(src string, offset int) *Parser {
+	sub := NewParser(strings.NewReader(src))
+	sub.s.filename = t.rng.Filename
+	sub.s.pos = t.position(offset)
+	return sub
+}
+
+// rangeOf returns the source range between two offsets in the template
+func (t *templateParser) rangeOf(start int, end int) diagnostics.Range {
+	return diagnostics.Range{
+		Filename: t.rng.Filename,
+		Start:    t.position(start),
+		End:      t.position(end),
+	}
+}
+
+// position returns the source position of an offset in the template. Quoted
+// templates are on a single line and map exactly to the source, heredoc
+// templates start on the line after their marker and do not account for
+// stripped indentation.
+func (t *templateParser) position(offset int) diagnostics.Pos {
+	if t.rng.Start.Line == t.rng.End.Line {
+		return diagnostics.Pos{
+			Line:   t.rng.Start.Line,
+			Column: t.rng.Start.Column + 1 + utf8.RuneCountInString(t.src[:offset]),
+			Byte:   t.rng.Start.Byte + 1 + offset,
+		}
+	}
+	preceding := t.src[:offset]
+	line := strings.LastIndex(preceding, "\n") + 1
+	return diagnostics.Pos{
+		Line:   t.rng.Start.Line + 1 + strings.Count(preceding, "\n"),
+		Column: 1 + utf8.RuneCountInString(preceding[line:]),
+		Byte:   t.rng.Start.Byte + offset,
+	}
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// captureSource returns the source of the capture c, declared after the
+// given source with the template as its source
+func captureSource(src string, template string) (string, error) {
+	schem, err := NewParser(strings.NewReader(src + "\ncapture c {\n  source = " + template + "\n}\n")).Parse()
+	if err != nil {
+		return "", err
+	}
+	return schem.Captures["c"].Source, nil
+}
+
+func TestTemplates(t *testing.T) {
+	vars := "variable \"n\" = 4\nvariable \"s\" = \"svc\"\nvariable \"prod\" = true\n" +
+		"instance \"test::container\" \"x\" {\ncontainerId = \"a\"\nnames = [\"a\", \"b\"]\nconfig = {\npidsMax = 20\nmemMax = 64\n}\n}\n"
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"plain", `"text"`, "text"},
+		{"interpolation", `"${var.s}-${var.n}"`, "svc-4"},
+		{"escaped interpolation", `"$${var.s}"`, "${var.s}"},
+		{"escaped directive", `"%%{if}"`, "%{if}"},
+		{"if directive", `"%{if var.prod}prod%{else}dev%{endif}"`, "prod"},
+		{"if without else", `"%{if !var.prod}dev%{endif}"`, ""},
+		{"instance attribute", `"${instance.x.containerId}"`, "a"},
+		{"for directive", `"%{for v in instance.x.names}${v} %{endfor}"`, "a b "},
+		{"for with index", `"%{for i, v in instance.x.names}${i}=${v} %{endfor}"`, "0=a 1=b "},
+		{"for over a block", `"%{for k, v in instance.x.config}${k}=${v}%{endfor}"`, "memMax=64pidsMax=20"},
+		{"heredoc", "<<-EOT\n  ${var.s}\n    indented\n  EOT", "svc\n  indented\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := captureSource(vars, test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	vars := "variable \"s\" = \"svc\"\n"
+	tests := []struct {
+		name     string
+		template string
+		summary  string
+		detail   string
+	}{
+		{
+			name:     "unterminated sequence",
+			template: `"${var.s"`,
+			summary:  "Unterminated template sequence",
+			detail:   "missing closing brace in template sequence: ${var.s",
+		},
+		{
+			name:     "missing endif",
+			template: `"%{if true}a"`,
+			summary:  "Invalid template",
+			detail:   "endif",
+		},
+		{
+			name:     "unexpected endfor",
+			template: `"a%{endfor}"`,
+			summary:  "Invalid template directive",
+			detail:   "unexpected template directive: endfor",
+		},
+		{
+			name:     "empty directive",
+			template: `"%{}"`,
+			summary:  "Invalid template directive",
+			detail:   "empty template directive",
+		},
+		{
+			name:     "missing in keyword",
+			template: `"%{for v [1]}${v}%{endfor}"`,
+			summary:  "Invalid template directive",
+			detail:   "missing in keyword in template for directive",
+		},
+		{
+			name:     "non boolean condition",
+			template: `"%{if var.s}a%{endif}"`,
+			summary:  "Invalid condition",
+			detail:   "template if condition must be a boolean",
+		},
+		{
+			name:     "undeclared variable",
+			template: `"${var.missing}"`,
+			summary:  "Reference to undeclared variable",
+			detail:   "no such variable: missing",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := captureSource(vars, test.template)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
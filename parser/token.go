@@ -7,9 +7,13 @@ const (
 	ILLEGAL Token = iota
 	EOF
 	WS
+	COMMENT // # ..., // ... or /* ... */
 
 	// Literals
 	IDENT
+	NUMBER
+	STRING
+	TEMPLATE // a quoted string or heredoc containing ${...} or %{...}
 
 	// Misc characters
 	OPENBRACE     // {
@@ -22,9 +26,30 @@ const (
 	PERIOD        // .
 	EQUALS        // =
 
+	// Operators
+	EQ       // ==
+	NEQ      // !=
+	LT       // <
+	LTE      // <=
+	GT       // >
+	GTE      // >=
+	AND      // &&
+	OR       // ||
+	NOT      // !
+	PLUS     // +
+	MINUS    // -
+	STAR     // *
+	SLASH    // /
+	PERCENT  // %
+	QUESTION // ?
+	COLON    // :
+
 	// Keywords
 	INSTANCE
 	DATA
 	CAPTURE
 	VARIABLE
+	MODULE
+	OUTPUT
+	LOCALS
 )
@@ -4,21 +4,219 @@ import (
 	"fmt"
 	"github.com/EngineersBox/Schematic/collection"
 	"github.com/EngineersBox/Schematic/schema"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"strconv"
+	"strings"
 )
 
-func validateSchemaFields(fields []string, instanceSchema map[string]*schema.Schema) bool {
-	hasField := instanceSchema[fields[0]] != nil
-	if len(fields) == 1 {
-		return hasField
+// getSchemaField retrieves the schema for the field at the given nesting, or
+// nil if there is no such field
+func getSchemaField(fields []string, instanceSchema map[string]*schema.Schema) *schema.Schema {
+	fieldSchema := instanceSchema[fields[0]]
+	if fieldSchema == nil || len(fields) == 1 {
+		return fieldSchema
 	}
-	if instanceSchema[fields[0]].Type != schematic.TypeMap {
-		return false
+	if fieldSchema.Type != schematic.TypeMap {
+		return nil
 	}
-	nestedSchema, ok := instanceSchema[fields[0]].Elem.(map[string]*schema.Schema)
+	nestedSchema, ok := fieldSchema.Elem.(map[string]*schema.Schema)
 	if !ok {
-		return false
+		return nil
 	}
-	return validateSchemaFields(fields[1:], nestedSchema)
+	return getSchemaField(fields[1:], nestedSchema)
+}
+
+func isListType(valueType schematic.ValueType) bool {
+	return valueType == schematic.TypeList || valueType == schematic.TypeSet
+}
+
+// validateList checks a parsed array against the schema of the field it is
+// assigned to. Duplicate elements are removed when the field is a TypeSet.
+// The number of items is checked once the instance is decoded, by
+// validateInstanceSchema.
+func validateList(nesting []string, list []interface{}, fieldSchema *schema.Schema) ([]interface{}, error) {
+	field := strings.Join(nesting, fieldNestingDelimiter)
+	if !isListType(fieldSchema.Type) {
+		return nil, fmt.Errorf("field [%s] cannot be assigned an array", field)
+	}
+	for i, elem := range list {
+		elemNesting := append(append([]string{}, nesting...), strconv.Itoa(i))
+		validated, err := validateValue(elemNesting, elem, fieldSchema.Elem)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = validated
+	}
+	if fieldSchema.Type == schematic.TypeSet {
+		list = uniqueElements(list, fieldSchema.Set)
+	}
+	return list, nil
+}
+
+func validateValue(nesting []string, elem interface{}, elemSchema interface{}) (interface{}, error) {
+	field := strings.Join(nesting, fieldNestingDelimiter)
+	switch s := elemSchema.(type) {
+	case *schema.Schema:
+		switch value := elem.(type) {
+		case []interface{}:
+			return validateList(nesting, value, s)
+		case map[string]interface{}:
+			if s.Type != schematic.TypeMap {
+				return nil, fmt.Errorf("field [%s] cannot be a block", field)
+			}
+			switch nestedSchema := s.Elem.(type) {
+			case map[string]*schema.Schema:
+				return validateBlock(nesting, value, nestedSchema)
+			case *schema.Schema:
+				return validateMap(nesting, value, nestedSchema)
+			}
+			return value, nil
+		}
+		if isListType(s.Type) || s.Type == schematic.TypeMap {
+			return nil, fmt.Errorf("field [%s] must be %s", field, typeDescription(s.Type))
+		}
+		return convertLiteral(nesting, elem, s)
+	case *schema.Instance:
+		return validateBlockValue(nesting, elem, s.Schema)
+	case map[string]*schema.Schema:
+		return validateBlockValue(nesting, elem, s)
+	}
+	return elem, nil
+}
+
+func validateBlockValue(nesting []string, elem interface{}, blockSchema map[string]*schema.Schema) (interface{}, error) {
+	block, ok := elem.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field [%s] must be a block", strings.Join(nesting, fieldNestingDelimiter))
+	}
+	return validateBlock(nesting, block, blockSchema)
+}
+
+// validateMap checks each value of a TypeMap against the schema of its
+// elements.
+func validateMap(nesting []string, elems map[string]interface{}, elemSchema *schema.Schema) (map[string]interface{}, error) {
+	for key, value := range elems {
+		validated, err := validateValue(append(append([]string{}, nesting...), key), value, elemSchema)
+		if err != nil {
+			return nil, err
+		}
+		elems[key] = validated
+	}
+	return elems, nil
+}
+
+func validateBlock(nesting []string, block map[string]interface{}, blockSchema map[string]*schema.Schema) (map[string]interface{}, error) {
+	for key, value := range block {
+		fieldNesting := append(append([]string{}, nesting...), key)
+		fieldSchema := blockSchema[key]
+		if fieldSchema == nil {
+			return nil, fmt.Errorf("no schema field for: %s", strings.Join(fieldNesting, fieldNestingDelimiter))
+		}
+		validated, err := validateValue(fieldNesting, value, fieldSchema)
+		if err != nil {
+			return nil, err
+		}
+		block[key] = validated
+	}
+	return block, nil
+}
+
+func typeDescription(valueType schematic.ValueType) string {
+	switch valueType {
+	case schematic.TypeList, schematic.TypeSet:
+		return "an array"
+	case schematic.TypeMap:
+		return "a block"
+	case schematic.TypeBool:
+		return "a bool"
+	case schematic.TypeInt:
+		return "an int"
+	case schematic.TypeFloat:
+		return "a float"
+	case schematic.TypeString:
+		return "a string"
+	}
+	return "a literal"
+}
+
+// convertToSchemaType converts the value of an expression to the type of the
+// schema field it is assigned to.
+func convertToSchemaType(nesting []string, value cty.Value, fieldSchema *schema.Schema) (cty.Value, error) {
+	field := strings.Join(nesting, fieldNestingDelimiter)
+	ty := value.Type()
+	var target cty.Type
+	switch fieldSchema.Type {
+	case schematic.TypeBool:
+		target = cty.Bool
+	case schematic.TypeInt, schematic.TypeFloat:
+		target = cty.Number
+	case schematic.TypeString:
+		target = cty.String
+	case schematic.TypeMap:
+		if !ty.IsObjectType() && !ty.IsMapType() {
+			return cty.NilVal, fmt.Errorf("field [%s] must be %s", field, typeDescription(fieldSchema.Type))
+		}
+		return value, nil
+	case schematic.TypeList, schematic.TypeSet:
+		if !ty.IsTupleType() && !ty.IsListType() && !ty.IsSetType() {
+			return cty.NilVal, fmt.Errorf("field [%s] must be %s", field, typeDescription(fieldSchema.Type))
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+	converted, err := convert.Convert(value, target)
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("field [%s] must be %s: %s", field, typeDescription(fieldSchema.Type), err.Error())
+	}
+	if fieldSchema.Type == schematic.TypeInt && !converted.IsNull() && !converted.AsBigFloat().IsInt() {
+		return cty.NilVal, fmt.Errorf("field [%s] must be %s", field, typeDescription(fieldSchema.Type))
+	}
+	return converted, nil
+}
+
+// convertLiteral converts a value to the type of the field it is assigned to,
+// as stored in state: an int, float64, bool or string.
+func convertLiteral(nesting []string, elem interface{}, fieldSchema *schema.Schema) (interface{}, error) {
+	value, err := convertToSchemaType(nesting, toCtyValue(elem), fieldSchema)
+	if err != nil {
+		return nil, err
+	} else if value.IsNull() {
+		return nil, fmt.Errorf("field [%s] must not be null", strings.Join(nesting, fieldNestingDelimiter))
+	}
+	switch fieldSchema.Type {
+	case schematic.TypeInt:
+		i, _ := value.AsBigFloat().Int64()
+		return int(i), nil
+	case schematic.TypeFloat:
+		f, _ := value.AsBigFloat().Float64()
+		return f, nil
+	case schematic.TypeBool:
+		return value.True(), nil
+	case schematic.TypeString:
+		return value.AsString(), nil
+	}
+	return elem, nil
+}
+
+// uniqueElements removes duplicate elements, identified either by the hash
+// computed by setFunc or by their formatted value.
+func uniqueElements(list []interface{}, setFunc schema.SchemaSetFunc) []interface{} {
+	seen := make(map[string]bool)
+	unique := make([]interface{}, 0, len(list))
+	for _, elem := range list {
+		key := fmt.Sprintf("%#v", elem)
+		if setFunc != nil {
+			key = strconv.Itoa(setFunc(elem))
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, elem)
+	}
+	return unique
 }
 
 func recurseAssign(nesting []string, value interface{}, obj map[string]interface{}) (map[string]interface{}, error) {
@@ -41,3 +239,15 @@ func recurseAssign(nesting []string, value interface{}, obj map[string]interface
 	}
 	return obj, nil
 }
+
+func toStringList(field string, list []interface{}) ([]string, error) {
+	strList := make([]string, len(list))
+	for i, elem := range list {
+		str, ok := elem.(string)
+		if !ok {
+			return nil, fmt.Errorf("field [%s] must be an array of strings, invalid element: %v", field, elem)
+		}
+		strList[i] = str
+	}
+	return strList, nil
+}
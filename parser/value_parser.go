@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"math/big"
+)
+
+// evaluate decodes an expression and evaluates it against the declarations
+// decoded so far.
+func (p *Parser) evaluate(expr ast.Expression, schem *state.ParsedState) (cty.Value, error) {
+	value, _, err := p.evaluateSensitive(expr, schem)
+	return value, err
+}
+
+// evaluateSensitive evaluates an expression, also returning whether it
+// references a sensitive variable, local or module output.
+func (p *Parser) evaluateSensitive(expr ast.Expression, schem *state.ParsedState) (cty.Value, bool, error) {
+	decoded, err := p.decodeExpression(expr)
+	if err != nil {
+		return cty.NilVal, false, err
+	}
+	ctx := p.newEvalContext(schem)
+	sensitive := false
+	ctx.sensitive = &sensitive
+	value, err := decoded.Value(ctx)
+	if err != nil {
+		return cty.NilVal, false, wrapError(err, expr.Range(), "Invalid expression")
+	}
+	return value, sensitive, nil
+}
+
+// evaluateValue evaluates an expression into the form values are stored in
+// state.
+func (p *Parser) evaluateValue(expr ast.Expression, schem *state.ParsedState) (interface{}, error) {
+	value, err := p.evaluate(expr, schem)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fromCtyValue(value)
+	if err != nil {
+		return nil, wrapError(err, expr.Range(), "Invalid value")
+	}
+	return result, nil
+}
+
+// evaluateString evaluates an expression that must result in a string
+func (p *Parser) evaluateString(field string, expr ast.Expression, schem *state.ParsedState) (string, error) {
+	value, err := p.evaluate(expr, schem)
+	if err != nil {
+		return "", err
+	}
+	str, err := convert.Convert(value, cty.String)
+	if err != nil || str.IsNull() {
+		return "", diagnostics.Errorf(expr.Range(), "Invalid value", "field [%s] must be a string", field)
+	}
+	return str.AsString(), nil
+}
+
+// toCtyValue converts a value stored in state, or read from a data source,
+// into a cty.Value. Blocks become objects and arrays become tuples.
+func toCtyValue(value interface{}) cty.Value {
+	switch v := value.(type) {
+	case string:
+		return cty.StringVal(v)
+	case int:
+		return cty.NumberIntVal(int64(v))
+	case float64:
+		return cty.NumberFloatVal(v)
+	case bool:
+		return cty.BoolVal(v)
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return cty.EmptyObjectVal
+		}
+		attributes := make(map[string]cty.Value, len(v))
+		for key, elem := range v {
+			attributes[key] = toCtyValue(elem)
+		}
+		return cty.ObjectVal(attributes)
+	case []interface{}:
+		if len(v) == 0 {
+			return cty.EmptyTupleVal
+		}
+		elems := make([]cty.Value, len(v))
+		for i, elem := range v {
+			elems[i] = toCtyValue(elem)
+		}
+		return cty.TupleVal(elems)
+	}
+	return cty.NullVal(cty.DynamicPseudoType)
+}
+
+// fromCtyValue converts a cty.Value into the form values are stored in
+// state. Whole numbers become an int and other numbers a float64, objects
+// and maps become blocks and all other collections become arrays.
+func fromCtyValue(value cty.Value) (interface{}, error) {
+	if value.IsNull() {
+		return nil, fmt.Errorf("value must not be null")
+	} else if !value.IsKnown() {
+		return nil, fmt.Errorf("value must be known")
+	}
+	ty := value.Type()
+	switch {
+	case ty == cty.String:
+		return value.AsString(), nil
+	case ty == cty.Bool:
+		return value.True(), nil
+	case ty == cty.Number:
+		number := value.AsBigFloat()
+		if i, accuracy := number.Int64(); number.IsInt() && accuracy == big.Exact {
+			return int(i), nil
+		}
+		f, _ := number.Float64()
+		return f, nil
+	case ty.IsObjectType() || ty.IsMapType():
+		block := make(map[string]interface{})
+		for it := value.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			converted, err := fromCtyValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			block[key.AsString()] = converted
+		}
+		return block, nil
+	case value.CanIterateElements():
+		list := make([]interface{}, 0, value.LengthInt())
+		for it := value.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			converted, err := fromCtyValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, converted)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %s", ty.FriendlyName())
+}
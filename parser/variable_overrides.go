@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// VariableEnvPrefix is the prefix of environment variables that assign a
+// value to a variable, e.g. SCHEMATIC_VAR_pidsMax=20
+const VariableEnvPrefix = "SCHEMATIC_VAR_"
+
+// VariableOverride is a value assigned to a variable from outside of the
+// schematic files, replacing the declared value or default.
+type VariableOverride struct {
+	Value    cty.Value
+	BaseType schematic.ValueType
+	// Literal is the text of a value assigned by a flag, variable file,
+	// environment variable or prompt. It is only converted once the type of
+	// the variable is known, as 007 is a number to an int variable but a
+	// string to a string variable. Value is null for these overrides.
+	Literal string
+	// Quoted is true if the literal was quoted, which makes it a string
+	Quoted bool
+	// Source describes where the value was assigned, used in errors
+	Source string
+	// subject is the range of the assignment in a variable file
+	subject *diagnostics.Range
+	// environment is true for values from environment variables, which may
+	// be set for other configurations and so are not reported when there is
+	// no such variable
+	environment bool
+}
+
+// VariableOverrides maps variable names to their assigned values. Values
+// added later take precedence over those added before them, so overrides
+// should be added from the lowest to the highest precedence:
+//
+// 1. Environment variables (SCHEMATIC_VAR_<NAME>)
+// 2. Variable files (-var-file), in the order given
+// 3. Variable flags (-var), in the order given
+type VariableOverrides map[string]*VariableOverride
+
+// VariablePrompt requests a value for a variable that has no value, the
+// returned string is interpreted in the same way as a -var flag value.
+type VariablePrompt func(variable *state.Variable) (string, error)
+
+// AddEnvironment adds the value of every environment variable prefixed with
+// VariableEnvPrefix.
+func (o VariableOverrides) AddEnvironment(environ []string) {
+	for _, env := range environ {
+		if !strings.HasPrefix(env, VariableEnvPrefix) {
+			continue
+		}
+		assignment := strings.SplitN(strings.TrimPrefix(env, VariableEnvPrefix), "=", 2)
+		if len(assignment) != 2 || assignment[0] == "" {
+			continue
+		}
+		o[assignment[0]] = &VariableOverride{
+			Literal:     assignment[1],
+			Source:      "environment variable " + VariableEnvPrefix + assignment[0],
+			environment: true,
+		}
+	}
+}
+
+// AddFlag adds the value of a -var flag of the form <NAME>=<VALUE>.
+func (o VariableOverrides) AddFlag(flag string) error {
+	assignment := strings.SplitN(flag, "=", 2)
+	if len(assignment) != 2 || assignment[0] == "" {
+		return fmt.Errorf("invalid variable assignment, must be of the form <NAME>=<VALUE>: %s", flag)
+	}
+	o[assignment[0]] = &VariableOverride{
+		Literal: assignment[1],
+		Source:  "-var flag",
+	}
+	return nil
+}
+
+// AddFile adds every assignment in a variable file. Each assignment is of the
+// form <NAME> = <VALUE>, where the value is any expression that does not
+// reference other values, as in a variable declaration. Single literals are
+// converted once the type of the variable is known, as with -var flags.
+func (o VariableOverrides) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return o.addFromReader(f, path)
+}
+
+func (o VariableOverrides) addFromReader(r io.Reader, path string) error {
+	p := NewParser(r)
+	p.SetFilename(path)
+	for {
+		tok, name := p.scanIgnoreWhitespace(false)
+		if tok == EOF {
+			return nil
+		} else if !isLabel(tok) {
+			return p.errorf("Invalid variable name", "invalid variable name in variable file: %s", name)
+		}
+		subject := p.rng()
+		tok, lit := p.scanIgnoreWhitespace(false)
+		if tok != EQUALS {
+			return p.errorf("Invalid assignment", "missing assignment operator '=' in variable file: %s %s", name, lit)
+		}
+		expr, err := p.parseExpression()
+		if err != nil {
+			return err
+		}
+		override := &VariableOverride{
+			Source:  "variable file " + path,
+			subject: &subject,
+		}
+		switch expr := expr.(type) {
+		case *ast.IdentExpr:
+			override.Literal = expr.Name.Lit
+		case *ast.NumberExpr:
+			override.Literal = expr.Token.Lit
+		case *ast.StringExpr:
+			override.Literal = expr.Token.Lit
+			override.Quoted = true
+		default:
+			override.Value, override.BaseType, err = p.decodeVariableValue(variableValueField, expr)
+			if err != nil {
+				return err
+			}
+		}
+		o[name] = override
+	}
+}
+
+// literalValue converts the literal of an override to the declared type of
+// the variable. Lists and maps are written as expressions, such as
+// ["a", "b"]. Literals assigned to a variable without a type keep the type
+// of its declared value if that is a string, list or map, otherwise they are
+// parsed as a boolean, integer or float before falling back to a string.
+func (o *VariableOverride) literalValue(variable *state.Variable, varType *variableType) (cty.Value, schematic.ValueType, error) {
+	tok := IDENT
+	if o.Quoted {
+		tok = STRING
+	}
+	switch {
+	case variable.BaseType == schematic.TypeString:
+		return cty.StringVal(o.Literal), schematic.TypeString, nil
+	case variable.BaseType == schematic.TypeList || variable.BaseType == schematic.TypeMap:
+		value, err := o.expressionValue()
+		if err != nil {
+			return cty.NilVal, schematic.TypeInvalid, fmt.Errorf("variable [%s] value from %s is not a valid %s: %s", variable.Name, o.Source, typeName(variable.BaseType), err.Error())
+		} else if varType == nil {
+			return value, valueBaseType(value), nil
+		}
+		value, err = convertVariableValue(variable, varType, value, "value from "+o.Source)
+		return value, variable.BaseType, err
+	case varType == nil:
+		value, baseType := parseLiteral(tok, o.Literal)
+		return value, baseType, nil
+	}
+	value, _ := parseLiteral(tok, o.Literal)
+	value, err := convertVariableValue(variable, varType, value, "value from "+o.Source)
+	return value, variable.BaseType, err
+}
+
+// expressionValue parses the literal of an override as an expression
+func (o *VariableOverride) expressionValue() (cty.Value, error) {
+	if o.Quoted {
+		return cty.NilVal, fmt.Errorf("the value must not be quoted")
+	}
+	p := NewParser(strings.NewReader(o.Literal))
+	expr, err := p.parseExpression()
+	if err == nil {
+		if tok, lit := p.scanIgnoreWhitespace(false); tok != EOF {
+			err = fmt.Errorf("unexpected %s after the value", lit)
+		}
+	}
+	var value cty.Value
+	if err == nil {
+		value, _, err = p.decodeVariableValue(variableValueField, expr)
+	}
+	if diag, ok := err.(*diagnostics.Diagnostic); ok {
+		return cty.NilVal, fmt.Errorf("%s", diag.Detail)
+	}
+	return value, err
+}
+
+// SetVariableOverrides sets the values that replace the declared value of a
+// variable.
+func (p *Parser) SetVariableOverrides(overrides VariableOverrides) {
+	p.overrides = overrides
+}
+
+// SetVariablePrompt sets the prompt used to request a value for a variable
+// that has no value, default or override.
+func (p *Parser) SetVariablePrompt(prompt VariablePrompt) {
+	p.prompt = prompt
+}
+
+// applyVariableOverride replaces the value of the variable with its override,
+// if any, prompting for a value when the variable is left without one.
+func (p *Parser) applyVariableOverride(variable *state.Variable, varType *variableType, declRange diagnostics.Range) error {
+	override, ok := p.overrides[variable.Name]
+	if !ok && variable.Value.IsNull() && p.prompt != nil {
+		input, err := p.prompt(variable)
+		if err != nil {
+			return diagnostics.Errorf(declRange, "Missing variable value", "could not read value for variable [%s]: %s", variable.Name, err.Error())
+		}
+		override = &VariableOverride{
+			Literal: input,
+			Source:  "input",
+		}
+	} else if !ok && variable.Value.IsNull() {
+		return diagnostics.Errorf(
+			declRange,
+			"Missing variable value",
+			"no value for required variable [%s], set one with -var, -var-file or %s%s",
+			variable.Name,
+			VariableEnvPrefix,
+			variable.Name,
+		)
+	} else if !ok {
+		return nil
+	}
+	if override.Value.IsNull() {
+		value, baseType, err := override.literalValue(variable, varType)
+		if err != nil {
+			return wrapError(err, declRange, "Invalid variable value")
+		}
+		variable.Value = value
+		variable.BaseType = baseType
+		return nil
+	} else if varType == nil {
+		variable.Value = override.Value
+		variable.BaseType = override.BaseType
+		return nil
+	}
+	value, err := convertVariableValue(variable, varType, override.Value, "value from "+override.Source)
+	if err != nil {
+		return wrapError(err, declRange, "Invalid variable value")
+	}
+	variable.Value = value
+	return nil
+}
+
+// undeclaredOverrides warns of each value assigned by a flag or variable
+// file to a variable that the configuration does not declare, which is
+// otherwise ignored. The inputs of a module are checked by
+// checkModuleInputs.
+func (p *Parser) undeclaredOverrides(variables []*ast.Block) diagnostics.Diagnostics {
+	declared := make(map[string]bool, len(variables))
+	for _, block := range variables {
+		if len(block.Labels) > 0 {
+			declared[block.Labels[0].Lit] = true
+		}
+	}
+	names := make([]string, 0, len(p.overrides))
+	for name := range p.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diags diagnostics.Diagnostics
+	for _, name := range names {
+		override := p.overrides[name]
+		if declared[name] || !override.Value.IsNull() || override.environment {
+			continue
+		}
+		diags = append(diags, &diagnostics.Diagnostic{
+			Severity: diagnostics.SeverityWarning,
+			Summary:  "Undeclared variable",
+			Detail:   fmt.Sprintf("a value for variable [%s] was set by %s, but the configuration does not declare it", name, override.Source),
+			Subject:  override.subject,
+		})
+	}
+	return diags
+}
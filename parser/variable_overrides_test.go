@@ -0,0 +1,408 @@
+package parser
+
+import (
+	"errors"
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"strings"
+	"testing"
+)
+
+// parseWithOverrides parses the source with the given overrides
+func parseWithOverrides(src string, overrides VariableOverrides) (*state.ParsedState, error) {
+	p := NewParser(strings.NewReader(src))
+	p.SetVariableOverrides(overrides)
+	return p.Parse()
+}
+
+func TestVariableOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		flag     string
+		want     cty.Value
+		baseType schematic.ValueType
+	}{
+		{
+			name:     "string keeps leading zero",
+			src:      "variable \"v\" {\ntype = string\nvalue = \"x\"\n}",
+			flag:     "v=007",
+			want:     cty.StringVal("007"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:     "int",
+			src:      "variable \"v\" {\ntype = int\nvalue = 1\n}",
+			flag:     "v=007",
+			want:     cty.NumberIntVal(7),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "exponent to int",
+			src:      "variable \"v\" {\ntype = int\nvalue = 1\n}",
+			flag:     "v=1e3",
+			want:     cty.NumberIntVal(1000),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "exponent to string",
+			src:      "variable \"v\" {\ntype = string\nvalue = \"x\"\n}",
+			flag:     "v=1e3",
+			want:     cty.StringVal("1e3"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:     "untyped string value",
+			src:      `variable "v" = "x"`,
+			flag:     "v=true",
+			want:     cty.StringVal("true"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:     "untyped number value",
+			src:      `variable "v" = 1`,
+			flag:     "v=2.5",
+			want:     cty.NumberFloatVal(2.5),
+			baseType: schematic.TypeFloat,
+		},
+		{
+			name:     "bool",
+			src:      "variable \"v\" {\ntype = bool\ndefault = false\n}",
+			flag:     "v=true",
+			want:     cty.True,
+			baseType: schematic.TypeBool,
+		},
+		{
+			name:     "list",
+			src:      "variable \"v\" {\ntype = list(string)\ndefault = []\n}",
+			flag:     `v=["a", "b"]`,
+			want:     cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+			baseType: schematic.TypeList,
+		},
+		{
+			name:     "map",
+			src:      "variable \"v\" {\ntype = map(int)\ndefault = {}\n}",
+			flag:     `v={ http = 80 }`,
+			want:     cty.MapVal(map[string]cty.Value{"http": cty.NumberIntVal(80)}),
+			baseType: schematic.TypeMap,
+		},
+		{
+			name:     "required variable",
+			src:      "variable \"v\" {\ntype = int\n}",
+			flag:     "v=3",
+			want:     cty.NumberIntVal(3),
+			baseType: schematic.TypeInt,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overrides := make(VariableOverrides)
+			if err := overrides.AddFlag(test.flag); err != nil {
+				t.Fatal(err)
+			}
+			schem, err := parseWithOverrides(test.src, overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			variable := schem.Variables["v"]
+			if !variable.Value.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", variable.Value, test.want)
+			}
+			if variable.BaseType != test.baseType {
+				t.Errorf("got type %v, want %v", variable.BaseType, test.baseType)
+			}
+		})
+	}
+}
+
+func TestVariableOverrideErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		flag    string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "not an int",
+			src:     "variable \"v\" {\ntype = int\nvalue = 1\n}",
+			flag:    "v=many",
+			summary: "Invalid variable value",
+			detail:  "variable [v] value from -var flag is not a valid int: a number is required",
+		},
+		{
+			name:    "fractional int",
+			src:     "variable \"v\" {\ntype = int\nvalue = 1\n}",
+			flag:    "v=1.5",
+			summary: "Invalid variable value",
+			detail:  "variable [v] value from -var flag is not a valid int",
+		},
+		{
+			name:    "quoted list",
+			src:     "variable \"v\" {\ntype = list(string)\ndefault = []\n}",
+			flag:    `v="a"`,
+			summary: "Invalid variable value",
+			detail:  "variable [v] value from -var flag is not a valid list",
+		},
+		{
+			name:    "element of the wrong type",
+			src:     "variable \"v\" {\ntype = list(int)\ndefault = []\n}",
+			flag:    `v=["a"]`,
+			summary: "Invalid variable value",
+			detail:  "variable [v] value from -var flag is not a valid list(int)",
+		},
+		{
+			name:    "failed validation",
+			src:     "variable \"v\" {\nvalue = 1\nvalidation {\ncondition = var.v < 10\nerror_message = \"v is too large\"\n}\n}",
+			flag:    "v=20",
+			summary: "Invalid value for variable",
+			detail:  "invalid value for variable [v]: v is too large",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overrides := make(VariableOverrides)
+			if err := overrides.AddFlag(test.flag); err != nil {
+				t.Fatal(err)
+			}
+			_, err := parseWithOverrides(test.src, overrides)
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
+
+func TestVariableOverridePrecedence(t *testing.T) {
+	overrides := make(VariableOverrides)
+	overrides.AddEnvironment([]string{
+		VariableEnvPrefix + "a=env",
+		VariableEnvPrefix + "b=env",
+		VariableEnvPrefix + "c=env",
+		"OTHER=ignored",
+	})
+	if err := overrides.addFromReader(strings.NewReader("b = \"file\"\nc = \"file\"\n"), "test.schmvars"); err != nil {
+		t.Fatal(err)
+	}
+	if err := overrides.AddFlag("c=flag"); err != nil {
+		t.Fatal(err)
+	}
+	src := "variable \"a\" = \"declared\"\nvariable \"b\" = \"declared\"\nvariable \"c\" = \"declared\"\nvariable \"d\" = \"declared\"\n"
+	schem, err := parseWithOverrides(src, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "env", "b": "file", "c": "flag", "d": "declared"}
+	for name, value := range want {
+		if got := schem.Variables[name].Value; !got.RawEquals(cty.StringVal(value)) {
+			t.Errorf("variable %s: got %#v, want %q", name, got, value)
+		}
+	}
+}
+
+func TestVariableFile(t *testing.T) {
+	overrides := make(VariableOverrides)
+	src := `names = ["a", "b"]
+ports = { http = 80, https = 443 }
+id = 007
+tags = ["x", 1]
+replicas = 2 * 3
+`
+	if err := overrides.addFromReader(strings.NewReader(src), "test.schmvars"); err != nil {
+		t.Fatal(err)
+	}
+	schem, err := parseWithOverrides(`variable "names" {
+  type    = list(string)
+  default = []
+}
+variable "ports" {
+  type    = map(int)
+  default = {}
+}
+variable "id" {
+  type    = string
+  default = ""
+}
+variable "tags" = []
+variable "replicas" = 1
+`, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]cty.Value{
+		"names":    cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"ports":    cty.MapVal(map[string]cty.Value{"http": cty.NumberIntVal(80), "https": cty.NumberIntVal(443)}),
+		"id":       cty.StringVal("007"),
+		"tags":     cty.TupleVal([]cty.Value{cty.StringVal("x"), cty.NumberIntVal(1)}),
+		"replicas": cty.NumberIntVal(6),
+	}
+	for name, value := range want {
+		if got := schem.Variables[name].Value; !got.RawEquals(value) {
+			t.Errorf("variable %s: got %#v, want %#v", name, got, value)
+		}
+	}
+}
+
+func TestUndeclaredVariableOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		add      func(overrides VariableOverrides) error
+		warnings []string
+	}{
+		{
+			name: "flag",
+			add: func(overrides VariableOverrides) error {
+				return overrides.AddFlag("missing=1")
+			},
+			warnings: []string{"a value for variable [missing] was set by -var flag, but the configuration does not declare it"},
+		},
+		{
+			name: "variable file",
+			add: func(overrides VariableOverrides) error {
+				return overrides.addFromReader(strings.NewReader("v = 2\nmissing = 1\n"), "test.schmvars")
+			},
+			warnings: []string{"a value for variable [missing] was set by variable file test.schmvars, but the configuration does not declare it"},
+		},
+		{
+			name: "environment",
+			add: func(overrides VariableOverrides) error {
+				overrides.AddEnvironment([]string{VariableEnvPrefix + "missing=1"})
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			overrides := make(VariableOverrides)
+			if err := test.add(overrides); err != nil {
+				t.Fatal(err)
+			}
+			_, p, err := parseSource(`variable "v" = 1`, overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			warnings := p.Warnings()
+			if len(warnings) != len(test.warnings) {
+				t.Fatalf("got %d warnings %v, want %d", len(warnings), warnings, len(test.warnings))
+			}
+			for i, warning := range warnings {
+				if warning.Summary != "Undeclared variable" || warning.Detail != test.warnings[i] {
+					t.Errorf("got %s: %s, want Undeclared variable: %s", warning.Summary, warning.Detail, test.warnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVariablePrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		input   string
+		err     error
+		want    cty.Value
+		wantErr string
+	}{
+		{
+			name:  "required variable",
+			src:   "variable \"v\" {\ntype = int\n}",
+			input: "5",
+			want:  cty.NumberIntVal(5),
+		},
+		{
+			name:  "not prompted with a value",
+			src:   "variable \"v\" {\ntype = int\ndefault = 1\n}",
+			input: "5",
+			want:  cty.NumberIntVal(1),
+		},
+		{
+			name:    "invalid input",
+			src:     "variable \"v\" {\ntype = int\n}",
+			input:   "many",
+			wantErr: "Invalid variable value; variable [v] value from input is not a valid int: a number is required",
+		},
+		{
+			name:    "prompt fails",
+			src:     "variable \"v\" {\ntype = int\n}",
+			err:     errors.New("EOF"),
+			wantErr: "Missing variable value; could not read value for variable [v]: EOF",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewParser(strings.NewReader(test.src))
+			p.SetVariablePrompt(func(variable *state.Variable) (string, error) {
+				return test.input, test.err
+			})
+			schem, err := p.Parse()
+			if test.wantErr != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), test.wantErr) {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := schem.Variables["v"].Value; !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVariableOverrideSyntax(t *testing.T) {
+	tests := []struct {
+		name string
+		add  func(overrides VariableOverrides) error
+		want string
+	}{
+		{
+			name: "flag without assignment",
+			add: func(overrides VariableOverrides) error {
+				return overrides.AddFlag("v")
+			},
+			want: "invalid variable assignment, must be of the form <NAME>=<VALUE>: v",
+		},
+		{
+			name: "flag without name",
+			add: func(overrides VariableOverrides) error {
+				return overrides.AddFlag("=1")
+			},
+			want: "invalid variable assignment, must be of the form <NAME>=<VALUE>: =1",
+		},
+		{
+			name: "file without equals",
+			add: func(overrides VariableOverrides) error {
+				return overrides.addFromReader(strings.NewReader("v 1\n"), "test.schmvars")
+			},
+			want: "test.schmvars:1:3: Invalid assignment; missing assignment operator '=' in variable file: v 1",
+		},
+		{
+			name: "file with a reference",
+			add: func(overrides VariableOverrides) error {
+				return overrides.addFromReader(strings.NewReader("v = [var.a]\n"), "test.schmvars")
+			},
+			want: "test.schmvars:1:6: Reference to undeclared variable; no such variable: a",
+		},
+		{
+			name: "file with an unterminated array",
+			add: func(overrides VariableOverrides) error {
+				return overrides.addFromReader(strings.NewReader("v = [1\n"), "test.schmvars")
+			},
+			want: "test.schmvars:2:1: Missing comma; missing comma between array elements",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.add(make(VariableOverrides))
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want %q", err, test.want)
+			}
+		})
+	}
+}
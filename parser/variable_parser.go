@@ -2,52 +2,436 @@ package parser
 
 import (
 	"fmt"
+	"github.com/EngineersBox/Schematic/ast"
 	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/diagnostics"
 	"github.com/EngineersBox/Schematic/state"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 	"strconv"
+	"strings"
 )
 
-func (p *Parser) parseVariable() (string, *state.Variable, error) {
-	newVar := &state.Variable{}
-	token, name := p.scanIgnoreWhitespace(false)
-	if token != IDENT {
-		return "", nil, fmt.Errorf("not a valid variable name")
+const (
+	variableKeyword             = "variable"
+	variableValueField          = "value"
+	variableTypeField           = "type"
+	variableDefaultField        = "default"
+	variableDescriptionField    = "description"
+	variableSensitiveField      = "sensitive"
+	variableValidationField     = "validation"
+	validationConditionField    = "condition"
+	validationErrorMessageField = "error_message"
+)
+
+var variableTypes = map[string]schematic.ValueType{
+	"string": schematic.TypeString,
+	"int":    schematic.TypeInt,
+	"float":  schematic.TypeFloat,
+	"bool":   schematic.TypeBool,
+}
+
+var collectionTypes = map[string]schematic.ValueType{
+	"list": schematic.TypeList,
+	"map":  schematic.TypeMap,
+}
+
+// variableType is the type declared by a variable, either a basic type or a
+// list or map of elements of a declared type.
+type variableType struct {
+	base schematic.ValueType
+	elem *variableType
+}
+
+type variableValidation struct {
+	condition    Expression
+	errorMessage string
+	rng          diagnostics.Range
+}
+
+// decodeVariable decodes either the block form of a variable declaration
+// (variable "name" { value = <B> }) or the shorthand form
+// (variable "name" = <B>).
+func (p *Parser) decodeVariable(block *ast.Block, schem *state.ParsedState) (*state.Variable, error) {
+	if err := checkBlock(block, true, "name"); err != nil {
+		return nil, err
 	}
-	newVar.Name = name
-	tok, lit := p.scanIgnoreWhitespace(false)
-	if tok != OPENBRACE {
-		return "", nil, fmt.Errorf("missing open brace in variable declaration")
+	newVar := &state.Variable{
+		Name:        block.Labels[0].Lit,
+		Value:       cty.NullVal(cty.DynamicPseudoType),
+		Default:     cty.NullVal(cty.DynamicPseudoType),
+		Validations: make([]*state.VariableValidation, 0),
 	}
-	tok, lit = p.scanIgnoreWhitespace(false)
-	if tok != IDENT || lit != "value" {
-		return "", nil, fmt.Errorf("variable body must only have value declaration")
+	declRange := block.Labels[0].Range
+	var validations []*variableValidation
+	var varType *variableType
+	if block.Value != nil {
+		value, baseType, err := p.decodeVariableValue(variableValueField, block.Value)
+		if err != nil {
+			return nil, err
+		}
+		newVar.Value = value
+		newVar.BaseType = baseType
+	} else {
+		var err error
+		validations, varType, err = p.decodeVariableBody(block, newVar)
+		if err != nil {
+			return nil, err
+		}
 	}
-	tok, lit = p.scanIgnoreWhitespace(false)
-	if tok != EQUALS {
-		return "", nil, fmt.Errorf("missing assignment operator '=' in variable declaration")
+	err := p.applyVariableOverride(newVar, varType, declRange)
+	if err != nil {
+		return nil, err
 	}
-	tok, lit = p.scanIgnoreWhitespace(false)
-	if tok != IDENT {
-		return "", nil, fmt.Errorf("variable value must only contain a literal")
+	err = validateVariable(newVar, validations, schem)
+	if err != nil {
+		return nil, err
 	}
-	val, err := strconv.ParseInt(lit, 10, 64)
+	return newVar, nil
+}
+
+// decodeVariableBody decodes the fields of a variable block, returning the
+// validation rules and the declared type, which is nil if the variable does
+// not declare one.
+func (p *Parser) decodeVariableBody(block *ast.Block, newVar *state.Variable) ([]*variableValidation, *variableType, error) {
+	validations := make([]*variableValidation, 0)
+	var declaredType *variableType
+	var inferredType schematic.ValueType
+	var valueRange, defaultRange diagnostics.Range
+	for _, item := range block.Body {
+		if nested, ok := item.(*ast.Block); ok {
+			if nested.Type.Lit != variableValidationField || len(nested.Labels) > 0 || nested.Value != nil {
+				return nil, nil, diagnostics.Errorf(nested.Type.Range, "Unsupported block", "variable [%s] has no block: %s", newVar.Name, nested.Type.Lit)
+			}
+			validation, err := p.decodeVariableValidation(nested, newVar)
+			if err != nil {
+				return nil, nil, err
+			}
+			validations = append(validations, validation)
+			continue
+		}
+		attribute := item.(*ast.Attribute)
+		field := attribute.Name.Lit
+		switch field {
+		case variableValueField:
+			value, baseType, err := p.decodeVariableValue(field, attribute.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			newVar.Value = value
+			valueRange = attribute.Value.Range()
+			inferredType = baseType
+		case variableDefaultField:
+			value, baseType, err := p.decodeVariableValue(field, attribute.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			newVar.Default = value
+			defaultRange = attribute.Value.Range()
+			if newVar.Value.IsNull() {
+				inferredType = baseType
+			}
+		case variableTypeField:
+			var ok bool
+			declaredType, ok = decodeVariableType(attribute.Value)
+			if !ok {
+				return nil, nil, diagnostics.Errorf(
+					attribute.Value.Range(),
+					"Invalid type",
+					"invalid type for variable [%s], must be string, int, float, bool, list(<TYPE>) or map(<TYPE>): %s",
+					newVar.Name,
+					strings.TrimSpace(string(ast.Bytes(attribute.Value))),
+				)
+			}
+		case variableDescriptionField:
+			str, ok := attribute.Value.(*ast.StringExpr)
+			if !ok {
+				return nil, nil, diagnostics.Errorf(attribute.Value.Range(), "Invalid value", "variable [%s] description must be a string", newVar.Name)
+			}
+			newVar.Description = str.Token.Lit
+		case variableSensitiveField:
+			value, baseType, err := p.decodeVariableValue(field, attribute.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			if baseType != schematic.TypeBool {
+				return nil, nil, diagnostics.Errorf(attribute.Value.Range(), "Invalid value", "variable [%s] sensitive must be a boolean", newVar.Name)
+			}
+			newVar.Sensitive = value.True()
+		default:
+			return nil, nil, diagnostics.Errorf(attribute.Name.Range, "Unsupported field", "variable [%s] has no field: %s", newVar.Name, field)
+		}
+	}
+	if declaredType == nil {
+		newVar.BaseType = inferredType
+		if newVar.Value.IsNull() {
+			newVar.Value = newVar.Default
+		}
+		return validations, nil, nil
+	}
+	newVar.BaseType = declaredType.base
+	var err error
+	newVar.Default, err = convertVariableValue(newVar, declaredType, newVar.Default, variableDefaultField)
+	if err != nil {
+		return nil, nil, wrapError(err, defaultRange, "Invalid variable default")
+	}
+	newVar.Value, err = convertVariableValue(newVar, declaredType, newVar.Value, variableValueField)
+	if err != nil {
+		return nil, nil, wrapError(err, valueRange, "Invalid variable value")
+	}
+	if newVar.Value.IsNull() {
+		newVar.Value = newVar.Default
+	}
+	return validations, declaredType, nil
+}
+
+func (p *Parser) decodeVariableValidation(block *ast.Block, newVar *state.Variable) (*variableValidation, error) {
+	validation := &variableValidation{rng: block.Type.Range}
+	for _, item := range block.Body {
+		attribute, ok := item.(*ast.Attribute)
+		if !ok {
+			nested := item.(*ast.Block)
+			return nil, diagnostics.Errorf(nested.Type.Range, "Unsupported block", "validation of variable [%s] has no block: %s", newVar.Name, nested.Type.Lit)
+		}
+		field := attribute.Name.Lit
+		switch field {
+		case validationConditionField:
+			condition, err := p.decodeExpression(attribute.Value)
+			if err != nil {
+				return nil, err
+			}
+			validation.condition = condition
+		case validationErrorMessageField:
+			str, ok := attribute.Value.(*ast.StringExpr)
+			if !ok {
+				return nil, diagnostics.Errorf(attribute.Value.Range(), "Invalid value", "validation error message of variable [%s] must be a string", newVar.Name)
+			}
+			validation.errorMessage = str.Token.Lit
+		default:
+			return nil, diagnostics.Errorf(attribute.Name.Range, "Unsupported field", "validation of variable [%s] has no field: %s", newVar.Name, field)
+		}
+	}
+	if validation.condition == nil || validation.errorMessage == "" {
+		return nil, diagnostics.Errorf(
+			validation.rng,
+			"Incomplete validation",
+			"validation of variable [%s] must declare both %s and %s",
+			newVar.Name,
+			validationConditionField,
+			validationErrorMessageField,
+		)
+	}
+	newVar.Validations = append(newVar.Validations, &state.VariableValidation{
+		Condition:    validation.condition.String(),
+		ErrorMessage: validation.errorMessage,
+	})
+	return validation, nil
+}
+
+// decodeVariableValue evaluates an expression assigned to a field of a
+// variable. Variables are decoded before any other declaration, so the
+// expression cannot reference one. Numbers written with a decimal point or
+// f suffix are floats, as with parseLiteral.
+func (p *Parser) decodeVariableValue(field string, expr ast.Expression) (cty.Value, schematic.ValueType, error) {
+	decoded, err := p.decodeExpression(expr)
 	if err != nil {
-		val, err := strconv.ParseFloat(lit, 64)
+		return cty.NilVal, schematic.TypeInvalid, err
+	}
+	value, err := decoded.Value(&EvalContext{})
+	if err != nil {
+		return cty.NilVal, schematic.TypeInvalid, wrapError(err, expr.Range(), "Invalid variable "+field)
+	} else if !value.IsWhollyKnown() {
+		return cty.NilVal, schematic.TypeInvalid, diagnostics.Errorf(expr.Range(), "Invalid variable "+field, "variable %s must be known", field)
+	}
+	if number, ok := expr.(*ast.NumberExpr); ok {
+		_, baseType := parseLiteral(NUMBER, number.Token.Lit)
+		return value, baseType, nil
+	}
+	return value, valueBaseType(value), nil
+}
+
+// valueBaseType returns the type of a value: arrays are lists, blocks are
+// maps and numbers are ints if they are whole.
+func valueBaseType(value cty.Value) schematic.ValueType {
+	ty := value.Type()
+	switch {
+	case value.IsNull():
+		return schematic.TypeInvalid
+	case ty == cty.String:
+		return schematic.TypeString
+	case ty == cty.Bool:
+		return schematic.TypeBool
+	case ty == cty.Number && value.IsKnown() && value.AsBigFloat().IsInt():
+		return schematic.TypeInt
+	case ty == cty.Number:
+		return schematic.TypeFloat
+	case ty.IsTupleType() || ty.IsListType() || ty.IsSetType():
+		return schematic.TypeList
+	case ty.IsObjectType() || ty.IsMapType():
+		return schematic.TypeMap
+	}
+	return schematic.TypeInvalid
+}
+
+// decodeVariableType decodes a type constraint, one of string, int, float
+// and bool, or list(<TYPE>) and map(<TYPE>) of elements of another type.
+func decodeVariableType(expr ast.Expression) (*variableType, bool) {
+	switch e := expr.(type) {
+	case *ast.IdentExpr:
+		if base := variableTypes[e.Name.Lit]; base != schematic.TypeInvalid {
+			return &variableType{base: base}, true
+		}
+	case *ast.FunctionCallExpr:
+		base := collectionTypes[e.Name.Lit]
+		if base == schematic.TypeInvalid || len(e.Args) != 1 {
+			return nil, false
+		}
+		if elem, ok := decodeVariableType(e.Args[0]); ok {
+			return &variableType{base: base, elem: elem}, true
+		}
+	}
+	return nil, false
+}
+
+func (t *variableType) ctyType() cty.Type {
+	switch t.base {
+	case schematic.TypeString:
+		return cty.String
+	case schematic.TypeBool:
+		return cty.Bool
+	case schematic.TypeList:
+		return cty.List(t.elem.ctyType())
+	case schematic.TypeMap:
+		return cty.Map(t.elem.ctyType())
+	}
+	return cty.Number
+}
+
+// isWhole returns false if the value is, or contains, a number that is not
+// a whole number where the type is an int.
+func (t *variableType) isWhole(value cty.Value) bool {
+	if value.IsNull() {
+		return true
+	}
+	switch t.base {
+	case schematic.TypeInt:
+		return value.AsBigFloat().IsInt()
+	case schematic.TypeList, schematic.TypeMap:
+		for it := value.ElementIterator(); it.Next(); {
+			if _, elem := it.Element(); !t.elem.isWhole(elem) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (t *variableType) String() string {
+	if t.elem != nil {
+		return fmt.Sprintf("%s(%s)", typeName(t.base), t.elem)
+	}
+	return typeName(t.base)
+}
+
+// convertVariableValue converts a value to the declared type of the variable,
+// null values are converted to a null of the declared type.
+func convertVariableValue(variable *state.Variable, varType *variableType, value cty.Value, field string) (cty.Value, error) {
+	converted, err := convert.Convert(value, varType.ctyType())
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("variable [%s] %s is not a valid %s: %s", variable.Name, field, varType, err.Error())
+	}
+	if !varType.isWhole(converted) {
+		return cty.NilVal, fmt.Errorf("variable [%s] %s is not a valid %s", variable.Name, field, varType)
+	}
+	return converted, nil
+}
+
+func typeName(valueType schematic.ValueType) string {
+	for _, names := range []map[string]schematic.ValueType{variableTypes, collectionTypes} {
+		for name, t := range names {
+			if t == valueType {
+				return name
+			}
+		}
+	}
+	return "invalid"
+}
+
+// validateVariable evaluates each validation rule against the value of the
+// variable. Variables without a value are not validated.
+func validateVariable(variable *state.Variable, validations []*variableValidation, schem *state.ParsedState) error {
+	if variable.Value.IsNull() {
+		return nil
+	}
+	ctx := &EvalContext{
+		Variables: map[string]cty.Value{
+			variable.Name: variable.Value,
+		},
+	}
+	for name, v := range schem.Variables {
+		if name != variable.Name {
+			ctx.Variables[name] = v.Value
+		}
+	}
+	for _, validation := range validations {
+		conditionRange := validation.condition.Range()
+		result, err := validation.condition.Value(ctx)
 		if err != nil {
-			newVar.Value = cty.StringVal(lit)
-			newVar.BaseType = schematic.TypeString
-		} else {
-			newVar.Value = cty.NumberFloatVal(val)
-			newVar.BaseType = schematic.TypeFloat
+			return wrapError(err, conditionRange, "Invalid validation condition")
 		}
-	} else {
-		newVar.Value = cty.NumberIntVal(val)
-		newVar.BaseType = schematic.TypeInt
+		if result.Type() != cty.Bool || !result.IsKnown() || result.IsNull() {
+			return diagnostics.Errorf(
+				conditionRange,
+				"Invalid validation condition",
+				"validation condition for variable [%s] must be a boolean",
+				variable.Name,
+			)
+		}
+		if result.False() {
+			return diagnostics.Errorf(
+				conditionRange,
+				"Invalid value for variable",
+				"invalid value for variable [%s]: %s",
+				variable.Name,
+				validation.errorMessage,
+			)
+		}
+	}
+	return nil
+}
+
+// parseLiteral converts a literal into a value of one of the basic types.
+// Quoted literals are always strings, bare literals are parsed as a boolean,
+// integer or float before falling back to a string.
+func parseLiteral(tok Token, lit string) (cty.Value, schematic.ValueType) {
+	if tok == STRING {
+		return cty.StringVal(lit), schematic.TypeString
+	}
+	if lit == "true" || lit == "false" {
+		return cty.BoolVal(lit == "true"), schematic.TypeBool
 	}
-	tok, lit = p.scanIgnoreWhitespace(false)
-	if tok != CLOSEDBRACE {
-		return "", nil, fmt.Errorf("missing closing brace in variable declaration")
+	if val, baseType, ok := parseNumber(lit); ok {
+		return val, baseType
 	}
-	return name, newVar, nil
+	return cty.StringVal(lit), schematic.TypeString
 }
+
+// parseNumber parses an integer or float, numbers with an f suffix such as
+// 63.64f or 2f are always floats.
+func parseNumber(lit string) (cty.Value, schematic.ValueType, bool) {
+	trimmed := strings.TrimRight(lit, "fF")
+	if trimmed == lit {
+		if val, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			return cty.NumberIntVal(val), schematic.TypeInt, true
+		}
+	} else if len(lit)-len(trimmed) != 1 {
+		return cty.NilVal, schematic.TypeInvalid, false
+	}
+	if val, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		return cty.NumberFloatVal(val), schematic.TypeFloat, true
+	}
+	return cty.NilVal, schematic.TypeInvalid, false
+}
+
+// isLiteral returns true if the token can be used as a literal value
+func isLiteral(tok Token) bool { return isLabel(tok) || tok == NUMBER }
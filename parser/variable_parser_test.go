@@ -0,0 +1,360 @@
+package parser
+
+import (
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/zclconf/go-cty/cty"
+	"strings"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		want     cty.Value
+		baseType schematic.ValueType
+	}{
+		{
+			name:     "block",
+			src:      "variable \"a\" {\n  value = 85831\n}\n",
+			want:     cty.NumberIntVal(85831),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "shorthand int",
+			src:      "variable \"a\" = 5",
+			want:     cty.NumberIntVal(5),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "shorthand float",
+			src:      "variable a = 1.5",
+			want:     cty.NumberFloatVal(1.5),
+			baseType: schematic.TypeFloat,
+		},
+		{
+			name:     "negative",
+			src:      "variable \"a\" = -5",
+			want:     cty.NumberIntVal(-5),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "float suffix",
+			src:      "variable \"a\" = 2f",
+			want:     cty.NumberFloatVal(2),
+			baseType: schematic.TypeFloat,
+		},
+		{
+			name:     "exponent",
+			src:      "variable \"a\" = -1.5e2",
+			want:     cty.NumberFloatVal(-150),
+			baseType: schematic.TypeFloat,
+		},
+		{
+			name:     "escapes",
+			src:      "variable \"a\" = \"tab\\there\"",
+			want:     cty.StringVal("tab\there"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:     "heredoc",
+			src:      "variable \"a\" {\n  value = <<-EOT\n    one\n      two\n    EOT\n}\n",
+			want:     cty.StringVal("one\n  two\n"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:     "bool",
+			src:      "variable \"a\" = true",
+			want:     cty.True,
+			baseType: schematic.TypeBool,
+		},
+		{
+			name:     "quoted string",
+			src:      "variable \"a\" = \"5\"",
+			want:     cty.StringVal("5"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:     "untyped list",
+			src:      `variable "a" = ["a", 1]`,
+			want:     cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.NumberIntVal(1)}),
+			baseType: schematic.TypeList,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			variable := schem.Variables["a"]
+			if !variable.Value.RawEquals(test.want) || variable.BaseType != test.baseType {
+				t.Errorf("got %#v of %v, want %#v of %v", variable.Value, variable.BaseType, test.want, test.baseType)
+			}
+		})
+	}
+}
+
+func TestTypedVariables(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		want        cty.Value
+		baseType    schematic.ValueType
+		description string
+		sensitive   bool
+	}{
+		{
+			name:     "default",
+			src:      "variable \"a\" {\n  default = 20\n}\n",
+			want:     cty.NumberIntVal(20),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "value over default",
+			src:      "variable \"a\" {\n  default = 20\n  value = 30\n}\n",
+			want:     cty.NumberIntVal(30),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "converted to the declared type",
+			src:      "variable \"a\" {\n  type = int\n  default = \"20\"\n}\n",
+			want:     cty.NumberIntVal(20),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "string type",
+			src:      "variable \"a\" {\n  type = string\n  value = 20\n}\n",
+			want:     cty.StringVal("20"),
+			baseType: schematic.TypeString,
+		},
+		{
+			name:        "description and sensitive",
+			src:         "variable \"a\" {\n  value = \"x\"\n  description = \"A value\"\n  sensitive = true\n}\n",
+			want:        cty.StringVal("x"),
+			baseType:    schematic.TypeString,
+			description: "A value",
+			sensitive:   true,
+		},
+		{
+			name:     "constant expression",
+			src:      "variable \"a\" {\n  type = int\n  default = 2 * 512\n}\n",
+			want:     cty.NumberIntVal(1024),
+			baseType: schematic.TypeInt,
+		},
+		{
+			name:     "list",
+			src:      "variable \"a\" {\n  type = list(string)\n  default = [\"a\", \"b\"]\n}\n",
+			want:     cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+			baseType: schematic.TypeList,
+		},
+		{
+			name:     "map",
+			src:      "variable \"a\" {\n  type = map(int)\n  default = { http = 80, https = \"443\" }\n}\n",
+			want:     cty.MapVal(map[string]cty.Value{"http": cty.NumberIntVal(80), "https": cty.NumberIntVal(443)}),
+			baseType: schematic.TypeMap,
+		},
+		{
+			name:     "list of maps",
+			src:      "variable \"a\" {\n  type = list(map(bool))\n  value = [{ a = true }]\n}\n",
+			want:     cty.ListVal([]cty.Value{cty.MapVal(map[string]cty.Value{"a": cty.True})}),
+			baseType: schematic.TypeList,
+		},
+		{
+			name:     "passing validation",
+			src:      "variable \"a\" {\n  value = 20\n  validation {\n    condition = var.a > 0 && var.a <= 100\n    error_message = \"a must be between 1 and 100\"\n  }\n}\n",
+			want:     cty.NumberIntVal(20),
+			baseType: schematic.TypeInt,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schem, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			variable := schem.Variables["a"]
+			if !variable.Value.RawEquals(test.want) || variable.BaseType != test.baseType {
+				t.Errorf("got %#v of %v, want %#v of %v", variable.Value, variable.BaseType, test.want, test.baseType)
+			}
+			if variable.Description != test.description || variable.Sensitive != test.sensitive {
+				t.Errorf("got description %q and sensitive %v", variable.Description, variable.Sensitive)
+			}
+		})
+	}
+}
+
+func TestVariableReferences(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"int", "5", "5"},
+		{"float", "1.5", "1.5"},
+		{"bool", "false", "false"},
+		{"string", "\"name\"", "name"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "variable \"a\" = " + test.value + "\ninstance \"test::container\" \"x\" {\n  containerId = var.a\n}\n"
+			schem, err := NewParser(strings.NewReader(src)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := schem.Instances["x"].GetFromNesting([]string{"containerId"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVariableErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		summary string
+		detail  string
+	}{
+		{
+			name:    "missing digits",
+			src:     "variable \"a\" = 1.",
+			summary: "Invalid number literal",
+			detail:  "missing digits after decimal point: 1.",
+		},
+		{
+			name:    "negative number out of range",
+			src:     "variable \"a\" = -1e400",
+			summary: "Invalid number literal",
+			detail:  "number is out of range: -1e400",
+		},
+		{
+			name:    "double float suffix",
+			src:     "variable \"a\" = 1ff",
+			summary: "Invalid number literal",
+			detail:  "unexpected character in number: 1ff",
+		},
+		{
+			name:    "invalid escape",
+			src:     "variable \"a\" = \"a\\qb\"",
+			summary: "Invalid escape sequence",
+			detail:  "invalid escape sequence in string: \\q",
+		},
+		{
+			name:    "unterminated string",
+			src:     "variable \"a\" = \"abc",
+			summary: "Unterminated string",
+			detail:  "missing closing quotation mark \" in string: abc",
+		},
+		{
+			name:    "unterminated heredoc",
+			src:     "variable \"a\" = <<EOT\nx\n",
+			summary: "Unterminated heredoc",
+			detail:  "missing closing marker EOT for heredoc",
+		},
+		{
+			name:    "unknown field",
+			src:     "variable \"a\" {\n  size = 1\n}\n",
+			summary: "Unsupported field",
+			detail:  "variable [a] has no field: size",
+		},
+		{
+			name:    "unknown type",
+			src:     "variable \"a\" {\n  type = number\n}\n",
+			summary: "Invalid type",
+			detail:  "invalid type for variable [a], must be string, int, float, bool, list(<TYPE>) or map(<TYPE>): number",
+		},
+		{
+			name:    "invalid element type",
+			src:     "variable \"a\" {\n  type = list(thing)\n  value = []\n}\n",
+			summary: "Invalid type",
+			detail:  ": list(thing)",
+		},
+		{
+			name:    "element of the wrong type",
+			src:     "variable \"a\" {\n  type = list(int)\n  value = [1, \"b\"]\n}\n",
+			summary: "Invalid variable value",
+			detail:  "variable [a] value is not a valid list(int)",
+		},
+		{
+			name:    "value of the wrong type",
+			src:     "variable \"a\" {\n  type = int\n  value = \"many\"\n}\n",
+			summary: "Invalid variable value",
+			detail:  "variable [a] value is not a valid int: a number is required",
+		},
+		{
+			name:    "fractional int",
+			src:     "variable \"a\" {\n  type = int\n  default = 1.5\n}\n",
+			summary: "Invalid variable default",
+			detail:  "variable [a] default is not a valid int",
+		},
+		{
+			name:    "sensitive not a boolean",
+			src:     "variable \"a\" {\n  sensitive = 1\n}\n",
+			summary: "Invalid value",
+			detail:  "variable [a] sensitive must be a boolean",
+		},
+		{
+			name:    "failed validation",
+			src:     "variable \"a\" {\n  value = 200\n  validation {\n    condition = var.a > 0 && var.a <= 100\n    error_message = \"a must be between 1 and 100\"\n  }\n}\n",
+			summary: "Invalid value for variable",
+			detail:  "invalid value for variable [a]: a must be between 1 and 100",
+		},
+		{
+			name:    "validation without a message",
+			src:     "variable \"a\" {\n  value = 1\n  validation {\n    condition = var.a > 0\n  }\n}\n",
+			summary: "Incomplete validation",
+			detail:  "validation of variable [a] must declare both condition and error_message",
+		},
+		{
+			name:    "validation not a boolean",
+			src:     "variable \"a\" {\n  value = 1\n  validation {\n    condition = var.a\n    error_message = \"a\"\n  }\n}\n",
+			summary: "Invalid validation condition",
+			detail:  "validation condition for variable [a] must be a boolean",
+		},
+		{
+			name:    "no value",
+			src:     "variable \"a\" {\n  type = string\n}\n",
+			summary: "Missing variable value",
+			detail:  "no value for required variable [a], set one with -var, -var-file or SCHEMATIC_VAR_a",
+		},
+		{
+			name:    "missing assignment",
+			src:     "variable \"a\" 1",
+			summary: "Missing open brace",
+			detail:  "missing open brace or assignment operator '=' in variable declaration: 1",
+		},
+		{
+			name:    "bare string",
+			src:     "variable \"a\" = name",
+			summary: "Unknown reference",
+			detail:  "quoted string: name",
+		},
+		{
+			name:    "reference in value",
+			src:     "variable \"b\" = 1\nvariable \"a\" {\n  value = var.b\n}\n",
+			summary: "Reference to undeclared variable",
+			detail:  "no such variable: b",
+		},
+		{
+			name:    "undeclared reference",
+			src:     "instance \"test::container\" \"x\" {\n  containerId = var.b\n}\n",
+			summary: "Reference to undeclared variable",
+			detail:  "no such variable: b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewParser(strings.NewReader(test.src)).Parse()
+			if err == nil {
+				t.Fatal("expected an error")
+			} else if !hasDiagnostic(err, test.summary, test.detail) {
+				t.Errorf("got %v, want %s containing %q", err, test.summary, test.detail)
+			}
+		})
+	}
+}
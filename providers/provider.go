@@ -1,8 +1,10 @@
 package providers
 
 import (
+	"fmt"
 	"github.com/EngineersBox/Schematic/schema"
 	"github.com/EngineersBox/Schematic/state"
+	"sort"
 )
 
 type Provider struct {
@@ -12,3 +14,26 @@ type Provider struct {
 }
 
 type ConfigureFunc func(*state.InstanceData) (interface{}, error)
+
+// InternalValidate checks the schema of each instance kind of the provider
+// for mistakes made by its author.
+func (p *Provider) InternalValidate() error {
+	if len(p.InstancesMap) == 0 && len(p.DataSourcesMap) == 0 {
+		return fmt.Errorf("provider must have at least one instance kind or data source")
+	}
+	kinds := make([]string, 0, len(p.InstancesMap))
+	for kind := range p.InstancesMap {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		instance := p.InstancesMap[kind]
+		if instance == nil {
+			return fmt.Errorf("instance [%s] has no schema", kind)
+		}
+		if err := instance.InternalValidate(); err != nil {
+			return fmt.Errorf("instance [%s]: %s", kind, err.Error())
+		}
+	}
+	return nil
+}
@@ -1,3 +1,76 @@
 package providers
 
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/schema"
+	"github.com/EngineersBox/Schematic/state"
+)
+
 var InstalledProviders = make(map[string]*Provider)
+
+// Register checks the schema of a provider with InternalValidate and installs
+// it under the given name, so that its instances can be declared as
+// <NAME>::<KIND>.
+func Register(name string, provider *Provider) error {
+	if _, ok := InstalledProviders[name]; ok {
+		return fmt.Errorf("provider [%s] is already registered", name)
+	}
+	if err := provider.InternalValidate(); err != nil {
+		return fmt.Errorf("invalid provider [%s], %s", name, err.Error())
+	}
+	InstalledProviders[name] = provider
+	return nil
+}
+
+// UpgradeState converts the attributes of each instance in a state file
+// written before state.StateVersion to the types of their schema. Instances
+// of a provider that is not installed are left as they are. It is the
+// state.Upgrader given to state.ReadJSONSchmState for every state file read.
+func UpgradeState(schmState *state.JSONSchmState) error {
+	if schmState.Version >= state.StateVersion {
+		return nil
+	}
+	for _, module := range schmState.Modules {
+		for name, instance := range module.Instances {
+			instanceSchema, ok := lookupInstance(instance)
+			if !ok {
+				continue
+			}
+			if err := instanceSchema.UpgradeState(instance); err != nil {
+				return fmt.Errorf("could not upgrade state of instance [%s]: %s", name, err.Error())
+			}
+		}
+	}
+	schmState.Version = state.StateVersion
+	return nil
+}
+
+// DecodeState sets the value of each instance of an installed provider in a
+// state file read by state.ReadJSONSchmState from its attributes.
+func DecodeState(schmState *state.JSONSchmState) error {
+	for _, module := range schmState.Modules {
+		for name, instance := range module.Instances {
+			instanceSchema, ok := lookupInstance(instance)
+			if !ok {
+				continue
+			}
+			value, err := instanceSchema.ObjectValue(instance.Attributes)
+			if err != nil {
+				return fmt.Errorf("could not decode state of instance [%s]: %s", name, err.Error())
+			}
+			instance.Value = value
+		}
+	}
+	return nil
+}
+
+// lookupInstance returns the schema of the kind of an instance, if its
+// provider is installed.
+func lookupInstance(instance *state.InstanceState) (*schema.Instance, bool) {
+	provider, ok := InstalledProviders[instance.Provider]
+	if !ok {
+		return nil, false
+	}
+	instanceSchema, ok := provider.InstancesMap[instance.Type]
+	return instanceSchema, ok
+}
@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/schema"
+	"github.com/EngineersBox/Schematic/state"
+	"github.com/zclconf/go-cty/cty"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testProvider returns a provider with a single instance kind, container
+func testProvider() *Provider {
+	return &Provider{InstancesMap: map[string]*schema.Instance{
+		"container": {Schema: map[string]*schema.Schema{
+			"containerId": {Type: schematic.TypeString, Required: true},
+			"inbuilt":     {Type: schematic.TypeBool, Optional: true},
+			"ports":       {Type: schematic.TypeList, Optional: true, Elem: &schema.Schema{Type: schematic.TypeInt}},
+		}},
+	}}
+}
+
+// withProvider installs the provider as test for the duration of a test
+func withProvider(t *testing.T, provider *Provider) {
+	t.Helper()
+	if err := Register("test", provider); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(InstalledProviders, "test") })
+}
+
+// testState returns a state file of the given version with one instance
+func testState(version int, provider string, attributes map[string]interface{}) *state.JSONSchmState {
+	return &state.JSONSchmState{
+		Version: version,
+		Modules: []state.JSONModuleState{{
+			Path: ".",
+			Instances: map[string]*state.InstanceState{
+				"a": {ID: "a", Type: "container", Provider: provider, Attributes: attributes},
+			},
+		}},
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *Provider
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			provider: testProvider(),
+		},
+		{
+			name:     "empty",
+			provider: &Provider{},
+			wantErr:  "invalid provider [test], provider must have at least one instance kind or data source",
+		},
+		{
+			name:     "nil instance",
+			provider: &Provider{InstancesMap: map[string]*schema.Instance{"container": nil}},
+			wantErr:  "invalid provider [test], instance [container] has no schema",
+		},
+		{
+			name: "invalid schema",
+			provider: &Provider{InstancesMap: map[string]*schema.Instance{
+				"container": {Schema: map[string]*schema.Schema{"a": {Type: schematic.TypeString}}},
+			}},
+			wantErr: "invalid provider [test], instance [container]: field [a] must be one of Required, Optional or Computed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer delete(InstalledProviders, "test")
+			err := Register("test", test.provider)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				if _, ok := InstalledProviders["test"]; ok {
+					t.Error("invalid provider was installed")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if InstalledProviders["test"] != test.provider {
+				t.Error("provider was not installed")
+			}
+		})
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	withProvider(t, testProvider())
+	want := "provider [test] is already registered"
+	if err := Register("test", testProvider()); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
+
+func TestUpgradeState(t *testing.T) {
+	withProvider(t, testProvider())
+	tests := []struct {
+		name      string
+		schmState *state.JSONSchmState
+		want      map[string]interface{}
+		wantErr   string
+	}{
+		{
+			name:      "version 1",
+			schmState: testState(1, "test", map[string]interface{}{"containerId": "007", "inbuilt": "true", "ports": []interface{}{"80"}}),
+			want:      map[string]interface{}{"containerId": "007", "inbuilt": true, "ports": []interface{}{80}},
+		},
+		{
+			name:      "current version",
+			schmState: testState(state.StateVersion, "test", map[string]interface{}{"inbuilt": "true"}),
+			want:      map[string]interface{}{"inbuilt": "true"},
+		},
+		{
+			name:      "provider not installed",
+			schmState: testState(1, "other", map[string]interface{}{"inbuilt": "true"}),
+			want:      map[string]interface{}{"inbuilt": "true"},
+		},
+		{
+			name:      "invalid value",
+			schmState: testState(1, "test", map[string]interface{}{"inbuilt": "maybe"}),
+			wantErr:   "could not upgrade state of instance [a]: field [inbuilt] is not a valid value for its type: maybe",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := UpgradeState(test.schmState)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if test.schmState.Version != state.StateVersion {
+				t.Errorf("got version %d, want %d", test.schmState.Version, state.StateVersion)
+			}
+			if got := test.schmState.Modules[0].Instances["a"].Attributes; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeState(t *testing.T) {
+	withProvider(t, testProvider())
+	schmState := testState(state.StateVersion, "test", map[string]interface{}{"containerId": "a", "ports": []interface{}{80.0}})
+	if err := DecodeState(schmState); err != nil {
+		t.Fatal(err)
+	}
+	want := cty.ObjectVal(map[string]cty.Value{
+		"containerId": cty.StringVal("a"),
+		"inbuilt":     cty.NullVal(cty.Bool),
+		"ports":       cty.ListVal([]cty.Value{cty.NumberIntVal(80)}),
+	})
+	if got := schmState.Modules[0].Instances["a"].Value; !got.RawEquals(want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	schmState = testState(state.StateVersion, "test", map[string]interface{}{"inbuilt": "maybe"})
+	if err := DecodeState(schmState); err == nil {
+		t.Error("expected an error decoding an invalid value")
+	}
+}
+
+func TestReadJSONSchmStateUpgrades(t *testing.T) {
+	withProvider(t, testProvider())
+	filename := filepath.Join(t.TempDir(), "state.json")
+	src := `{"version": 1, "modules": [{"path": ".", "instances": {"a": {"id": "a", "kind": "container", "provider": "test", "attributes": {"inbuilt": "true"}}}}]}`
+	if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	schmState, err := state.ReadJSONSchmState(filename, UpgradeState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schmState.Version != state.StateVersion {
+		t.Errorf("got version %d, want %d", schmState.Version, state.StateVersion)
+	}
+	if got := schmState.Modules[0].Instances["a"].Attributes["inbuilt"]; got != true {
+		t.Errorf("got %#v, want true", got)
+	}
+}
@@ -0,0 +1,201 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"strconv"
+	"strings"
+)
+
+// ImpliedType returns the type of the attributes of an instance, an object
+// with an attribute for each field of the schema.
+func ImpliedType(schemaMap map[string]*Schema) cty.Type {
+	attributes := make(map[string]cty.Type, len(schemaMap))
+	for key, fieldSchema := range schemaMap {
+		attributes[key] = fieldSchema.ImpliedType()
+	}
+	return cty.Object(attributes)
+}
+
+// ImpliedType returns the type of the attributes of the instance
+func (r *Instance) ImpliedType() cty.Type {
+	return ImpliedType(r.Schema)
+}
+
+// ImpliedType returns the type of a value of the field. A TypeMap with a
+// schema for each of its fields is an object, otherwise collections are of
+// the type of their Elem. Collections without an Elem may hold any value.
+func (s *Schema) ImpliedType() cty.Type {
+	switch s.Type {
+	case schematic.TypeBool:
+		return cty.Bool
+	case schematic.TypeInt, schematic.TypeFloat:
+		return cty.Number
+	case schematic.TypeString:
+		return cty.String
+	case schematic.TypeMap:
+		if fields, ok := s.Elem.(map[string]*Schema); ok {
+			return ImpliedType(fields)
+		} else if s.Elem != nil {
+			return cty.Map(elemType(s.Elem))
+		}
+	case schematic.TypeList:
+		if s.Elem != nil {
+			return cty.List(elemType(s.Elem))
+		}
+	case schematic.TypeSet:
+		if s.Elem != nil {
+			return cty.Set(elemType(s.Elem))
+		}
+	}
+	return cty.DynamicPseudoType
+}
+
+func elemType(elem interface{}) cty.Type {
+	switch e := elem.(type) {
+	case *Schema:
+		return e.ImpliedType()
+	case *Instance:
+		return e.ImpliedType()
+	case map[string]*Schema:
+		return ImpliedType(e)
+	}
+	return cty.DynamicPseudoType
+}
+
+// ObjectValue converts the attributes of an instance, as stored in state, to
+// a value of the type implied by its schema. Fields that are not set are
+// null. Values of a basic type stored as strings are converted to the type
+// of their field.
+func (r *Instance) ObjectValue(attributes map[string]interface{}) (cty.Value, error) {
+	return blockValue(nil, attributes, r.Schema)
+}
+
+// PlannedValue returns the value an instance with the given configuration is
+// expected to have once applied. Computed fields that are not set in the
+// configuration are unknown, as they are only known once the provider has
+// created the instance.
+func (r *Instance) PlannedValue(config cty.Value) cty.Value {
+	return plannedBlock(config, r.Schema)
+}
+
+func plannedBlock(config cty.Value, schemaMap map[string]*Schema) cty.Value {
+	if config.IsNull() || !config.IsKnown() {
+		return config
+	}
+	attributes := make(map[string]cty.Value, len(schemaMap))
+	for key, fieldSchema := range schemaMap {
+		value := config.GetAttr(key)
+		fields, isBlock := fieldSchema.Elem.(map[string]*Schema)
+		if value.IsNull() && fieldSchema.Computed {
+			value = cty.UnknownVal(fieldSchema.ImpliedType())
+		} else if fieldSchema.Type == schematic.TypeMap && isBlock {
+			value = plannedBlock(value, fields)
+		}
+		attributes[key] = value
+	}
+	return cty.ObjectVal(attributes)
+}
+
+func blockValue(nesting []string, value interface{}, schemaMap map[string]*Schema) (cty.Value, error) {
+	block, ok := value.(map[string]interface{})
+	if !ok && value != nil {
+		return cty.NilVal, fmt.Errorf("field [%s] must be a block", strings.Join(nesting, "->"))
+	}
+	for key := range block {
+		if _, ok := schemaMap[key]; !ok {
+			return cty.NilVal, fmt.Errorf("no schema field for: %s", strings.Join(append(append([]string{}, nesting...), key), "->"))
+		}
+	}
+	attributes := make(map[string]cty.Value, len(schemaMap))
+	for key, fieldSchema := range schemaMap {
+		elem, ok := block[key]
+		if !ok || elem == nil {
+			attributes[key] = cty.NullVal(fieldSchema.ImpliedType())
+			continue
+		}
+		converted, err := fieldValue(append(append([]string{}, nesting...), key), elem, fieldSchema)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		attributes[key] = converted
+	}
+	return cty.ObjectVal(attributes), nil
+}
+
+func fieldValue(nesting []string, value interface{}, elemSchema interface{}) (cty.Value, error) {
+	var s *Schema
+	switch e := elemSchema.(type) {
+	case *Instance:
+		return blockValue(nesting, value, e.Schema)
+	case map[string]*Schema:
+		return blockValue(nesting, value, e)
+	case *Schema:
+		s = e
+	default:
+		return dynamicValue(value), nil
+	}
+	if fields, ok := s.Elem.(map[string]*Schema); ok && s.Type == schematic.TypeMap {
+		return blockValue(nesting, value, fields)
+	}
+	converted := dynamicValue(value)
+	if s.Elem != nil {
+		switch v := value.(type) {
+		case []interface{}:
+			elems := make([]cty.Value, len(v))
+			for i, elem := range v {
+				elemValue, err := fieldValue(append(append([]string{}, nesting...), strconv.Itoa(i)), elem, s.Elem)
+				if err != nil {
+					return cty.NilVal, err
+				}
+				elems[i] = elemValue
+			}
+			converted = cty.TupleVal(elems)
+		case map[string]interface{}:
+			elems := make(map[string]cty.Value, len(v))
+			for key, elem := range v {
+				elemValue, err := fieldValue(append(append([]string{}, nesting...), key), elem, s.Elem)
+				if err != nil {
+					return cty.NilVal, err
+				}
+				elems[key] = elemValue
+			}
+			converted = cty.ObjectVal(elems)
+		}
+	}
+	converted, err := convert.Convert(converted, s.ImpliedType())
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("field [%s] is not a valid %s: %s", strings.Join(nesting, "->"), s.ImpliedType().FriendlyName(), err.Error())
+	}
+	return converted, nil
+}
+
+// dynamicValue converts a value stored in state to a cty.Value of the type
+// of the value itself, blocks become objects and arrays become tuples.
+func dynamicValue(value interface{}) cty.Value {
+	switch v := value.(type) {
+	case string:
+		return cty.StringVal(v)
+	case int:
+		return cty.NumberIntVal(int64(v))
+	case float64:
+		return cty.NumberFloatVal(v)
+	case bool:
+		return cty.BoolVal(v)
+	case map[string]interface{}:
+		attributes := make(map[string]cty.Value, len(v))
+		for key, elem := range v {
+			attributes[key] = dynamicValue(elem)
+		}
+		return cty.ObjectVal(attributes)
+	case []interface{}:
+		elems := make([]cty.Value, len(v))
+		for i, elem := range v {
+			elems[i] = dynamicValue(elem)
+		}
+		return cty.TupleVal(elems)
+	}
+	return cty.NullVal(cty.DynamicPseudoType)
+}
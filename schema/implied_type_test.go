@@ -0,0 +1,139 @@
+package schema
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+// testInstance returns the schema of an instance with fields of each type
+var configType = cty.Object(map[string]cty.Type{"pidsMax": cty.Number, "uuid": cty.String})
+
+func TestImpliedType(t *testing.T) {
+	want := cty.Object(map[string]cty.Type{
+		"containerId": cty.String,
+		"inbuilt":     cty.Bool,
+		"ratio":       cty.Number,
+		"id":          cty.String,
+		"tags":        cty.Set(cty.String),
+		"ports":       cty.List(cty.Number),
+		"labels":      cty.Map(cty.Number),
+		"config":      configType,
+	})
+	if got := testInstance().ImpliedType(); !got.Equals(want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestObjectValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]interface{}
+		field      string
+		want       cty.Value
+		wantErr    string
+	}{
+		{
+			name:       "string",
+			attributes: map[string]interface{}{"containerId": "a"},
+			field:      "containerId",
+			want:       cty.StringVal("a"),
+		},
+		{
+			name:       "not set",
+			attributes: map[string]interface{}{},
+			field:      "ports",
+			want:       cty.NullVal(cty.List(cty.Number)),
+		},
+		{
+			name:       "number stored as a string",
+			attributes: map[string]interface{}{"ratio": "1.5"},
+			field:      "ratio",
+			want:       cty.NumberFloatVal(1.5),
+		},
+		{
+			name:       "list",
+			attributes: map[string]interface{}{"ports": []interface{}{80.0, "443"}},
+			field:      "ports",
+			want:       cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+		},
+		{
+			name:       "set",
+			attributes: map[string]interface{}{"tags": []interface{}{"a", "a", "b"}},
+			field:      "tags",
+			want:       cty.SetVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		},
+		{
+			name:       "map",
+			attributes: map[string]interface{}{"labels": map[string]interface{}{"a": 1}},
+			field:      "labels",
+			want:       cty.MapVal(map[string]cty.Value{"a": cty.NumberIntVal(1)}),
+		},
+		{
+			name:       "nested block",
+			attributes: map[string]interface{}{"config": map[string]interface{}{"pidsMax": 20}},
+			field:      "config",
+			want:       cty.ObjectVal(map[string]cty.Value{"pidsMax": cty.NumberIntVal(20), "uuid": cty.NullVal(cty.String)}),
+		},
+		{
+			name:       "unknown field",
+			attributes: map[string]interface{}{"config": map[string]interface{}{"memMax": 1}},
+			wantErr:    "no schema field for: config->memMax",
+		},
+		{
+			name:       "invalid value",
+			attributes: map[string]interface{}{"inbuilt": "maybe"},
+			wantErr:    "field [inbuilt] is not a valid bool: a bool is required",
+		},
+		{
+			name:       "block of the wrong type",
+			attributes: map[string]interface{}{"config": "a"},
+			wantErr:    "field [config] must be a block",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := testInstance().ObjectValue(test.attributes)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := value.GetAttr(test.field); !got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlannedValue(t *testing.T) {
+	instance := testInstance()
+	config, err := instance.ObjectValue(map[string]interface{}{
+		"containerId": "a",
+		"config":      map[string]interface{}{"pidsMax": 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	planned := instance.PlannedValue(config)
+	tests := []struct {
+		name string
+		got  cty.Value
+		want cty.Value
+	}{
+		{"set field", planned.GetAttr("containerId"), cty.StringVal("a")},
+		{"optional field", planned.GetAttr("inbuilt"), cty.NullVal(cty.Bool)},
+		{"computed field", planned.GetAttr("id"), cty.UnknownVal(cty.String)},
+		{"nested computed field", planned.GetAttr("config").GetAttr("uuid"), cty.UnknownVal(cty.String)},
+		{"nested field", planned.GetAttr("config").GetAttr("pidsMax"), cty.NumberIntVal(20)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.got.RawEquals(test.want) {
+				t.Errorf("got %#v, want %#v", test.got, test.want)
+			}
+		})
+	}
+}
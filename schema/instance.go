@@ -2,7 +2,11 @@ package schema
 
 import (
 	"context"
+	"fmt"
+	"github.com/EngineersBox/Schematic/collection"
 	"github.com/EngineersBox/Schematic/state"
+	"strconv"
+	"strings"
 )
 
 var ReservedDataSourceFields = []string{
@@ -114,3 +118,95 @@ func (r *Instance) Data(s *InstanceState) *state.InstanceData {
 func Noop(*state.InstanceData, interface{}) error {
 	return nil
 }
+
+// UpgradeState converts the attributes of an instance read from a state file
+// before state.StateVersion 2, where each value of a basic type was stored as
+// a string, to the type of their field. Values that are already typed and
+// fields without a schema are left as they are.
+func (r *Instance) UpgradeState(s *state.InstanceState) error {
+	attributes, err := upgradeBlock(nil, s.Attributes, r.Schema)
+	if err != nil {
+		return err
+	}
+	s.Attributes = attributes
+	return nil
+}
+
+func upgradeBlock(nesting []string, block map[string]interface{}, blockSchema map[string]*Schema) (map[string]interface{}, error) {
+	for key, value := range block {
+		fieldSchema, ok := blockSchema[key]
+		if !ok {
+			continue
+		}
+		upgraded, err := upgradeValue(append(append([]string{}, nesting...), key), value, fieldSchema)
+		if err != nil {
+			return nil, err
+		}
+		block[key] = upgraded
+	}
+	return block, nil
+}
+
+func upgradeValue(nesting []string, value interface{}, elemSchema interface{}) (interface{}, error) {
+	switch s := elemSchema.(type) {
+	case *Instance:
+		if block, ok := value.(map[string]interface{}); ok {
+			return upgradeBlock(nesting, block, s.Schema)
+		}
+		return value, nil
+	case map[string]*Schema:
+		if block, ok := value.(map[string]interface{}); ok {
+			return upgradeBlock(nesting, block, s)
+		}
+		return value, nil
+	case *Schema:
+		return upgradeField(nesting, value, s)
+	}
+	return value, nil
+}
+
+func upgradeField(nesting []string, value interface{}, fieldSchema *Schema) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, elem := range v {
+			upgraded, err := upgradeValue(append(append([]string{}, nesting...), strconv.Itoa(i)), elem, fieldSchema.Elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = upgraded
+		}
+		return v, nil
+	case map[string]interface{}:
+		if _, ok := fieldSchema.Elem.(*Schema); !ok {
+			return upgradeValue(nesting, v, fieldSchema.Elem)
+		}
+		for key, elem := range v {
+			upgraded, err := upgradeValue(append(append([]string{}, nesting...), key), elem, fieldSchema.Elem)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = upgraded
+		}
+		return v, nil
+	case string:
+		var upgraded interface{}
+		var err error
+		switch fieldSchema.Type {
+		case schematic.TypeInt:
+			var i int64
+			i, err = strconv.ParseInt(v, 10, 64)
+			upgraded = int(i)
+		case schematic.TypeFloat:
+			upgraded, err = strconv.ParseFloat(v, 64)
+		case schematic.TypeBool:
+			upgraded, err = strconv.ParseBool(v)
+		default:
+			return v, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field [%s] is not a valid value for its type: %s", strings.Join(nesting, "->"), v)
+		}
+		return upgraded, nil
+	}
+	return value, nil
+}
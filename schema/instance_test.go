@@ -0,0 +1,92 @@
+package schema
+
+import (
+	"github.com/EngineersBox/Schematic/collection"
+	"github.com/EngineersBox/Schematic/state"
+	"reflect"
+	"testing"
+)
+
+// testInstance returns an instance schema with a field of each type
+func testInstance() *Instance {
+	return &Instance{Schema: map[string]*Schema{
+		"containerId": {Type: schematic.TypeString, Required: true},
+		"inbuilt":     {Type: schematic.TypeBool, Optional: true},
+		"ratio":       {Type: schematic.TypeFloat, Optional: true},
+		"id":          {Type: schematic.TypeString, Computed: true},
+		"tags":        {Type: schematic.TypeSet, Optional: true, Elem: &Schema{Type: schematic.TypeString}},
+		"ports":       {Type: schematic.TypeList, Optional: true, Elem: &Schema{Type: schematic.TypeInt}},
+		"labels":      {Type: schematic.TypeMap, Optional: true, Elem: &Schema{Type: schematic.TypeInt}},
+		"config": {Type: schematic.TypeMap, Optional: true, Elem: map[string]*Schema{
+			"pidsMax": {Type: schematic.TypeInt, Optional: true},
+			"uuid":    {Type: schematic.TypeString, Computed: true},
+		}},
+	}}
+}
+
+func TestUpgradeState(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]interface{}
+		want       map[string]interface{}
+		wantErr    string
+	}{
+		{
+			name:       "basic types",
+			attributes: map[string]interface{}{"containerId": "007", "inbuilt": "true", "ratio": "1.5"},
+			want:       map[string]interface{}{"containerId": "007", "inbuilt": true, "ratio": 1.5},
+		},
+		{
+			name:       "already upgraded",
+			attributes: map[string]interface{}{"inbuilt": false, "ratio": 2.0},
+			want:       map[string]interface{}{"inbuilt": false, "ratio": 2.0},
+		},
+		{
+			name:       "list",
+			attributes: map[string]interface{}{"ports": []interface{}{"80", "443"}},
+			want:       map[string]interface{}{"ports": []interface{}{80, 443}},
+		},
+		{
+			name:       "map",
+			attributes: map[string]interface{}{"labels": map[string]interface{}{"a": "1"}},
+			want:       map[string]interface{}{"labels": map[string]interface{}{"a": 1}},
+		},
+		{
+			name:       "nested block",
+			attributes: map[string]interface{}{"config": map[string]interface{}{"pidsMax": "20", "uuid": "20"}},
+			want:       map[string]interface{}{"config": map[string]interface{}{"pidsMax": 20, "uuid": "20"}},
+		},
+		{
+			name:       "field without a schema",
+			attributes: map[string]interface{}{"removed": "1"},
+			want:       map[string]interface{}{"removed": "1"},
+		},
+		{
+			name:       "invalid value",
+			attributes: map[string]interface{}{"config": map[string]interface{}{"pidsMax": "many"}},
+			wantErr:    "field [config->pidsMax] is not a valid value for its type: many",
+		},
+		{
+			name:       "invalid list element",
+			attributes: map[string]interface{}{"ports": []interface{}{"80", "x"}},
+			wantErr:    "field [ports->1] is not a valid value for its type: x",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instanceState := &state.InstanceState{Attributes: test.attributes}
+			err := testInstance().UpgradeState(instanceState)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(instanceState.Attributes, test.want) {
+				t.Errorf("got %#v, want %#v", instanceState.Attributes, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/EngineersBox/Schematic/collection"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InternalValidate checks the schema of an instance for mistakes made by the
+// author of its provider, so that they are found when the provider is
+// registered rather than when an instance is decoded.
+func (r *Instance) InternalValidate() error {
+	for _, reserved := range ReservedResourceFields {
+		if _, ok := r.Schema[reserved]; ok {
+			return fmt.Errorf("field [%s] is a reserved field name", reserved)
+		}
+	}
+	return InternalValidate(r.Schema)
+}
+
+// InternalValidate checks the schema of each field, including the fields of
+// nested blocks. The keys of ConflictsWith, ExactlyOneOf, AtLeastOneOf and
+// RequiredWith must be fields of the given schema.
+func InternalValidate(schemaMap map[string]*Schema) error {
+	if len(schemaMap) == 0 {
+		return fmt.Errorf("schema must have at least one field")
+	}
+	return internalValidate(nil, schemaMap, schemaMap)
+}
+
+func internalValidate(nesting []string, schemaMap map[string]*Schema, root map[string]*Schema) error {
+	keys := make([]string, 0, len(schemaMap))
+	for key := range schemaMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fieldNesting := append(append([]string{}, nesting...), key)
+		fieldSchema := schemaMap[key]
+		if fieldSchema == nil {
+			return fmt.Errorf("field [%s] has no schema", strings.Join(fieldNesting, "->"))
+		}
+		if err := fieldSchema.internalValidate(fieldNesting, root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) internalValidate(nesting []string, root map[string]*Schema) error {
+	field := strings.Join(nesting, "->")
+	if s.Type == schematic.TypeInvalid {
+		return fmt.Errorf("field [%s] must have a Type", field)
+	}
+
+	if s.Required && s.Optional {
+		return fmt.Errorf("field [%s] cannot be both Required and Optional", field)
+	} else if s.Required && s.Computed {
+		return fmt.Errorf("field [%s] cannot be both Required and Computed", field)
+	} else if !s.Required && !s.Optional && !s.Computed {
+		return fmt.Errorf("field [%s] must be one of Required, Optional or Computed", field)
+	}
+	computedOnly := s.Computed && !s.Optional
+
+	hasDefault := s.Default != nil || s.DefaultFunc != nil
+	if s.Default != nil && s.DefaultFunc != nil {
+		return fmt.Errorf("field [%s] cannot set both Default and DefaultFunc", field)
+	} else if hasDefault && s.Required {
+		return fmt.Errorf("field [%s] cannot have a default as it is Required", field)
+	} else if hasDefault && computedOnly {
+		return fmt.Errorf("field [%s] cannot have a default as it is Computed and not Optional", field)
+	}
+	if s.Default != nil {
+		value, err := fieldValue(nesting, s.Default, s)
+		if err != nil {
+			return fmt.Errorf("invalid Default, %s", err.Error())
+		} else if value.IsNull() {
+			return fmt.Errorf("field [%s] has a Default of unsupported type %T", field, s.Default)
+		}
+	}
+
+	if computedOnly {
+		if s.ValidateFunc != nil {
+			return fmt.Errorf("field [%s] cannot have a ValidateFunc as it is Computed and not Optional", field)
+		}
+		if len(s.ConflictsWith) > 0 || len(s.ExactlyOneOf) > 0 || len(s.AtLeastOneOf) > 0 || len(s.RequiredWith) > 0 {
+			return fmt.Errorf("field [%s] cannot reference other fields as it is Computed and not Optional", field)
+		}
+	}
+	if err := checkKeys(field, "ConflictsWith", s.ConflictsWith, root); err != nil {
+		return err
+	}
+	for _, key := range s.ConflictsWith {
+		if key == field {
+			return fmt.Errorf("field [%s] cannot conflict with itself", field)
+		} else if lookupField(root, key).Required {
+			return fmt.Errorf("field [%s] cannot conflict with [%s] as it is Required", field, key)
+		}
+	}
+	if err := checkKeys(field, "ExactlyOneOf", s.ExactlyOneOf, root); err != nil {
+		return err
+	}
+	if err := checkKeys(field, "AtLeastOneOf", s.AtLeastOneOf, root); err != nil {
+		return err
+	}
+	if err := checkKeys(field, "RequiredWith", s.RequiredWith, root); err != nil {
+		return err
+	}
+
+	isList := s.Type == schematic.TypeList || s.Type == schematic.TypeSet
+	if (s.MinItems != 0 || s.MaxItems != 0) && !isList {
+		return fmt.Errorf("field [%s] can only set MinItems and MaxItems on a TypeList or TypeSet", field)
+	} else if s.MinItems < 0 || s.MaxItems < 0 {
+		return fmt.Errorf("field [%s] cannot have a negative MinItems or MaxItems", field)
+	} else if s.MaxItems > 0 && s.MinItems > s.MaxItems {
+		return fmt.Errorf("field [%s] has a MinItems of %d greater than its MaxItems of %d", field, s.MinItems, s.MaxItems)
+	}
+	if s.Set != nil && s.Type != schematic.TypeSet {
+		return fmt.Errorf("field [%s] can only set Set on a TypeSet", field)
+	}
+
+	switch s.Type {
+	case schematic.TypeList, schematic.TypeSet:
+		// Elements are checked as the first element, as keys address the
+		// fields of an element by its index, e.g. list->0->field
+		elemNesting := append(append([]string{}, nesting...), "0")
+		switch elem := s.Elem.(type) {
+		case nil:
+		case *Schema:
+			return elem.internalValidateElem(elemNesting, root)
+		case *Instance:
+			return internalValidate(elemNesting, elem.Schema, root)
+		case map[string]*Schema:
+			return internalValidate(elemNesting, elem, root)
+		default:
+			return fmt.Errorf("field [%s] has an Elem of %T, it must be a *Schema, *Instance or map[string]*Schema", field, s.Elem)
+		}
+	case schematic.TypeMap:
+		switch elem := s.Elem.(type) {
+		case nil:
+		case *Schema:
+			return elem.internalValidateElem(append(append([]string{}, nesting...), "*"), root)
+		case map[string]*Schema:
+			return internalValidate(nesting, elem, root)
+		default:
+			return fmt.Errorf("field [%s] has an Elem of %T, it must be a *Schema or map[string]*Schema", field, s.Elem)
+		}
+	default:
+		if s.Elem != nil {
+			return fmt.Errorf("field [%s] can only set Elem on a TypeList, TypeSet or TypeMap", field)
+		}
+	}
+	return nil
+}
+
+// internalValidateElem checks the schema of the elements of a collection,
+// which describes a value rather than a field, so it cannot be Required,
+// Optional or Computed.
+func (s *Schema) internalValidateElem(nesting []string, root map[string]*Schema) error {
+	field := strings.Join(nesting, "->")
+	if s.Required || s.Optional || s.Computed {
+		return fmt.Errorf("field [%s] is an element, it cannot be Required, Optional or Computed", field)
+	} else if s.Default != nil || s.DefaultFunc != nil {
+		return fmt.Errorf("field [%s] is an element, it cannot have a default", field)
+	}
+	// Checked as an optional field for the remaining constraints
+	elem := *s
+	elem.Optional = true
+	return elem.internalValidate(nesting, root)
+}
+
+// checkKeys checks that each key of a constraint is a field of the schema
+func checkKeys(field string, constraint string, keys []string, root map[string]*Schema) error {
+	for _, key := range keys {
+		if lookupField(root, key) == nil {
+			return fmt.Errorf("field [%s] has %s for a field that does not exist: %s", field, constraint, key)
+		}
+	}
+	return nil
+}
+
+// lookupField returns the schema of the field at a path separated by "->",
+// or nil if there is no such field. The elements of arrays are referenced by
+// their index.
+func lookupField(schemaMap map[string]*Schema, path string) *Schema {
+	var current interface{} = schemaMap
+	for _, name := range strings.Split(path, "->") {
+		switch c := current.(type) {
+		case map[string]*Schema:
+			current = c[name]
+		case *Instance:
+			current = c.Schema[name]
+		case *Schema:
+			if c == nil {
+				return nil
+			} else if c.Type == schematic.TypeList || c.Type == schematic.TypeSet {
+				if _, err := strconv.Atoi(name); err != nil {
+					return nil
+				}
+				current = c.Elem
+			} else if fields, ok := c.Elem.(map[string]*Schema); ok && c.Type == schematic.TypeMap {
+				current = fields[name]
+			} else {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	fieldSchema, _ := current.(*Schema)
+	return fieldSchema
+}
@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"github.com/EngineersBox/Schematic/collection"
+	"testing"
+)
+
+func TestInternalValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema map[string]*Schema
+		want   string
+	}{
+		{
+			name: "valid",
+			schema: map[string]*Schema{
+				"containerId": {Type: schematic.TypeString, Required: true},
+				"id":          {Type: schematic.TypeString, Computed: true},
+				"region":      {Type: schematic.TypeString, Optional: true, Default: "us"},
+				"tags":        {Type: schematic.TypeSet, Optional: true, Elem: &Schema{Type: schematic.TypeString}},
+				"config": {Type: schematic.TypeMap, Optional: true, Elem: map[string]*Schema{
+					"pidsMax": {Type: schematic.TypeInt, Optional: true, ConflictsWith: []string{"config->memMax"}},
+					"memMax":  {Type: schematic.TypeInt, Optional: true},
+				}},
+			},
+		},
+		{
+			name:   "empty",
+			schema: map[string]*Schema{},
+			want:   "schema must have at least one field",
+		},
+		{
+			name:   "nil field",
+			schema: map[string]*Schema{"a": nil},
+			want:   "field [a] has no schema",
+		},
+		{
+			name:   "missing type",
+			schema: map[string]*Schema{"a": {Optional: true}},
+			want:   "field [a] must have a Type",
+		},
+		{
+			name:   "required and optional",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Required: true, Optional: true}},
+			want:   "field [a] cannot be both Required and Optional",
+		},
+		{
+			name:   "required and computed",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Required: true, Computed: true}},
+			want:   "field [a] cannot be both Required and Computed",
+		},
+		{
+			name:   "neither required, optional nor computed",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString}},
+			want:   "field [a] must be one of Required, Optional or Computed",
+		},
+		{
+			name:   "default and default func",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Optional: true, Default: "x", DefaultFunc: EnvDefaultFunc("A", "x")}},
+			want:   "field [a] cannot set both Default and DefaultFunc",
+		},
+		{
+			name:   "required with a default",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Required: true, Default: "x"}},
+			want:   "field [a] cannot have a default as it is Required",
+		},
+		{
+			name:   "computed with a default",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Computed: true, Default: "x"}},
+			want:   "field [a] cannot have a default as it is Computed and not Optional",
+		},
+		{
+			name:   "default of the wrong type",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeInt, Optional: true, Default: "many"}},
+			want:   "invalid Default, field [a] is not a valid number: a number is required",
+		},
+		{
+			name: "computed with a constraint",
+			schema: map[string]*Schema{
+				"a": {Type: schematic.TypeString, Computed: true, ConflictsWith: []string{"b"}},
+				"b": {Type: schematic.TypeString, Optional: true},
+			},
+			want: "field [a] cannot reference other fields as it is Computed and not Optional",
+		},
+		{
+			name:   "conflicts with a missing field",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"b"}}},
+			want:   "field [a] has ConflictsWith for a field that does not exist: b",
+		},
+		{
+			name:   "conflicts with itself",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"a"}}},
+			want:   "field [a] cannot conflict with itself",
+		},
+		{
+			name: "conflicts with a required field",
+			schema: map[string]*Schema{
+				"a": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"b"}},
+				"b": {Type: schematic.TypeString, Required: true},
+			},
+			want: "field [a] cannot conflict with [b] as it is Required",
+		},
+		{
+			name:   "required with a missing field",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Optional: true, RequiredWith: []string{"config->b"}}},
+			want:   "field [a] has RequiredWith for a field that does not exist: config->b",
+		},
+		{
+			name:   "min items on a string",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Optional: true, MinItems: 1}},
+			want:   "field [a] can only set MinItems and MaxItems on a TypeList or TypeSet",
+		},
+		{
+			name:   "min items greater than max items",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeList, Optional: true, MinItems: 3, MaxItems: 2}},
+			want:   "field [a] has a MinItems of 3 greater than its MaxItems of 2",
+		},
+		{
+			name:   "elem on a string",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeString, Optional: true, Elem: &Schema{Type: schematic.TypeString}}},
+			want:   "field [a] can only set Elem on a TypeList, TypeSet or TypeMap",
+		},
+		{
+			name:   "invalid elem",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeList, Optional: true, Elem: "string"}},
+			want:   "field [a] has an Elem of string, it must be a *Schema, *Instance or map[string]*Schema",
+		},
+		{
+			name:   "required elem",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeList, Optional: true, Elem: &Schema{Type: schematic.TypeString, Required: true}}},
+			want:   "field [a->0] is an element, it cannot be Required, Optional or Computed",
+		},
+		{
+			name:   "nested block",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeMap, Optional: true, Elem: map[string]*Schema{"b": {Type: schematic.TypeString}}}},
+			want:   "field [a->b] must be one of Required, Optional or Computed",
+		},
+		{
+			name: "fields of a list element",
+			schema: map[string]*Schema{
+				"mounts": {Type: schematic.TypeList, Optional: true, Elem: &Instance{Schema: map[string]*Schema{
+					"source": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"mounts->0->volume"}},
+					"volume": {Type: schematic.TypeString, Optional: true, RequiredWith: []string{"mounts->0->source"}},
+				}}},
+			},
+		},
+		{
+			name: "list element conflicts with itself",
+			schema: map[string]*Schema{
+				"mounts": {Type: schematic.TypeSet, Optional: true, Elem: map[string]*Schema{
+					"source": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"mounts->0->source"}},
+				}},
+			},
+			want: "field [mounts->0->source] cannot conflict with itself",
+		},
+		{
+			name: "list element without an index",
+			schema: map[string]*Schema{
+				"mounts": {Type: schematic.TypeList, Optional: true, Elem: &Instance{Schema: map[string]*Schema{
+					"source": {Type: schematic.TypeString, Optional: true, ConflictsWith: []string{"mounts->volume"}},
+					"volume": {Type: schematic.TypeString, Optional: true},
+				}}},
+			},
+			want: "field [mounts->0->source] has ConflictsWith for a field that does not exist: mounts->volume",
+		},
+		{
+			name:   "set func on a list",
+			schema: map[string]*Schema{"a": {Type: schematic.TypeList, Optional: true, Set: func(interface{}) int { return 0 }}},
+			want:   "field [a] can only set Set on a TypeSet",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := InternalValidate(test.schema)
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+			} else if err == nil || err.Error() != test.want {
+				t.Errorf("got %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestInstanceInternalValidate(t *testing.T) {
+	instance := &Instance{Schema: map[string]*Schema{
+		"provider": {Type: schematic.TypeString, Optional: true},
+	}}
+	want := "field [provider] is a reserved field name"
+	if err := instance.InternalValidate(); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+}
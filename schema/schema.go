@@ -3,6 +3,7 @@ package schema
 import (
 	collection "github.com/EngineersBox/Schematic/collection"
 	"github.com/EngineersBox/Schematic/state"
+	"os"
 )
 
 type Schema struct {
@@ -13,6 +14,19 @@ type Schema struct {
 
 	DiffFunc SchemaDiffFunc
 
+	// Default is the value of the field when it is not set in the
+	// configuration, one of string, int, float64 or bool for the basic types.
+	// It is converted to the type of the field when an instance is decoded.
+	//
+	// DefaultFunc is called for the value of the field when it is not set and
+	// Default is nil, such as to read the value from an environment variable
+	// with EnvDefaultFunc.
+	//
+	// Neither can be set on a Required field, or a Computed field that is not
+	// also Optional.
+	Default     interface{}
+	DefaultFunc SchemaDefaultFunc
+
 	Description string
 
 	Computed  bool
@@ -41,8 +55,8 @@ type Schema struct {
 	// used to wrap a complex structure, however less than one instance would
 	// cause instability.
 	//
-	// If the field Optional is set to true then MinItems is ignored and thus
-	// effectively zero.
+	// If the field Optional is set to true then MinItems is only checked when
+	// the field is set.
 	MaxItems int
 	MinItems int
 
@@ -65,6 +79,11 @@ type Schema struct {
 	// the keys in that list must be specified.
 	//
 	// RequiredWith is a set of schema keys that must be set simultaneously.
+	//
+	// Keys are the path of a field from the root of the instance, with the
+	// fields of nested blocks separated by "->", such as "config->memMax".
+	// The fields of the elements of a TypeList or TypeSet are addressed by
+	// their index, such as "mounts->0->path".
 	ConflictsWith []string
 	ExactlyOneOf  []string
 	AtLeastOneOf  []string
@@ -83,6 +102,42 @@ type Schema struct {
 
 type SchemaDefaultFunc func() (interface{}, error)
 
+// EnvDefaultFunc returns a SchemaDefaultFunc that reads the value from the
+// environment variable k, or returns dv if it is not set.
+func EnvDefaultFunc(k string, dv interface{}) SchemaDefaultFunc {
+	return func() (interface{}, error) {
+		if v := os.Getenv(k); v != "" {
+			return v, nil
+		}
+		return dv, nil
+	}
+}
+
+// MultiEnvDefaultFunc returns a SchemaDefaultFunc that reads the value from
+// the first of the environment variables ks that is set, or returns dv if
+// none of them are.
+func MultiEnvDefaultFunc(ks []string, dv interface{}) SchemaDefaultFunc {
+	return func() (interface{}, error) {
+		for _, k := range ks {
+			if v := os.Getenv(k); v != "" {
+				return v, nil
+			}
+		}
+		return dv, nil
+	}
+}
+
+// DefaultValue returns the value of the field when it is not set, from
+// Default or DefaultFunc, or nil if it has no default.
+func (s *Schema) DefaultValue() (interface{}, error) {
+	if s.Default != nil {
+		return s.Default, nil
+	} else if s.DefaultFunc != nil {
+		return s.DefaultFunc()
+	}
+	return nil, nil
+}
+
 type SchemaSetFunc func(interface{}) int
 
 type SchemaStateFunc func(interface{}) string
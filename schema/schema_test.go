@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultValue(t *testing.T) {
+	os.Setenv("SCHEMATIC_TEST_SET", "from_env")
+	defer os.Unsetenv("SCHEMATIC_TEST_SET")
+	os.Unsetenv("SCHEMATIC_TEST_UNSET")
+	tests := []struct {
+		name   string
+		schema *Schema
+		want   interface{}
+	}{
+		{"no default", &Schema{}, nil},
+		{"default", &Schema{Default: 10}, 10},
+		{"env default set", &Schema{DefaultFunc: EnvDefaultFunc("SCHEMATIC_TEST_SET", "fallback")}, "from_env"},
+		{"env default unset", &Schema{DefaultFunc: EnvDefaultFunc("SCHEMATIC_TEST_UNSET", "fallback")}, "fallback"},
+		{
+			name:   "first env default set",
+			schema: &Schema{DefaultFunc: MultiEnvDefaultFunc([]string{"SCHEMATIC_TEST_UNSET", "SCHEMATIC_TEST_SET"}, "fallback")},
+			want:   "from_env",
+		},
+		{
+			name:   "no env default set",
+			schema: &Schema{DefaultFunc: MultiEnvDefaultFunc([]string{"SCHEMATIC_TEST_UNSET"}, []interface{}{"a"})},
+			want:   []interface{}{"a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.schema.DefaultValue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
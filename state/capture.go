@@ -2,6 +2,7 @@ package state
 
 type Capture struct {
 	Name          string
+	Source        string
 	HasDependency []string
 	Handler       string
 	Tainted       bool `json:"tainted"`
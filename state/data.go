@@ -1,17 +1,102 @@
 package state
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+const (
+	LocalReferencePrefix = "L::"
+	WebReferencePrefix   = "W::"
+)
+
+var webReferenceTimeout = 30 * time.Second
+
 type Data struct {
 	Type       string
 	Name       string
 	Reference  string
-	Attributes map[string]interface{}
-	Tainted    bool `json:"tainted"`
+	Attributes map[string]interface{} `json:"schema"`
+	Tainted    bool                   `json:"tainted"`
+	// Dir is the directory of the configuration declaring the data, which
+	// relative local sources are read from
+	Dir string `json:"-"`
+
+	// values holds the decoded contents of the referenced source
+	values map[string]interface{}
+}
+
+// ValidateReference checks that the reference is either a local (L::) or
+// web (W::) source
+func (d *Data) ValidateReference() bool {
+	return strings.HasPrefix(d.Reference, LocalReferencePrefix) || strings.HasPrefix(d.Reference, WebReferencePrefix)
+}
+
+// Load reads the referenced source and decodes its JSON contents. Local
+// references are read from the filesystem, relative to Dir, and web
+// references are fetched over HTTP.
+func (d *Data) Load() error {
+	var raw []byte
+	var err error
+	if strings.HasPrefix(d.Reference, LocalReferencePrefix) {
+		path := strings.TrimPrefix(d.Reference, LocalReferencePrefix)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(d.Dir, path)
+		}
+		raw, err = ioutil.ReadFile(path)
+	} else if strings.HasPrefix(d.Reference, WebReferencePrefix) {
+		raw, err = fetchWebReference(strings.TrimPrefix(d.Reference, WebReferencePrefix))
+	} else {
+		return fmt.Errorf("invalid data reference, must be of the form <L | W>::<SOURCE>: %s", d.Reference)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read data [%s] source: %s", d.Name, err.Error())
+	}
+	values := make(map[string]interface{})
+	err = json.Unmarshal(raw, &values)
+	if err != nil {
+		return fmt.Errorf("could not decode data [%s] source: %s", d.Name, err.Error())
+	}
+	d.values = values
+	return nil
+}
+
+func fetchWebReference(url string) ([]byte, error) {
+	client := &http.Client{Timeout: webReferenceTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
 }
 
-func (d *Data) validateReference() bool {
-	return strings.HasPrefix(d.Reference, "L::") || strings.HasPrefix(d.Reference, "W::")
+// GetAttributeNesting retrieves the attribute at the given nesting from the
+// referenced source, loading it if it has not been read yet. The nesting must
+// be declared in the data schema, the declared value is used when the source
+// does not contain the attribute.
+func (d *Data) GetAttributeNesting(attributeNesting []string) (interface{}, error) {
+	declared, err := getInstanceAttributeNesting(attributeNesting, d.Attributes)
+	if err != nil {
+		return nil, fmt.Errorf("data [%s] has no schema field %s: %s", d.Name, strings.Join(attributeNesting, "."), err.Error())
+	}
+	if d.values == nil {
+		err = d.Load()
+		if err != nil {
+			return nil, err
+		}
+	}
+	value, err := getInstanceAttributeNesting(attributeNesting, d.values)
+	if err != nil {
+		return declared, nil
+	}
+	return value, nil
 }
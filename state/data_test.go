@@ -0,0 +1,118 @@
+package state
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDataGetAttributeNesting(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "limits.json"), []byte(`{"pidsMax": 30, "config": {"memMax": 4096}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "invalid.json"), []byte(`{"pidsMax":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	attributes := map[string]interface{}{
+		"pidsMax": 0,
+		"cpus":    2,
+		"config":  map[string]interface{}{"memMax": 0},
+	}
+	tests := []struct {
+		name      string
+		reference string
+		dir       string
+		nesting   []string
+		want      interface{}
+		wantErr   string
+	}{
+		{
+			name:      "relative to the declaring configuration",
+			reference: "L::limits.json",
+			dir:       dir,
+			nesting:   []string{"pidsMax"},
+			want:      30.0,
+		},
+		{
+			name:      "absolute",
+			reference: "L::" + filepath.Join(dir, "limits.json"),
+			dir:       "elsewhere",
+			nesting:   []string{"config", "memMax"},
+			want:      4096.0,
+		},
+		{
+			name:      "declared value when missing from the source",
+			reference: "L::limits.json",
+			dir:       dir,
+			nesting:   []string{"cpus"},
+			want:      2,
+		},
+		{
+			name:      "not in the schema",
+			reference: "L::limits.json",
+			dir:       dir,
+			nesting:   []string{"memMax"},
+			wantErr:   "data [d] has no schema field memMax: no such field: memMax",
+		},
+		{
+			name:      "missing source",
+			reference: "L::missing.json",
+			dir:       dir,
+			nesting:   []string{"pidsMax"},
+			wantErr:   "could not read data [d] source: open " + filepath.Join(dir, "missing.json") + ": no such file or directory",
+		},
+		{
+			name:      "invalid source",
+			reference: "L::invalid.json",
+			dir:       dir,
+			nesting:   []string{"pidsMax"},
+			wantErr:   "could not decode data [d] source: unexpected end of JSON input",
+		},
+		{
+			name:      "invalid reference",
+			reference: "limits.json",
+			dir:       dir,
+			nesting:   []string{"pidsMax"},
+			wantErr:   "invalid data reference, must be of the form <L | W>::<SOURCE>: limits.json",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := &Data{Type: "file", Name: "d", Reference: test.reference, Attributes: attributes, Dir: test.dir}
+			got, err := data.GetAttributeNesting(test.nesting)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDataValidateReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		want      bool
+	}{
+		{"L::limits.json", true},
+		{"W::https://example.com/limits.json", true},
+		{"limits.json", false},
+		{"l::limits.json", false},
+	}
+	for _, test := range tests {
+		t.Run(test.reference, func(t *testing.T) {
+			data := &Data{Reference: test.reference}
+			if got := data.ValidateReference(); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package state
 
 import (
+	"github.com/zclconf/go-cty/cty"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -34,11 +37,83 @@ func (d *InstanceDiff) Lock()   { d.mu.Lock() }
 func (d *InstanceDiff) Unlock() { d.mu.Unlock() }
 
 type InstanceAttrDiff struct {
-	Old         string      // Old Value
-	New         string      // New Value
+	Old         cty.Value   // Old Value
+	New         cty.Value   // New Value
 	NewComputed bool        // True if new value is computed (unknown currently)
 	NewRemoved  bool        // True if this attribute is being removed
 	NewExtra    interface{} // Extra information for the provider
 	RequiresNew bool        // True if change requires new resource
 	Sensitive   bool        // True if the data should not be displayed in UI output
 }
+
+// NewInstanceDiff compares the old and new value of an instance, with a diff
+// for each attribute that differs. The attributes of nested blocks are
+// compared individually, keyed by their path separated by ".". An instance
+// that does not exist yet has a null old value.
+func NewInstanceDiff(old cty.Value, new cty.Value) *InstanceDiff {
+	diff := &InstanceDiff{
+		Attributes: make(map[string]*InstanceAttrDiff),
+		Meta:       make(map[string]interface{}),
+	}
+	diffAttributes("", old, new, diff.Attributes)
+	return diff
+}
+
+func diffAttributes(prefix string, old cty.Value, new cty.Value, attributes map[string]*InstanceAttrDiff) {
+	if isObjectOrNull(old) && isObjectOrNull(new) && !(old.IsNull() && new.IsNull()) {
+		names := make(map[string]bool)
+		for _, value := range []cty.Value{old, new} {
+			if value.Type().IsObjectType() {
+				for name := range value.Type().AttributeTypes() {
+					names[name] = true
+				}
+			}
+		}
+		keys := make([]string, 0, len(names))
+		for name := range names {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			diffAttributes(prefix+name+".", attributeOrNull(old, name), attributeOrNull(new, name), attributes)
+		}
+		return
+	}
+	if valuesEqual(old, new) {
+		return
+	}
+	attributes[strings.TrimSuffix(prefix, ".")] = &InstanceAttrDiff{
+		Old:         old,
+		New:         new,
+		NewComputed: !new.IsWhollyKnown(),
+		NewRemoved:  new.IsNull() && !old.IsNull(),
+	}
+}
+
+// isObjectOrNull returns true for a known object, or a null value of any
+// type, as the value of a block that is not set is null.
+func isObjectOrNull(value cty.Value) bool {
+	return value.IsNull() || (value.IsKnown() && value.Type().IsObjectType())
+}
+
+// attributeOrNull returns the attribute of an object, or null if the object
+// is null or has no such attribute.
+func attributeOrNull(value cty.Value, name string) cty.Value {
+	ty := value.Type()
+	if !ty.IsObjectType() || !ty.HasAttribute(name) {
+		return cty.NullVal(cty.DynamicPseudoType)
+	} else if value.IsNull() {
+		return cty.NullVal(ty.AttributeType(name))
+	}
+	return value.GetAttr(name)
+}
+
+// valuesEqual returns true if both values are known and equal, values that
+// are not known are assumed to differ.
+func valuesEqual(a cty.Value, b cty.Value) bool {
+	if !a.IsWhollyKnown() || !b.IsWhollyKnown() {
+		return false
+	}
+	equal := a.Equals(b)
+	return equal.IsKnown() && equal.True()
+}
@@ -0,0 +1,204 @@
+package state
+
+import (
+	"github.com/zclconf/go-cty/cty"
+	"sort"
+	"testing"
+)
+
+var testType = cty.Object(map[string]cty.Type{
+	"containerId": cty.String,
+	"id":          cty.String,
+	"tags":        cty.List(cty.String),
+	"config":      cty.Object(map[string]cty.Type{"pidsMax": cty.Number, "memMax": cty.Number}),
+})
+
+// testValue returns an instance value with the given attributes, the others
+// are null
+func testValue(attributes map[string]cty.Value) cty.Value {
+	values := make(map[string]cty.Value)
+	for name, ty := range testType.AttributeTypes() {
+		if value, ok := attributes[name]; ok {
+			values[name] = value
+		} else {
+			values[name] = cty.NullVal(ty)
+		}
+	}
+	return cty.ObjectVal(values)
+}
+
+func testConfig(pidsMax int64, memMax int64) cty.Value {
+	return cty.ObjectVal(map[string]cty.Value{"pidsMax": cty.NumberIntVal(pidsMax), "memMax": cty.NumberIntVal(memMax)})
+}
+
+func TestNewInstanceDiff(t *testing.T) {
+	current := testValue(map[string]cty.Value{
+		"containerId": cty.StringVal("a"),
+		"id":          cty.StringVal("1"),
+		"tags":        cty.ListVal([]cty.Value{cty.StringVal("x")}),
+		"config":      testConfig(20, 4096),
+	})
+	tests := []struct {
+		name     string
+		old      cty.Value
+		new      cty.Value
+		want     []string
+		computed []string
+		removed  []string
+	}{
+		{
+			name: "unchanged",
+			old:  current,
+			new:  current,
+		},
+		{
+			name: "changed attribute",
+			old:  current,
+			new: testValue(map[string]cty.Value{
+				"containerId": cty.StringVal("b"),
+				"id":          cty.StringVal("1"),
+				"tags":        cty.ListVal([]cty.Value{cty.StringVal("x")}),
+				"config":      testConfig(20, 4096),
+			}),
+			want: []string{"containerId"},
+		},
+		{
+			name: "nested attribute",
+			old:  current,
+			new: testValue(map[string]cty.Value{
+				"containerId": cty.StringVal("a"),
+				"id":          cty.StringVal("1"),
+				"tags":        cty.ListVal([]cty.Value{cty.StringVal("x")}),
+				"config":      testConfig(30, 4096),
+			}),
+			want: []string{"config.pidsMax"},
+		},
+		{
+			name: "list compared as a whole",
+			old:  current,
+			new: testValue(map[string]cty.Value{
+				"containerId": cty.StringVal("a"),
+				"id":          cty.StringVal("1"),
+				"tags":        cty.ListVal([]cty.Value{cty.StringVal("x"), cty.StringVal("y")}),
+				"config":      testConfig(20, 4096),
+			}),
+			want: []string{"tags"},
+		},
+		{
+			name: "computed",
+			old:  current,
+			new: testValue(map[string]cty.Value{
+				"containerId": cty.StringVal("a"),
+				"id":          cty.UnknownVal(cty.String),
+				"tags":        cty.ListVal([]cty.Value{cty.StringVal("x")}),
+				"config":      testConfig(20, 4096),
+			}),
+			want:     []string{"id"},
+			computed: []string{"id"},
+		},
+		{
+			name: "removed",
+			old:  current,
+			new: testValue(map[string]cty.Value{
+				"containerId": cty.StringVal("a"),
+				"id":          cty.StringVal("1"),
+				"config":      testConfig(20, 4096),
+			}),
+			want:    []string{"tags"},
+			removed: []string{"tags"},
+		},
+		{
+			name: "created",
+			old:  cty.NullVal(testType),
+			new:  current,
+			want: []string{"config.memMax", "config.pidsMax", "containerId", "id", "tags"},
+		},
+		{
+			name:    "destroyed",
+			old:     testValue(map[string]cty.Value{"containerId": cty.StringVal("a")}),
+			new:     cty.NullVal(testType),
+			want:    []string{"containerId"},
+			removed: []string{"containerId"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := NewInstanceDiff(test.old, test.new)
+			var got, computed, removed []string
+			for key, attribute := range diff.Attributes {
+				got = append(got, key)
+				if attribute.NewComputed {
+					computed = append(computed, key)
+				}
+				if attribute.NewRemoved {
+					removed = append(removed, key)
+				}
+			}
+			sort.Strings(got)
+			if !equalStrings(got, test.want) {
+				t.Errorf("got attributes %v, want %v", got, test.want)
+			}
+			if !equalStrings(computed, test.computed) {
+				t.Errorf("got computed %v, want %v", computed, test.computed)
+			}
+			if !equalStrings(removed, test.removed) {
+				t.Errorf("got removed %v, want %v", removed, test.removed)
+			}
+		})
+	}
+}
+
+func TestInstanceDataChanges(t *testing.T) {
+	current := &InstanceState{Value: testValue(map[string]cty.Value{
+		"containerId": cty.StringVal("a"),
+		"tags":        cty.ListVal([]cty.Value{cty.StringVal("x")}),
+		"config":      testConfig(20, 4096),
+	})}
+	planned := &InstanceState{Value: testValue(map[string]cty.Value{
+		"containerId": cty.StringVal("a"),
+		"id":          cty.UnknownVal(cty.String),
+		"tags":        cty.ListVal([]cty.Value{cty.StringVal("y")}),
+		"config":      testConfig(30, 4096),
+	})}
+	tests := []struct {
+		key     string
+		changed bool
+		old     cty.Value
+		new     cty.Value
+	}{
+		{"containerId", false, cty.StringVal("a"), cty.StringVal("a")},
+		{"config.pidsMax", true, cty.NumberIntVal(20), cty.NumberIntVal(30)},
+		{"config.memMax", false, cty.NumberIntVal(4096), cty.NumberIntVal(4096)},
+		{"tags.0", true, cty.StringVal("x"), cty.StringVal("y")},
+		{"tags.1", false, cty.NullVal(cty.DynamicPseudoType), cty.NullVal(cty.DynamicPseudoType)},
+		{"id", true, cty.NullVal(cty.String), cty.UnknownVal(cty.String)},
+		{"missing", false, cty.NullVal(cty.DynamicPseudoType), cty.NullVal(cty.DynamicPseudoType)},
+	}
+	data := NewInstanceData(current, planned)
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if got := data.HasChange(test.key); got != test.changed {
+				t.Errorf("got HasChange %v, want %v", got, test.changed)
+			}
+			old, new := data.GetChange(test.key)
+			if !old.(cty.Value).RawEquals(test.old) || !new.(cty.Value).RawEquals(test.new) {
+				t.Errorf("got change %#v to %#v, want %#v to %#v", old, new, test.old, test.new)
+			}
+		})
+	}
+	if !NewInstanceData(nil, planned).HasChange("containerId") {
+		t.Error("attribute of a new instance is not changed")
+	}
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package state
 
 import (
 	"fmt"
+	"github.com/zclconf/go-cty/cty"
 	"sync"
 )
 
@@ -10,8 +11,11 @@ type InstanceState struct {
 	ID         string                 `json:"id"`
 	Type       string                 `json:"kind"`
 	Attributes map[string]interface{} `json:"attributes"`
-	Meta       map[string]interface{} `json:"meta"`
-	Provider   string                 `json:"provider"`
+	// Value holds the attributes as an object of the type implied by the
+	// instance schema, where fields that are not set are null
+	Value    cty.Value              `json:"-"`
+	Meta     map[string]interface{} `json:"meta"`
+	Provider string                 `json:"provider"`
 	// Tainted is used to mark a resource for recreation.
 	Tainted bool `json:"tainted"`
 
@@ -6,7 +6,7 @@ package state
  */
 
 import (
-	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -46,8 +46,61 @@ func (d *InstanceData) GetFromNesting(nesting []string) (interface{}, error) {
 	return d.state.GetAttributeNesting(nesting)
 }
 
+// Value returns the value of the instance, from the new state if there is
+// one.
+func (d *InstanceData) Value() cty.Value {
+	if d.newState != nil {
+		return d.newState.Value
+	} else if d.state != nil {
+		return d.state.Value
+	}
+	return cty.NullVal(cty.DynamicPseudoType)
+}
+
+// GetChange returns the old and new cty.Value of an attribute, where key is
+// the path of the attribute separated by ".". An attribute of a state that
+// does not exist is null.
 func (d *InstanceData) GetChange(key string) (interface{}, interface{}) {
-	return nil, nil // TODO: implement this
+	return d.getChange(key)
+}
+
+func (d *InstanceData) getChange(key string) (cty.Value, cty.Value) {
+	old, new := cty.NullVal(cty.DynamicPseudoType), cty.NullVal(cty.DynamicPseudoType)
+	if d.state != nil {
+		old = valueAtPath(d.state.Value, key)
+	}
+	if d.newState != nil {
+		new = valueAtPath(d.newState.Value, key)
+	}
+	return old, new
+}
+
+// valueAtPath returns the value of the attribute at a path separated by
+// ".", indexing into lists and maps. The value is null if there is no such
+// attribute and unknown if an enclosing value is unknown.
+func valueAtPath(value cty.Value, key string) cty.Value {
+	for _, name := range strings.Split(key, ".") {
+		ty := value.Type()
+		switch {
+		case value.IsNull():
+			return cty.NullVal(cty.DynamicPseudoType)
+		case !value.IsKnown():
+			return cty.UnknownVal(cty.DynamicPseudoType)
+		case ty.IsObjectType() && ty.HasAttribute(name):
+			value = value.GetAttr(name)
+		case ty.IsMapType() && value.HasIndex(cty.StringVal(name)).True():
+			value = value.Index(cty.StringVal(name))
+		case ty.IsListType() || ty.IsTupleType():
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= value.LengthInt() {
+				return cty.NullVal(cty.DynamicPseudoType)
+			}
+			value = value.Index(cty.NumberIntVal(int64(index)))
+		default:
+			return cty.NullVal(cty.DynamicPseudoType)
+		}
+	}
+	return value
 }
 
 func (d *InstanceData) HasChanges(keys ...string) bool {
@@ -80,8 +133,8 @@ func (d *InstanceData) HasChangesExcept(keys ...string) bool {
 }
 
 func (d *InstanceData) HasChange(key string) bool {
-	o, n := d.GetChange(key)
-	return !reflect.DeepEqual(o, n)
+	o, n := d.getChange(key)
+	return !valuesEqual(o, n)
 }
 
 func (d *InstanceData) HasChangeExcept(key string) bool {
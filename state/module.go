@@ -0,0 +1,15 @@
+package state
+
+import (
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Module is a child configuration instantiated by a module block, with its
+// variables assigned from the inputs of the block.
+type Module struct {
+	Name string
+	// Source is the path of the configuration as written in the module block
+	Source      string
+	Inputs      map[string]cty.Value
+	ParsedState *ParsedState
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"encoding/json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Output is a value exposed by a configuration, referenced from a parent
+// configuration as module.<NAME>.<OUTPUT>.
+type Output struct {
+	Name  string
+	Value cty.Value
+	// Sensitive marks the value as secret so that it is not displayed unless
+	// requested by name
+	Sensitive   bool
+	Description string
+}
+
+// jsonOutput is the form of an output in the state file, the type is stored
+// alongside the value so that it can be decoded again.
+type jsonOutput struct {
+	Value       json.RawMessage `json:"value"`
+	Type        json.RawMessage `json:"type"`
+	Sensitive   bool            `json:"sensitive"`
+	Description string          `json:"description,omitempty"`
+}
+
+func (o *Output) MarshalJSON() ([]byte, error) {
+	valueType := o.Value.Type()
+	// Values only known once applied are stored as null
+	value, err := ctyjson.Marshal(cty.UnknownAsNull(o.Value), valueType)
+	if err != nil {
+		return nil, err
+	}
+	typeJSON, err := ctyjson.MarshalType(valueType)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&jsonOutput{
+		Value:       value,
+		Type:        typeJSON,
+		Sensitive:   o.Sensitive,
+		Description: o.Description,
+	})
+}
+
+func (o *Output) UnmarshalJSON(data []byte) error {
+	var decoded jsonOutput
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+	valueType, err := ctyjson.UnmarshalType(decoded.Type)
+	if err != nil {
+		return err
+	}
+	o.Value, err = ctyjson.Unmarshal(decoded.Value, valueType)
+	if err != nil {
+		return err
+	}
+	o.Sensitive = decoded.Sensitive
+	o.Description = decoded.Description
+	return nil
+}
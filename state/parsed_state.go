@@ -1,8 +1,14 @@
 package state
 
 type ParsedState struct {
+	// Path is the file or directory the configuration was loaded from
+	Path      string
 	Variables map[string]*Variable
 	Instances map[string]*InstanceData
 	Captures  map[string]*Capture
-	Data      map[string]*Data
+	// Data is keyed by <TYPE>.<NAME>, as data of different types may share
+	// a name
+	Data    map[string]*Data
+	Modules map[string]*Module
+	Outputs map[string]*Output
 }
@@ -4,15 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
+	"sort"
 )
 
 type State struct {
 	Filename    string
 	ParsedState *ParsedState
-	oldState    *JSONSchmState
-	newState    *JSONSchmState
+	// Upgrader upgrades the state file read by Read, it may be nil
+	Upgrader Upgrader
+	oldState *JSONSchmState
+	newState *JSONSchmState
 }
 
 func NewJSONSchmState() *JSONSchmState {
@@ -20,10 +22,14 @@ func NewJSONSchmState() *JSONSchmState {
 }
 
 type JSONModuleState struct {
-	Path      string                    `json:"path"`
+	Path string `json:"path"`
+	// Address is module.<NAME> for each module from the root configuration,
+	// e.g. module.a.module.b, and empty for the root configuration
+	Address   string                    `json:"address,omitempty"`
 	Instances map[string]*InstanceState `json:"instances"`
 	Captures  map[string]*Capture       `json:"captures"`
 	Data      map[string]*Data          `json:"data"`
+	Outputs   map[string]*Output        `json:"outputs"`
 }
 
 type JSONSchmState struct {
@@ -31,6 +37,11 @@ type JSONSchmState struct {
 	Modules []JSONModuleState `json:"modules"`
 }
 
+// StateVersion is the version of the state file format written by Write.
+// Version 1 stored each attribute value of a basic type as a string, version
+// 2 stores them as JSON numbers, booleans and strings.
+const StateVersion = 2
+
 var (
 	operationalDirectory             = "operational"
 	stateOut                         = fmt.Sprintf("%s/state.json", operationalDirectory)
@@ -51,6 +62,7 @@ func createDirIfNotExists(path string, mode os.FileMode) error {
 //	  "modules": [
 //		  {
 //			  "path": "<STRING>",
+//			  "address": "<STRING>",
 //			  "instances": [
 //				  {
 //					  "id": "<STRING>",
@@ -58,7 +70,7 @@ func createDirIfNotExists(path string, mode os.FileMode) error {
 //					  "name": "<STRING>",
 //					  "type": "<STRING>",
 //					  "attributes": {
-//						  ..."<STRING>": "<STRING | INT | FLOAT | MAP>"
+//						  ..."<STRING>": <STRING | INT | FLOAT | BOOL | ARRAY | MAP>
 //					  },
 //                    "meta": {
 //						  ..."<STRING>": "<STRING | INT | FLOAT | MAP>"
@@ -68,6 +80,7 @@ func createDirIfNotExists(path string, mode os.FileMode) error {
 //			  "captures": [
 //				  {
 //					  "name": "<STRING>",
+//					  "source": "<STRING>",
 //					  "hasDependency": [
 //						  ..."<STRING>"
 //					  ],
@@ -81,7 +94,15 @@ func createDirIfNotExists(path string, mode os.FileMode) error {
 //				  "schema": {
 //					  ..."<STRING>": "<STRING | INT | FLOAT | MAP>"
 //				  }
-//			  ]
+//			  ],
+//			  "outputs": {
+//				  "<STRING>": {
+//					  "value": "<JSON>",
+//					  "type": "<JSON>",
+//					  "sensitive": "<BOOL>",
+//					  "description": "<STRING>"
+//				  }
+//			  }
 //		  }
 //	  ]
 // }
@@ -110,31 +131,43 @@ func getStateFromInstanceData(instances map[string]*InstanceData) map[string]*In
 	return states
 }
 
+// getModuleStates returns the state of a configuration followed by the state
+// of each of its modules, in order of their names.
+func getModuleStates(address string, parsedState *ParsedState) []JSONModuleState {
+	modules := []JSONModuleState{{
+		Path:      parsedState.Path,
+		Address:   address,
+		Instances: getStateFromInstanceData(parsedState.Instances),
+		Captures:  parsedState.Captures,
+		Data:      parsedState.Data,
+		Outputs:   parsedState.Outputs,
+	}}
+	names := make([]string, 0, len(parsedState.Modules))
+	for name := range parsedState.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		moduleAddress := "module." + name
+		if address != "" {
+			moduleAddress = address + "." + moduleAddress
+		}
+		modules = append(modules, getModuleStates(moduleAddress, parsedState.Modules[name].ParsedState)...)
+	}
+	return modules
+}
+
 func (s *State) Write() error {
 	// 1. Go through each instance/capture/data
 	// 2. Update the JSONSchmState with the new instance/capture/data state
 	// 3. Write the state to file
 
 	s.newState = &JSONSchmState{
-		Version: 1,
+		Version: StateVersion,
 		Modules: make([]JSONModuleState, 0),
 	}
 
-	//if !strings.HasSuffix(schematicFilePath, ".schm") {
-	//	givenFileType := strings.Split(schematicFilePath, ".")
-	//	return fmt.Errorf(
-	//		"schematic file path is not of a valid file type. Expected: .schm, Got: .%s",
-	//		givenFileType[len(givenFileType) - 1],
-	//	)
-	//}
-
-	s.newState.Modules = append(s.newState.Modules, JSONModuleState{
-		Path:      "schematicFilePath",
-		Instances: getStateFromInstanceData(s.ParsedState.Instances),
-		Captures:  s.ParsedState.Captures,
-		Data:      s.ParsedState.Data,
-	})
-	fmt.Println(s.newState.Modules[0].Instances["test_capsule"])
+	s.newState.Modules = append(s.newState.Modules, getModuleStates("", s.ParsedState)...)
 	file, _ := json.MarshalIndent(s.newState, "", "\t")
 	err := createDirIfNotExists(operationalDirectory, stateDirectoryMode)
 	if err != nil {
@@ -155,14 +188,45 @@ func (s *State) Read() error {
 	// 5. Check existing resources for changes
 	// 6. Mark resources as tainted if different
 
-	data, err := ioutil.ReadFile(s.Filename)
+	oldState, err := ReadJSONSchmState(s.Filename, s.Upgrader)
+	if os.IsNotExist(err) {
+		// Nothing has been applied yet
+		s.oldState = &JSONSchmState{Version: StateVersion}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	s.oldState = oldState
+	return nil
+}
+
+// Upgrader converts the attributes of a state file written before
+// StateVersion to their types. Only the schema of an instance knows these
+// types, so it is given by the caller, e.g. providers.UpgradeState.
+type Upgrader func(schmState *JSONSchmState) error
+
+// ReadJSONSchmState reads a state file written by State.Write. If upgrader
+// is not nil it is called to upgrade the state to StateVersion, which is
+// needed for a state file written by an earlier version.
+func ReadJSONSchmState(filename string, upgrader Upgrader) (*JSONSchmState, error) {
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	err = json.Unmarshal(data, s.oldState)
+	schmState := NewJSONSchmState()
+	err = json.Unmarshal(data, schmState)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	log.Println(s.oldState.Modules[0].Instances)
-	return nil
+	for _, module := range schmState.Modules {
+		for name, output := range module.Outputs {
+			output.Name = name
+		}
+	}
+	if upgrader != nil {
+		if err = upgrader(schmState); err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err.Error())
+		}
+	}
+	return schmState, nil
 }
@@ -0,0 +1,171 @@
+package state
+
+import (
+	"errors"
+	"github.com/zclconf/go-cty/cty"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testStateFile = `{
+	"version": 1,
+	"modules": [
+		{
+			"path": ".",
+			"instances": {
+				"a": {"id": "a", "kind": "container", "provider": "test", "attributes": {"inbuilt": "true"}}
+			},
+			"outputs": {
+				"o": {"value": "x", "type": "string", "sensitive": true}
+			}
+		}
+	]
+}`
+
+func TestModuleStates(t *testing.T) {
+	inner := &ParsedState{Path: "b"}
+	root := &ParsedState{
+		Path: ".",
+		Modules: map[string]*Module{
+			"b": {Name: "b", ParsedState: &ParsedState{
+				Path:    "b",
+				Modules: map[string]*Module{"c": {Name: "c", ParsedState: inner}},
+			}},
+			"a": {Name: "a", ParsedState: &ParsedState{Path: "a"}},
+		},
+	}
+	modules := getModuleStates("", root)
+	got := make([]string, 0, len(modules))
+	for _, module := range modules {
+		got = append(got, module.Path+" "+module.Address)
+	}
+	want := []string{". ", "a module.a", "b module.b", "b module.b.module.c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadJSONSchmState(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		upgrader Upgrader
+		version  int
+		wantErr  string
+	}{
+		{
+			name:    "without an upgrader",
+			src:     testStateFile,
+			version: 1,
+		},
+		{
+			name: "upgraded",
+			src:  testStateFile,
+			upgrader: func(schmState *JSONSchmState) error {
+				schmState.Version = StateVersion
+				return nil
+			},
+			version: StateVersion,
+		},
+		{
+			name: "upgrade fails",
+			src:  testStateFile,
+			upgrader: func(schmState *JSONSchmState) error {
+				return errors.New("field [inbuilt] is not a valid value for its type: maybe")
+			},
+			wantErr: "state.json: field [inbuilt] is not a valid value for its type: maybe",
+		},
+		{
+			name:    "invalid JSON",
+			src:     `{"version": 1,`,
+			wantErr: "unexpected end of JSON input",
+		},
+		{
+			name:    "invalid output type",
+			src:     `{"modules": [{"outputs": {"o": {"value": "x", "type": "text"}}}]}`,
+			wantErr: "invalid primitive type name \"text\"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "state.json")
+			if err := ioutil.WriteFile(filename, []byte(test.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			schmState, err := ReadJSONSchmState(filename, test.upgrader)
+			if test.wantErr != "" {
+				// Upgrade errors are prefixed with the file name
+				if err == nil || strings.TrimPrefix(err.Error(), dir+string(filepath.Separator)) != test.wantErr {
+					t.Errorf("got %v, want %s", err, test.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if schmState.Version != test.version {
+				t.Errorf("got version %d, want %d", schmState.Version, test.version)
+			}
+			output := schmState.Modules[0].Outputs["o"]
+			if output.Name != "o" || !output.Value.RawEquals(cty.StringVal("x")) || !output.Sensitive {
+				t.Errorf("got output %#v", output)
+			}
+			if got := schmState.Modules[0].Instances["a"].Attributes["inbuilt"]; got != "true" {
+				t.Errorf("got attribute %#v, want \"true\"", got)
+			}
+		})
+	}
+}
+
+func TestOutputRoundTrip(t *testing.T) {
+	want := &Output{
+		Name:        "o",
+		Value:       cty.ListVal([]cty.Value{cty.NumberIntVal(1), cty.NumberIntVal(2)}),
+		Sensitive:   true,
+		Description: "A list",
+	}
+	data, err := want.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Output{Name: "o"}
+	if err := got.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Value.RawEquals(want.Value) || got.Sensitive != want.Sensitive || got.Description != want.Description {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestStateReadMissing(t *testing.T) {
+	s := &State{Filename: filepath.Join(t.TempDir(), "state.json")}
+	if err := s.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if s.oldState == nil || s.oldState.Version != StateVersion || len(s.oldState.Modules) != 0 {
+		t.Errorf("got %#v, want an empty state", s.oldState)
+	}
+}
+
+func TestStateReadUpgrades(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	if err := ioutil.WriteFile(filename, []byte(testStateFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &State{
+		Filename: filename,
+		Upgrader: func(schmState *JSONSchmState) error {
+			schmState.Version = StateVersion
+			return nil
+		},
+	}
+	if err := s.Read(); err != nil {
+		t.Fatal(err)
+	}
+	if s.oldState.Version != StateVersion {
+		t.Errorf("got version %d, want %d", s.oldState.Version, StateVersion)
+	}
+}
@@ -6,7 +6,18 @@ import (
 )
 
 type Variable struct {
-	Name     string
-	Value    cty.Value `json:"Value"`
-	BaseType schematic.ValueType
+	Name        string
+	Value       cty.Value `json:"Value"`
+	BaseType    schematic.ValueType
+	Default     cty.Value
+	Description string
+	// Sensitive marks the value as secret so that it is not displayed
+	Sensitive   bool
+	Validations []*VariableValidation
+}
+
+// VariableValidation is a rule the value of a variable must satisfy
+type VariableValidation struct {
+	Condition    string
+	ErrorMessage string
 }
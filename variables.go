@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/EngineersBox/ModularCLI/cli"
+	"github.com/EngineersBox/Schematic/parser"
+	"github.com/EngineersBox/Schematic/state"
+	"os"
+	"strings"
+)
+
+// stringSliceFlag is a flag that can be given multiple times, collecting
+// each value in order.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type variableFlags struct {
+	vars     stringSliceFlag
+	varFiles stringSliceFlag
+}
+
+// commandVariableFlags holds the variable flags of each command that parses
+// schematic files.
+var commandVariableFlags = map[string]*variableFlags{
+	"plan":     {},
+	"apply":    {},
+	"validate": {},
+}
+
+// registerVariableFlags adds the repeatable -var and -var-file flags, which
+// are not supported by cli.Flag, directly to the flag set of each command.
+func registerVariableFlags(schematicCli *cli.CLI) {
+	for name, flags := range commandVariableFlags {
+		flagSet := schematicCli.Commands[name].FlagSet
+		flagSet.Var(&flags.vars, "var", "Set a variable value as <NAME>=<VALUE>, can be given multiple times")
+		flagSet.Var(&flags.varFiles, "var-file", "Set variable values from a .schmvars file, can be given multiple times")
+	}
+}
+
+// collectVariableOverrides gathers the variable values for a command in order
+// of precedence: environment variables, then variable files, then -var flags.
+func collectVariableOverrides(command string) (parser.VariableOverrides, error) {
+	overrides := make(parser.VariableOverrides)
+	overrides.AddEnvironment(os.Environ())
+	flags := commandVariableFlags[command]
+	if flags == nil {
+		return overrides, nil
+	}
+	for _, path := range flags.varFiles {
+		err := overrides.AddFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, assignment := range flags.vars {
+		err := overrides.AddFlag(assignment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return overrides, nil
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// isTerminal reports whether the file is a character device other than the
+// null device, which is the case for an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	devNull, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, devNull)
+}
+
+// promptVariable asks for the value of a variable on stdin
+func promptVariable(variable *state.Variable) (string, error) {
+	fmt.Fprintf(os.Stderr, "var.%s\n", variable.Name)
+	if variable.Description != "" {
+		fmt.Fprintf(os.Stderr, "  %s\n", variable.Description)
+	}
+	fmt.Fprint(os.Stderr, "\n  Enter a value: ")
+	input, err := stdinReader.ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(input, "\r\n"), nil
+}